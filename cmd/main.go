@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/Dyastin-0/mrps/internal/api"
+	"github.com/Dyastin-0/mrps/internal/certs"
 	"github.com/Dyastin-0/mrps/internal/health"
 	"github.com/Dyastin-0/mrps/internal/logger"
 	"github.com/Dyastin-0/mrps/internal/metrics"
@@ -28,6 +29,7 @@ func main() {
 	}()
 
 	configPath := flag.String("config", "mrps.yaml", "Path to the config file")
+	exportRoot := flag.String("export-root", "", "Write the root of the local CA to the given path, - for stdout, and exit")
 	flag.Parse()
 
 	log.Info().Str("path", *configPath).Msg("config")
@@ -37,6 +39,13 @@ func main() {
 		log.Fatal().Err(err).Msg("config")
 	}
 
+	if *exportRoot != "" {
+		if err := writeRoot(*exportRoot); err != nil {
+			log.Fatal().Err(err).Msg("certs")
+		}
+		return
+	}
+
 	err = godotenv.Load()
 	if err != nil {
 		log.Fatal().Err(err).Msg("env")
@@ -67,3 +76,23 @@ func main() {
 
 	log.Info().Msg("shutting down gracefully...")
 }
+
+// writeRoot exports the local CA root so it can be added to a trust store
+func writeRoot(path string) error {
+	root, err := certs.LocalRoot()
+	if err != nil {
+		return err
+	}
+
+	if path == "-" {
+		_, err = os.Stdout.Write(root)
+		return err
+	}
+
+	if err := os.WriteFile(path, root, 0o644); err != nil {
+		return err
+	}
+
+	log.Info().Str("path", path).Str("status", "exported").Msg("certs")
+	return nil
+}
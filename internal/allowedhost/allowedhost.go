@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
 )
 
 func Handler(next http.Handler) http.Handler {
@@ -11,7 +12,7 @@ func Handler(next http.Handler) http.Handler {
 		host := r.Host
 
 		if config.DomainTrie.Match(host) == nil {
-			http.Error(w, "forbidden, host not allowed", http.StatusForbidden)
+			errorpage.Write(w, r, http.StatusForbidden, "forbidden, host not allowed")
 			return
 		}
 
@@ -17,6 +17,7 @@ func Start() {
 	router.Mount("/config", configRoute())
 	router.Mount("/ssh", sshRoute())
 	router.Mount("/logs", logRoute())
+	router.Mount("/certs", certsRoute())
 
 	log.Info().Str("status", "running").Str("port", config.Misc.ConfigAPIPort).Msg("api")
 	err := http.ListenAndServe(":"+config.Misc.ConfigAPIPort, router)
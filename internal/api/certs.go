@@ -0,0 +1,24 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Dyastin-0/mrps/internal/certs"
+	"github.com/go-chi/chi/v5"
+)
+
+func handleCerts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(certs.Inventory())
+}
+
+func certsRoute() *chi.Mux {
+	router := chi.NewRouter()
+
+	router.Use(jwt)
+
+	router.Get("/", handleCerts)
+
+	return router
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/Dyastin-0/mrps/internal/config"
 	"github.com/Dyastin-0/mrps/internal/types"
 	"github.com/Dyastin-0/mrps/internal/ws"
+	"github.com/Dyastin-0/mrps/pkg/cache"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
 )
@@ -73,6 +74,111 @@ func handleEnable(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+type maintenanceRequest struct {
+	types.MaintenanceConfig
+	Path string `json:"path,omitempty"`
+}
+
+func handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	domain := chi.URLParam(r, "domain")
+	token := r.Header.Get("Authorization")
+	token = token[7:]
+
+	decoder := json.NewDecoder(r.Body)
+	req := maintenanceRequest{}
+
+	err := decoder.Decode(&req)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	cfg := config.DomainTrie.Match(domain)
+	if cfg == nil {
+		http.Error(w, "Domain not defined", http.StatusNotFound)
+		return
+	}
+
+	maintenance := cfg.Maintenance
+	if req.Path != "" {
+		route, ok := cfg.Routes[req.Path]
+		if !ok {
+			http.Error(w, "Route not defined", http.StatusNotFound)
+			return
+		}
+		maintenance = route.Maintenance
+	}
+
+	if maintenance == nil {
+		http.Error(w, "Maintenance not supported", http.StatusNotFound)
+		return
+	}
+
+	if err := maintenance.Set(req.MaintenanceConfig); err != nil {
+		http.Error(w, "Bad request, "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info().
+		Str("domain", domain).
+		Str("path", req.Path).
+		Bool("enabled", req.Enabled).
+		Time("start", req.Start).
+		Time("end", req.End).
+		Msg("maintenance")
+
+	data := struct {
+		Type        string                             `json:"type"`
+		Maintenance map[string]types.MaintenanceStatus `json:"maintenance"`
+	}{
+		Type:        "maintenance",
+		Maintenance: config.DomainTrie.GetMaintenance(),
+	}
+
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		log.Error().Err(err).Msg("api")
+		return
+	}
+
+	go ws.Clients.Send(token, dataBytes)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func handlePurge(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	filter := cache.Filter{}
+
+	err := decoder.Decode(&filter)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	if filter.Host == "" && filter.Prefix == "" && len(filter.Tags) == 0 {
+		http.Error(w, "Bad request, a host, prefix or tags are required", http.StatusBadRequest)
+		return
+	}
+
+	purged := config.Cache.Purge(filter)
+
+	log.Info().
+		Str("host", filter.Host).
+		Str("prefix", filter.Prefix).
+		Strs("tags", filter.Tags).
+		Int("purged", purged).
+		Msg("cache")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Purged int `json:"purged"`
+	}{
+		Purged: purged,
+	})
+}
+
 func configRoute() *chi.Mux {
 	router := chi.NewRouter()
 
@@ -81,6 +187,8 @@ func configRoute() *chi.Mux {
 	router.Get("/", handleGet)
 	router.Post("/sync", handleSync)
 	router.Post("/{domain}/enable", handleEnable)
+	router.Post("/{domain}/maintenance", handleMaintenance)
+	router.Post("/cache/purge", handlePurge)
 
 	return router
 }
@@ -0,0 +1,342 @@
+// Package certs holds the certificate manager shared by the HTTPS and TLS listeners
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/acme"
+	"github.com/Dyastin-0/mrps/pkg/devca"
+	"github.com/Dyastin-0/mrps/pkg/tlspolicy"
+	"github.com/Dyastin-0/mrps/pkg/watcher"
+	"github.com/caddyserver/certmagic"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+var (
+	Magic *certmagic.Config
+
+	cache    *certmagic.Cache
+	issuer   *certmagic.ACMEIssuer
+	localCA  *devca.CA
+	store    *tlspolicy.Store
+	limiter  *rate.Limiter
+	wildcard bool
+
+	managedMu sync.Mutex
+	managed   = make(map[string]bool)
+	synced    bool
+)
+
+// Setup builds Magic from the tls section and loads the cert directory, it has to run before the listeners start
+func Setup(ctx context.Context) error {
+	acmeConfig := config.TLS.Config
+
+	// the Cloudflare token used to be the only way to get certificates
+	if acmeConfig.CA != acme.Local && acmeConfig.Challenge == "" && acmeConfig.DNS == nil && os.Getenv("CLOUDFLARE_API_TOKEN") != "" {
+		acmeConfig.DNS = &acme.DNSConfig{Provider: "cloudflare"}
+	}
+
+	// a cache of our own, the default one can't release certificates of removed domains
+	var magic *certmagic.Config
+	cache = certmagic.NewCache(certmagic.CacheOptions{
+		GetConfigForCert: func(certmagic.Certificate) (*certmagic.Config, error) {
+			return magic, nil
+		},
+	})
+
+	limiter = acmeConfig.OnDemand.Limiter()
+	wildcard = acmeConfig.Wildcards()
+
+	magicConfig := certmagic.Config{}
+	if limiter != nil {
+		magicConfig.OnDemand = &certmagic.OnDemandConfig{DecisionFunc: decide}
+	}
+	magicConfig.OnEvent = onEvent
+	magic = certmagic.New(cache, magicConfig)
+
+	var err error
+	if acmeConfig.CA == acme.Local {
+		if localCA, err = devca.Load(LocalCADir()); err != nil {
+			return fmt.Errorf("local ca: %v", err)
+		}
+		magic.Issuers = []certmagic.Issuer{localCA}
+		issuer = nil
+	} else {
+		if issuer, err = acmeConfig.Issuer(magic, config.Misc.Email); err != nil {
+			return err
+		}
+		magic.Issuers = []certmagic.Issuer{issuer}
+		localCA = nil
+	}
+
+	Magic = magic
+
+	config.OnReload(func(ctx context.Context) {
+		if err := Sync(ctx); err != nil {
+			log.Warn().Err(err).Msg("certs")
+		}
+	})
+
+	if config.TLS.CertDir != "" {
+		store, err = tlspolicy.NewStore(config.TLS.CertDir)
+		if store == nil {
+			return fmt.Errorf("cert dir: %v", err)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("certs")
+		}
+
+		go watcher.WatchDir(ctx, config.TLS.CertDir, func() {
+			if err := store.Load(); err != nil {
+				log.Error().Err(err).Msg("certs")
+			}
+			log.Info().Str("status", "reloaded").Strs("names", store.Names()).Msg("certs")
+		})
+	}
+
+	if localCA != nil {
+		log.Info().Str("ca", acme.Local).Str("root", filepath.Join(LocalCADir(), devca.RootFile)).Bool("on_demand", limiter != nil).Msg("certs")
+		return nil
+	}
+
+	log.Info().Str("ca", issuer.CA).Str("challenge", challenge(acmeConfig)).Bool("on_demand", limiter != nil).Msg("certs")
+	return nil
+}
+
+// LocalCADir returns the directory of the local CA, tls.local_ca_dir or the default
+func LocalCADir() string {
+	if config.TLS.LocalCADir != "" {
+		return config.TLS.LocalCADir
+	}
+
+	return devca.DefaultDir()
+}
+
+// LocalRoot returns the root of the local CA, generating it on first use
+func LocalRoot() ([]byte, error) {
+	ca, err := devca.Load(LocalCADir())
+	if err != nil {
+		return nil, err
+	}
+
+	return ca.RootPEM(), nil
+}
+
+// decide allows on-demand issuance for names matching a configured domain. Names
+// listed in the config are managed anyway, the ones matched by a wildcard share the limiter
+func decide(ctx context.Context, name string) error {
+	cfg := config.DomainTrie.Match(name)
+	if cfg == nil {
+		return fmt.Errorf("%s is not configured", name)
+	}
+
+	if Certificate(name, cfg.Protocol) != nil {
+		return fmt.Errorf("%s has a self-managed certificate", name)
+	}
+
+	if slices.Contains(config.Domains, name) {
+		return nil
+	}
+
+	if !limiter.Allow() {
+		log.Warn().Str("name", name).Str("status", "rate limited").Msg("certs")
+		return fmt.Errorf("%s: on-demand rate limit exceeded", name)
+	}
+
+	log.Info().Str("name", name).Str("status", "on-demand").Msg("certs")
+	return nil
+}
+
+// Sync manages the certificates of the configured domains and releases those of
+// domains removed since the last call. The first call blocks until they are obtained.
+// Domains are only recorded once certmagic took them, certmagic retries the obtains that fail afterwards
+func Sync(ctx context.Context) error {
+	managedMu.Lock()
+	defer managedMu.Unlock()
+
+	domains := ManagedDomains(config.Domains)
+
+	var added []string
+	desired := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		desired[domain] = true
+		if !managed[domain] {
+			added = append(added, domain)
+		}
+	}
+
+	var removed []certmagic.SubjectIssuer
+	for domain := range managed {
+		if !desired[domain] {
+			removed = append(removed, certmagic.SubjectIssuer{Subject: domain})
+			delete(managed, domain)
+		}
+	}
+
+	if len(removed) > 0 && cache != nil {
+		cache.RemoveManaged(removed)
+		for _, subject := range removed {
+			log.Info().Str("domain", subject.Subject).Str("status", "released").Msg("certs")
+		}
+	}
+
+	if len(added) == 0 {
+		synced = true
+		return nil
+	}
+
+	log.Info().Strs("domains", added).Str("status", "managed").Msg("certs")
+
+	manage := Magic.ManageAsync
+	if !synced {
+		manage = Magic.ManageSync
+	}
+	synced = true
+
+	if err := manage(ctx, added); err != nil {
+		return err
+	}
+
+	for _, domain := range added {
+		managed[domain] = true
+	}
+
+	return nil
+}
+
+func challenge(c acme.Config) string {
+	switch {
+	case c.Challenge != "":
+		return c.Challenge
+	case c.DNS != nil:
+		return acme.DNS01
+	default:
+		return acme.HTTP01 + "," + acme.TLSALPN01
+	}
+}
+
+// TLSConfig returns the listener config for proto, an empty proto serves the domains
+// of every protocol. Certificates of the domain's tls section and the cert directory
+// take precedence over managed ones, and domains with a TLS policy, client auth or
+// ALPN routes get a config of their own.
+func TLSConfig(proto string, nextProtos ...string) *tls.Config {
+	base := Magic.TLSConfig()
+	base.NextProtos = append(nextProtos, base.NextProtos...)
+
+	managed := base.GetCertificate
+	base.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert := Certificate(hello.ServerName, proto); cert != nil && !tlspolicy.IsChallenge(hello) {
+			return cert, nil
+		}
+
+		return managed(hello)
+	}
+
+	base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		cfg := match(hello.ServerName, proto)
+		if cfg == nil || (cfg.TLSPolicy == nil && cfg.ClientVerifier == nil && len(cfg.ALPN) == 0) {
+			return nil, nil
+		}
+
+		tlsConfig := base.Clone()
+		if cfg.TLSPolicy != nil {
+			cfg.TLSPolicy.Apply(tlsConfig)
+		}
+
+		if len(cfg.ALPN) > 0 {
+			tlsConfig.NextProtos = alpn(cfg, tlsConfig.NextProtos)
+		}
+
+		if cfg.ClientVerifier != nil {
+			tlsConfig = cfg.ClientVerifier.TLSConfig(tlsConfig)
+		}
+
+		return tlsConfig, nil
+	}
+
+	return base
+}
+
+// alpn puts the protocols of the domain's ALPN routes ahead of nextProtos
+func alpn(cfg *types.Config, nextProtos []string) []string {
+	protos := make([]string, 0, len(cfg.ALPN)+len(nextProtos))
+	for proto := range cfg.ALPN {
+		protos = append(protos, proto)
+	}
+	sort.Strings(protos)
+
+	for _, proto := range nextProtos {
+		if _, ok := cfg.ALPN[proto]; !ok {
+			protos = append(protos, proto)
+		}
+	}
+
+	return protos
+}
+
+func match(name, proto string) *types.Config {
+	if proto == "" {
+		return config.DomainTrie.Match(name)
+	}
+
+	return config.DomainTrie.MatchWithProto(name, proto)
+}
+
+// Certificate returns the self-managed certificate for name, nil when it is left to ACME
+func Certificate(name, proto string) *tls.Certificate {
+	if cfg := match(name, proto); cfg != nil && cfg.TLSPolicy != nil {
+		if cert := cfg.TLSPolicy.Certificate(); cert != nil {
+			return cert
+		}
+	}
+
+	if store != nil {
+		return store.Get(name)
+	}
+
+	return nil
+}
+
+// ManagedDomains filters out the domains with a self-managed certificate and the
+// wildcards the challenge can't obtain, those are left to on-demand issuance
+func ManagedDomains(domains []string) []string {
+	managed := make([]string, 0, len(domains))
+
+	for _, domain := range domains {
+		if strings.HasPrefix(domain, "*.") && !wildcard {
+			continue
+		}
+
+		proto := ""
+		if cfg := config.DomainTrie.Match(domain); cfg != nil {
+			proto = cfg.Protocol
+		}
+
+		if Certificate(domain, proto) == nil {
+			managed = append(managed, domain)
+		}
+	}
+
+	return managed
+}
+
+// HTTPChallengeHandler answers http-01 challenges ahead of next
+func HTTPChallengeHandler(next http.Handler) http.Handler {
+	if issuer == nil {
+		return next
+	}
+
+	return issuer.HTTPChallengeHandler(next)
+}
@@ -0,0 +1,200 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/testcert"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/tlspolicy"
+	"github.com/caddyserver/certmagic"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func writeCert(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	return testcert.Write(t, dir, name, testcert.SelfSigned(t, name))
+}
+
+func policy(t *testing.T, c tlspolicy.Config) *tlspolicy.Policy {
+	t.Helper()
+
+	p, err := tlspolicy.New(c)
+	assert.NoError(t, err)
+	return p
+}
+
+func TestTLSConfig(t *testing.T) {
+	domainDir := t.TempDir()
+	staticCert, staticKey := writeCert(t, domainDir, "static.localhost")
+	strictCert, strictKey := writeCert(t, domainDir, "strict.localhost")
+
+	storeDir := t.TempDir()
+	writeCert(t, storeDir, "stored.localhost")
+
+	var err error
+	store, err = tlspolicy.NewStore(storeDir)
+	assert.NoError(t, err)
+	defer func() { store = nil }()
+
+	Magic = certmagic.NewDefault()
+
+	config.DomainTrie = types.NewDomainTrie()
+	config.DomainTrie.Insert("static.localhost", &types.Config{
+		Protocol:  types.HTTPProtocol,
+		TLSPolicy: policy(t, tlspolicy.Config{CertFile: staticCert, KeyFile: staticKey}),
+	})
+	config.DomainTrie.Insert("strict.localhost", &types.Config{
+		Protocol:  types.HTTPProtocol,
+		TLSPolicy: policy(t, tlspolicy.Config{CertFile: strictCert, KeyFile: strictKey, MinVersion: "1.3", ALPN: []string{"http/1.1"}}),
+	})
+	config.DomainTrie.Insert("stored.localhost", &types.Config{Protocol: types.HTTPProtocol})
+	config.DomainTrie.Insert("managed.localhost", &types.Config{Protocol: types.HTTPProtocol})
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", TLSConfig(types.HTTPProtocol, "h2", "http/1.1"))
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+
+	handshake := func(serverName string, maxVersion uint16) (tls.ConnectionState, error) {
+		conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+			MaxVersion:         maxVersion,
+			NextProtos:         []string{"h2", "http/1.1"},
+		})
+		if err != nil {
+			return tls.ConnectionState{}, err
+		}
+		defer conn.Close()
+
+		return conn.ConnectionState(), nil
+	}
+
+	t.Run("Domain certificate", func(t *testing.T) {
+		state, err := handshake("static.localhost", 0)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "static.localhost", state.PeerCertificates[0].Subject.CommonName)
+			assert.Equal(t, "h2", state.NegotiatedProtocol)
+		}
+	})
+
+	t.Run("Cert directory", func(t *testing.T) {
+		state, err := handshake("stored.localhost", 0)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "stored.localhost", state.PeerCertificates[0].Subject.CommonName)
+		}
+	})
+
+	t.Run("Policy", func(t *testing.T) {
+		_, err := handshake("strict.localhost", tls.VersionTLS12)
+		assert.Error(t, err)
+
+		state, err := handshake("strict.localhost", 0)
+		if assert.NoError(t, err) {
+			assert.Equal(t, uint16(tls.VersionTLS13), state.Version)
+			assert.Equal(t, "http/1.1", state.NegotiatedProtocol)
+		}
+	})
+
+	t.Run("Managed", func(t *testing.T) {
+		_, err := handshake("managed.localhost", 0)
+		assert.Error(t, err)
+	})
+
+	t.Run("ManagedDomains", func(t *testing.T) {
+		domains := []string{"static.localhost", "strict.localhost", "stored.localhost", "managed.localhost"}
+		assert.Equal(t, []string{"managed.localhost"}, ManagedDomains(domains))
+	})
+}
+
+func TestOnDemand(t *testing.T) {
+	dir := t.TempDir()
+	staticCert, staticKey := writeCert(t, dir, "static.localhost")
+
+	config.DomainTrie = types.NewDomainTrie()
+	config.DomainTrie.Insert("*.tcp.localhost", &types.Config{Protocol: types.TCPProtocol})
+	config.DomainTrie.Insert("app.localhost", &types.Config{Protocol: types.HTTPProtocol})
+	config.DomainTrie.Insert("static.localhost", &types.Config{
+		Protocol:  types.HTTPProtocol,
+		TLSPolicy: policy(t, tlspolicy.Config{CertFile: staticCert, KeyFile: staticKey}),
+	})
+	config.Domains = []string{"*.tcp.localhost", "app.localhost", "static.localhost"}
+
+	limiter = rate.NewLimiter(0, 1)
+	defer func() { limiter = nil }()
+
+	t.Run("Decision", func(t *testing.T) {
+		ctx := context.Background()
+
+		assert.Error(t, decide(ctx, "unknown.localhost"))
+		assert.Error(t, decide(ctx, "static.localhost"))
+
+		// configured names don't use up the limiter
+		assert.NoError(t, decide(ctx, "app.localhost"))
+		assert.NoError(t, decide(ctx, "app.localhost"))
+
+		assert.NoError(t, decide(ctx, "db.tcp.localhost"))
+		assert.Error(t, decide(ctx, "cache.tcp.localhost"))
+	})
+
+	t.Run("ManagedDomains", func(t *testing.T) {
+		defer func() { wildcard = false }()
+
+		assert.Equal(t, []string{"app.localhost"}, ManagedDomains(config.Domains))
+
+		wildcard = true
+		assert.Equal(t, []string{"*.tcp.localhost", "app.localhost"}, ManagedDomains(config.Domains))
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		cache = certmagic.NewCache(certmagic.CacheOptions{
+			GetConfigForCert: func(certmagic.Certificate) (*certmagic.Config, error) {
+				return Magic, nil
+			},
+		})
+		defer cache.Stop()
+
+		// with on-demand set, managing a name only allows it for the first handshake
+		Magic = certmagic.New(cache, certmagic.Config{
+			OnDemand: &certmagic.OnDemandConfig{DecisionFunc: decide},
+		})
+		defer func() {
+			managed = make(map[string]bool)
+			synced = false
+		}()
+
+		ctx := context.Background()
+
+		assert.NoError(t, Sync(ctx))
+		assert.Equal(t, map[string]bool{"app.localhost": true}, managed)
+
+		config.DomainTrie.Insert("api.localhost", &types.Config{Protocol: types.HTTPProtocol})
+		config.DomainTrie.Remove("app.localhost")
+		config.Domains = []string{"*.tcp.localhost", "api.localhost", "static.localhost"}
+
+		assert.NoError(t, Sync(ctx))
+		assert.Equal(t, map[string]bool{"api.localhost": true}, managed)
+
+		// certmagic keeps retrying failed obtains, the domain stays managed
+		onEvent(ctx, "cert_failed", map[string]any{"identifier": "api.localhost", "renewal": false})
+		assert.NoError(t, Sync(ctx))
+		assert.Equal(t, map[string]bool{"api.localhost": true}, managed)
+	})
+}
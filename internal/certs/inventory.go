@@ -0,0 +1,242 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/pkg/certinfo"
+	"github.com/rs/zerolog/log"
+)
+
+// certificate sources in the inventory
+const (
+	SourceACME    = "acme"
+	SourceLocal   = "local"
+	SourceFile    = "file"
+	SourceCertDir = "cert_dir"
+)
+
+// DefaultExpiryAlertDays is used when tls.expiry_alert_days is not set
+const DefaultExpiryAlertDays = 14
+
+const (
+	// refreshInterval is how often Monitor rebuilds the inventory
+	refreshInterval = time.Minute
+	// realertInterval is how long a certificate still expiring waits before it is reported again
+	realertInterval = 24 * time.Hour
+)
+
+var (
+	tracker = certinfo.NewTracker()
+
+	alertHooksMu sync.Mutex
+	alertHooks   []func(certinfo.Alert)
+
+	inventoryMu sync.RWMutex
+	inventory   []certinfo.Info
+
+	// alerted holds when each certificate fingerprint and reason pair was last reported
+	alertedMu sync.Mutex
+	alerted   = make(map[string]time.Time)
+)
+
+// OnAlert registers fn to run when a renewal fails, a certificate is revoked or about to expire
+func OnAlert(fn func(certinfo.Alert)) {
+	alertHooksMu.Lock()
+	defer alertHooksMu.Unlock()
+
+	alertHooks = append(alertHooks, fn)
+}
+
+func alert(a certinfo.Alert) {
+	log.Warn().Str("reason", a.Reason).Strs("names", a.Names).Str("error", a.Error).Msg("certs")
+
+	alertHooksMu.Lock()
+	hooks := alertHooks
+	alertHooksMu.Unlock()
+
+	for _, hook := range hooks {
+		hook(a)
+	}
+}
+
+// onEvent records the outcome of certmagic's obtain and renew attempts
+func onEvent(ctx context.Context, event string, data map[string]any) error {
+	switch event {
+	case "cert_obtained":
+		name, _ := data["identifier"].(string)
+		tracker.Record(name, nil)
+
+	case "cert_failed":
+		name, _ := data["identifier"].(string)
+		err, _ := data["error"].(error)
+		if err == nil {
+			err = errors.New("unknown error")
+		}
+		tracker.Record(name, err)
+
+		alert(certinfo.Alert{Reason: certinfo.ReasonRenewalFailed, Names: []string{name}, Error: err.Error()})
+
+	case "cert_ocsp_revoked":
+		names, _ := data["subjects"].([]string)
+		alert(certinfo.Alert{Reason: certinfo.ReasonRevoked, Names: names})
+	}
+
+	return nil
+}
+
+// Inventory lists the certificates served by the listeners, the ones expiring first at the top.
+// It returns the inventory last built by Refresh, building it if Refresh never ran
+func Inventory() []certinfo.Info {
+	inventoryMu.RLock()
+	cached := inventory
+	inventoryMu.RUnlock()
+
+	if cached == nil {
+		cached = Refresh()
+	}
+
+	infos := make([]certinfo.Info, len(cached))
+	copy(infos, cached)
+	for i := range infos {
+		tracker.Annotate(&infos[i])
+	}
+
+	return infos
+}
+
+// Refresh rebuilds the inventory and returns it
+func Refresh() []certinfo.Info {
+	infos := build()
+
+	inventoryMu.Lock()
+	inventory = infos
+	inventoryMu.Unlock()
+
+	return infos
+}
+
+func build() []certinfo.Info {
+	infos := make([]certinfo.Info, 0)
+	seen := make(map[*tls.Certificate]bool)
+	hashes := make(map[string]bool)
+
+	add := func(cert *tls.Certificate, source string) {
+		if cert == nil || seen[cert] {
+			return
+		}
+		seen[cert] = true
+
+		info, err := certinfo.New(cert, source)
+		if err != nil {
+			log.Error().Err(err).Msg("certs")
+			return
+		}
+		infos = append(infos, info)
+	}
+
+	managedSource := SourceACME
+	if localCA != nil {
+		managedSource = SourceLocal
+	}
+
+	names := append([]string{}, config.Domains...)
+	names = append(names, tracker.Names()...)
+
+	managedMu.Lock()
+	for name := range managed {
+		names = append(names, name)
+	}
+	managedMu.Unlock()
+
+	for _, name := range names {
+		if cfg := config.DomainTrie.Match(name); cfg != nil && cfg.TLSPolicy != nil {
+			add(cfg.TLSPolicy.Certificate(), SourceFile)
+		}
+
+		if cache == nil {
+			continue
+		}
+
+		for _, cert := range cache.AllMatchingCertificates(name) {
+			if hashes[cert.Hash()] {
+				continue
+			}
+			hashes[cert.Hash()] = true
+
+			tlsCert := cert.Certificate
+			add(&tlsCert, managedSource)
+		}
+	}
+
+	if store != nil {
+		for _, cert := range store.Certificates() {
+			add(cert, SourceCertDir)
+		}
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].NotAfter.Before(infos[j].NotAfter)
+	})
+
+	return infos
+}
+
+// CheckExpiry rebuilds the inventory and alerts on the certificates expiring within the given number of days.
+// A certificate already reported is reported again once realertInterval has passed
+func CheckExpiry(now time.Time, days int) {
+	within := time.Duration(days) * 24 * time.Hour
+
+	alertedMu.Lock()
+	defer alertedMu.Unlock()
+
+	expiring := make(map[string]bool)
+
+	for _, info := range Refresh() {
+		if !info.Expiring(now, within) {
+			continue
+		}
+
+		key := info.Fingerprint + "|" + certinfo.ReasonExpiring
+		expiring[key] = true
+
+		if last, ok := alerted[key]; ok && now.Sub(last) < realertInterval {
+			continue
+		}
+		alerted[key] = now
+
+		alert(certinfo.Alert{Reason: certinfo.ReasonExpiring, Names: info.Names, NotAfter: info.NotAfter})
+	}
+
+	for key := range alerted {
+		if !expiring[key] {
+			delete(alerted, key)
+		}
+	}
+}
+
+// Monitor rebuilds the inventory and checks it for expiring certificates every refreshInterval until ctx is done
+func Monitor(ctx context.Context) {
+	days := config.TLS.ExpiryAlertDays
+	if days == 0 {
+		days = DefaultExpiryAlertDays
+	}
+
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		CheckExpiry(time.Now(), days)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package certs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/certinfo"
+	"github.com/Dyastin-0/mrps/pkg/tlspolicy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInventory(t *testing.T) {
+	domainDir := t.TempDir()
+	staticCert, staticKey := writeCert(t, domainDir, "static.localhost")
+
+	storeDir := t.TempDir()
+	writeCert(t, storeDir, "stored.localhost")
+
+	var err error
+	store, err = tlspolicy.NewStore(storeDir)
+	assert.NoError(t, err)
+	defer func() { store = nil }()
+
+	config.DomainTrie = types.NewDomainTrie()
+	config.DomainTrie.Insert("static.localhost", &types.Config{
+		Protocol:  types.HTTPProtocol,
+		TLSPolicy: policy(t, tlspolicy.Config{CertFile: staticCert, KeyFile: staticKey}),
+	})
+	config.DomainTrie.Insert("stored.localhost", &types.Config{Protocol: types.HTTPProtocol})
+	config.Domains = []string{"static.localhost", "stored.localhost"}
+
+	var alerts []certinfo.Alert
+	alertHooks = nil
+	OnAlert(func(a certinfo.Alert) { alerts = append(alerts, a) })
+	defer func() { alertHooks = nil }()
+
+	t.Run("Sources", func(t *testing.T) {
+		infos := Refresh()
+		if assert.Len(t, infos, 2) {
+			sources := map[string]string{}
+			for _, info := range infos {
+				sources[info.Names[0]] = info.Source
+			}
+			assert.Equal(t, map[string]string{"static.localhost": SourceFile, "stored.localhost": SourceCertDir}, sources)
+		}
+	})
+
+	t.Run("Renewal failure", func(t *testing.T) {
+		alerts = nil
+
+		err := onEvent(context.Background(), "cert_failed", map[string]any{
+			"renewal":    true,
+			"identifier": "stored.localhost",
+			"error":      errors.New("challenge failed"),
+		})
+		assert.NoError(t, err)
+
+		if assert.Len(t, alerts, 1) {
+			assert.Equal(t, certinfo.ReasonRenewalFailed, alerts[0].Reason)
+			assert.Equal(t, []string{"stored.localhost"}, alerts[0].Names)
+		}
+
+		for _, info := range Inventory() {
+			if info.Names[0] == "stored.localhost" {
+				assert.NotNil(t, info.LastRenewal)
+				assert.Equal(t, "challenge failed", info.LastError)
+			}
+		}
+
+		assert.NoError(t, onEvent(context.Background(), "cert_obtained", map[string]any{"identifier": "stored.localhost"}))
+		attempt, _ := tracker.Get("stored.localhost")
+		assert.Empty(t, attempt.Error)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		alerts = nil
+
+		// the test certificates are valid for an hour
+		CheckExpiry(time.Now(), 0)
+		assert.Empty(t, alerts)
+
+		now := time.Now()
+		CheckExpiry(now, 1)
+		if assert.Len(t, alerts, 2) {
+			assert.Equal(t, certinfo.ReasonExpiring, alerts[0].Reason)
+		}
+
+		alerts = nil
+		CheckExpiry(now.Add(time.Hour), 1)
+		assert.Empty(t, alerts, "already reported")
+
+		CheckExpiry(now.Add(realertInterval), 1)
+		assert.Len(t, alerts, 2, "reported again a day later")
+	})
+
+	t.Run("Renewed", func(t *testing.T) {
+		alerts = nil
+		alerted = make(map[string]time.Time)
+
+		now := time.Now()
+		CheckExpiry(now, 1)
+		assert.Len(t, alerts, 2)
+
+		alerts = nil
+		writeCert(t, storeDir, "stored.localhost")
+		assert.NoError(t, store.Load())
+
+		CheckExpiry(now.Add(time.Hour), 1)
+		if assert.Len(t, alerts, 1, "new certificate") {
+			assert.Equal(t, []string{"stored.localhost"}, alerts[0].Names)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package clientauth
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/pkg/clientauth"
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
+)
+
+// Handler forwards the verified client identity of domains with client auth, the identity
+// headers sent by clients are dropped on every domain
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientauth.DelHeaders(r.Header)
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		cfg := config.DomainTrie.Match(host)
+		if cfg == nil || cfg.ClientVerifier == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.TLS == nil {
+			errorpage.Write(w, r, http.StatusForbidden, "client certificate required")
+			return
+		}
+
+		// HTTP/2 clients reuse connections across hosts, the handshake must have been for this domain
+		if sniConfig := config.DomainTrie.Match(r.TLS.ServerName); sniConfig == nil || sniConfig.ClientVerifier != cfg.ClientVerifier {
+			errorpage.Write(w, r, http.StatusMisdirectedRequest, "client certificate was not requested for this host")
+			return
+		}
+
+		cert := clientauth.Peer(r.TLS)
+		if cert == nil && cfg.ClientVerifier.Required() {
+			errorpage.Write(w, r, http.StatusForbidden, "client certificate required")
+			return
+		}
+
+		clientauth.SetHeaders(r.Header, cert)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Strip drops the identity headers sent by clients, for listeners that never verify certificates
+func Strip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientauth.DelHeaders(r.Header)
+		next.ServeHTTP(w, r)
+	})
+}
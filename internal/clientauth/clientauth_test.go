@@ -0,0 +1,93 @@
+package clientauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/testcert"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/clientauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	cert := testcert.SelfSigned(t, "client").Leaf
+	ca := testcert.WriteCert(t, t.TempDir(), "client", cert)
+
+	required, err := clientauth.New(clientauth.Config{CA: ca})
+	assert.NoError(t, err)
+
+	optional, err := clientauth.New(clientauth.Config{CA: ca, Mode: clientauth.ModeOptional})
+	assert.NoError(t, err)
+
+	config.DomainTrie = types.NewDomainTrie()
+	config.DomainTrie.Insert("secure.localhost", &types.Config{Protocol: types.HTTPProtocol, ClientVerifier: required})
+	config.DomainTrie.Insert("optional.localhost", &types.Config{Protocol: types.HTTPProtocol, ClientVerifier: optional})
+	config.DomainTrie.Insert("public.localhost", &types.Config{Protocol: types.HTTPProtocol})
+
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Verified", r.Header.Get(clientauth.HeaderVerified))
+		w.Header().Set("Subject", r.Header.Get(clientauth.HeaderSubject))
+	}))
+
+	verified := [][]*x509.Certificate{{cert}}
+
+	tests := []struct {
+		name        string
+		host        string
+		state       *tls.ConnectionState
+		wantStatus  int
+		wantSubject string
+		wantVerify  string
+	}{
+		{"Verified", "secure.localhost", &tls.ConnectionState{ServerName: "secure.localhost", VerifiedChains: verified}, http.StatusOK, "CN=client", "SUCCESS"},
+		{"Host with port", "secure.localhost:443", &tls.ConnectionState{ServerName: "secure.localhost", VerifiedChains: verified}, http.StatusOK, "CN=client", "SUCCESS"},
+		{"Plain HTTP", "secure.localhost", nil, http.StatusForbidden, "", ""},
+		{"Coalesced connection", "secure.localhost", &tls.ConnectionState{ServerName: "public.localhost"}, http.StatusMisdirectedRequest, "", ""},
+		{"Optional without certificate", "optional.localhost", &tls.ConnectionState{ServerName: "optional.localhost"}, http.StatusOK, "", "NONE"},
+		{"Forged on domain without client auth", "public.localhost", &tls.ConnectionState{ServerName: "public.localhost"}, http.StatusOK, "", ""},
+		{"Forged on unknown domain", "other.localhost", nil, http.StatusOK, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			req.TLS = tt.state
+			req.Header.Set(clientauth.HeaderSubject, "CN=spoofed")
+			req.Header.Set(clientauth.HeaderVerified, "SUCCESS")
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, tt.wantSubject, rec.Header().Get("Subject"))
+			assert.Equal(t, tt.wantVerify, rec.Header().Get("Verified"))
+		})
+	}
+}
+
+func TestStrip(t *testing.T) {
+	handler := Strip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, name := range []string{clientauth.HeaderVerified, clientauth.HeaderSubject, clientauth.HeaderSAN, clientauth.HeaderFingerprint, clientauth.HeaderCert} {
+			assert.Empty(t, r.Header.Values(name), name)
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(clientauth.HeaderVerified, "SUCCESS")
+	req.Header.Set(clientauth.HeaderSubject, "CN=spoofed")
+	req.Header.Set(clientauth.HeaderSAN, "spoofed")
+	req.Header.Set(clientauth.HeaderFingerprint, "00")
+	req.Header.Set(clientauth.HeaderCert, "spoofed")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
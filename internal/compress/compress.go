@@ -0,0 +1,27 @@
+package compress
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+)
+
+// Handler compresses responses with the domain's compressor,
+// domains without their own compression section use the global one
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressor := config.Compressor
+
+		if cfg := config.DomainTrie.Match(strings.ToLower(r.Host)); cfg != nil {
+			compressor = cfg.Compressor
+		}
+
+		if compressor == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		compressor.Serve(w, r, next)
+	})
+}
@@ -12,7 +12,21 @@ import (
 
 	"github.com/Dyastin-0/mrps/internal/loadbalancer"
 	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/cache"
+	"github.com/Dyastin-0/mrps/pkg/clientauth"
+	"github.com/Dyastin-0/mrps/pkg/compress"
+	"github.com/Dyastin-0/mrps/pkg/connlimit"
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
+	"github.com/Dyastin-0/mrps/pkg/forwarded"
+	"github.com/Dyastin-0/mrps/pkg/limitstore"
+	"github.com/Dyastin-0/mrps/pkg/ratekey"
+	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
+	"github.com/Dyastin-0/mrps/pkg/rewriter"
+	"github.com/Dyastin-0/mrps/pkg/static"
+	"github.com/Dyastin-0/mrps/pkg/timeout"
+	"github.com/Dyastin-0/mrps/pkg/tlspolicy"
 	"github.com/Dyastin-0/mrps/pkg/watcher"
+	"github.com/Dyastin-0/mrps/pkg/wsproxy"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v2"
 )
@@ -20,12 +34,51 @@ import (
 var (
 	Domains         []string
 	DomainTrie      *types.DomainTrieConfig
-	ClientMngr      = sync.Map{}
 	GlobalRateLimit types.RateLimitConfig
-	Misc            types.MiscConfig
-	StartTime       time.Time
+	// GlobalRateLimits are stacked on GlobalRateLimit, each with its own counters
+	GlobalRateLimits []types.RateLimitConfig
+	Misc             types.MiscConfig
+	StartTime        time.Time
+
+	GlobalErrorPages errorpage.Config
+	ErrorPages       *errorpage.Pages
+
+	ForwardedConfig forwarded.Config
+	Forwarded       *forwarded.Forwarded
+
+	CompressionConfig compress.Config
+	Compressor        *compress.Compressor
+
+	CacheConfig cache.Config
+	Cache       *cache.Cache
+
+	Timeouts timeout.Config
+
+	TLS types.TLSConfig
+
+	// Clients holds the rate limiter state of each client, it survives reloads
+	// that leave its config unchanged
+	ClientsConfig limitstore.Config
+	Clients, _    = limitstore.New(limitstore.Config{})
+
+	// Connections and the limiters of each domain survive reloads that leave
+	// their config unchanged, open connections release their slots on them
+	ConnectionsConfig connlimit.Config
+	Connections       *connlimit.Limiter
+	connLimiters      = make(map[string]*connlimit.Limiter)
+
+	reloadHooksMu sync.Mutex
+	reloadHooks   []func(ctx context.Context)
 )
 
+// OnReload registers fn to run after the config file is reloaded
+func OnReload(fn func(ctx context.Context)) {
+	reloadHooksMu.Lock()
+	defer reloadHooksMu.Unlock()
+
+	reloadHooks = append(reloadHooks, fn)
+}
+
 func Load(ctx context.Context, filename string) error {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -34,6 +87,7 @@ func Load(ctx context.Context, filename string) error {
 	defer file.Close()
 
 	DomainTrie = types.NewDomainTrie()
+	Domains = nil
 	configData := types.YAML{}
 
 	decoder := yaml.NewDecoder(file)
@@ -56,7 +110,63 @@ func Load(ctx context.Context, filename string) error {
 		Misc.HealthCheckInterval = 5000
 	}
 
+	if err := setRateLimits(&configData.RateLimit, configData.RateLimits); err != nil {
+		return fmt.Errorf("rate_limit: %v", err)
+	}
 	GlobalRateLimit = configData.RateLimit
+	GlobalRateLimits = configData.RateLimits
+
+	if configData.Clients != ClientsConfig {
+		Clients, err = limitstore.New(configData.Clients)
+		if err != nil {
+			return fmt.Errorf("rate_limit_clients: %v", err)
+		}
+		ClientsConfig = configData.Clients
+	}
+
+	ForwardedConfig = configData.Forwarded
+	Forwarded, err = forwarded.New(ForwardedConfig)
+	if err != nil {
+		return err
+	}
+
+	GlobalErrorPages = configData.ErrorPages
+	ErrorPages, err = errorpage.New(GlobalErrorPages)
+	if err != nil {
+		return err
+	}
+
+	CompressionConfig = configData.Compression
+	Compressor, err = compress.New(CompressionConfig)
+	if err != nil {
+		return err
+	}
+
+	CacheConfig = configData.Cache
+	Cache, err = cache.New(CacheConfig)
+	if err != nil {
+		return fmt.Errorf("cache: %v", err)
+	}
+
+	Timeouts = configData.Timeouts
+
+	if err := configData.TLS.Validate(); err != nil {
+		return fmt.Errorf("tls: %v", err)
+	}
+	if configData.TLS.ExpiryAlertDays < 0 {
+		return fmt.Errorf("tls: expiry_alert_days must not be negative")
+	}
+	TLS = configData.TLS
+
+	if configData.Connections != ConnectionsConfig {
+		Connections, err = connlimit.New(configData.Connections)
+		if err != nil {
+			return fmt.Errorf("connections: %v", err)
+		}
+		ConnectionsConfig = configData.Connections
+	}
+
+	limiters := make(map[string]*connlimit.Limiter)
 
 	for domain, cfg := range configData.Domains {
 		if !regexp.MustCompile(`^([a-zA-Z0-9\*]+(-[a-zA-Z0-9\*]+)*\.)+[a-zA-Z0-9]{2,}$`).MatchString(domain) {
@@ -73,24 +183,80 @@ func Load(ctx context.Context, filename string) error {
 			cfg.Protocol = types.HTTPProtocol
 		}
 
+		cfg.ResolvedTimeouts = resolveTimeouts(cfg.Timeouts, Timeouts)
+
 		cfg.SortedRoutes, err = sortRoutes(
 			ctx,
 			cfg.Routes,
 			cfg.Protocol,
 			domain,
+			cfg.ResolvedTimeouts,
 			time.Duration(Misc.HealthCheckInterval)*time.Millisecond,
 		)
 		if err != nil {
 			return err
 		}
 
+		if err := setALPNRoutes(ctx, &cfg, domain, time.Duration(Misc.HealthCheckInterval)*time.Millisecond); err != nil {
+			return err
+		}
+
 		cfg.RateLimit.DefaultCooldown = time.Second
+		if err := setRateLimits(&cfg.RateLimit, cfg.RateLimits); err != nil {
+			return fmt.Errorf("%s: rate_limit: %v", domain, err)
+		}
+
+		// always allocated so the API can toggle maintenance without touching the maps
+		if cfg.Maintenance == nil {
+			cfg.Maintenance = &types.Maintenance{}
+		}
+
+		cfg.Pages, err = errorpage.New(cfg.ErrorPages)
+		if err != nil {
+			return fmt.Errorf("%s: %v", domain, err)
+		}
+
+		// domains without a compression section inherit the global one
+		cfg.Compressor = Compressor
+		if cfg.Compression != nil {
+			cfg.Compressor, err = compress.New(*cfg.Compression)
+			if err != nil {
+				return fmt.Errorf("%s: %v", domain, err)
+			}
+		}
+
+		if cfg.ClientAuth != nil {
+			cfg.ClientVerifier, err = clientauth.New(*cfg.ClientAuth)
+			if err != nil {
+				return fmt.Errorf("%s: %v", domain, err)
+			}
+		}
+
+		if cfg.TLS != nil {
+			cfg.TLSPolicy, err = tlspolicy.New(*cfg.TLS)
+			if err != nil {
+				return fmt.Errorf("%s: tls: %v", domain, err)
+			}
+		}
+
+		if cfg.Connections != nil {
+			cfg.ConnLimiter = connLimiters[domain]
+			if cfg.ConnLimiter.Config() != *cfg.Connections {
+				cfg.ConnLimiter, err = connlimit.New(*cfg.Connections)
+				if err != nil {
+					return fmt.Errorf("%s: connections: %v", domain, err)
+				}
+			}
+			limiters[domain] = cfg.ConnLimiter
+		}
 
 		configData.Domains[domain] = cfg
 
 		DomainTrie.Insert(domain, &cfg)
 	}
 
+	connLimiters = limiters
+
 	return nil
 }
 
@@ -98,6 +264,7 @@ func sortRoutes(
 	ctx context.Context,
 	routes types.RouteConfig,
 	proto, domain string,
+	timeouts timeout.Config,
 	healthCheckInterval time.Duration,
 ) ([]string, error) {
 	sortedRoutes := make([]string, 0, len(routes))
@@ -107,14 +274,31 @@ func sortRoutes(
 			return nil, fmt.Errorf("invalid path: %s", path)
 		}
 
+		if config.Cache != nil && config.Cache.Enabled && proto != types.HTTPProtocol {
+			return nil, fmt.Errorf("cache requires the http protocol: %s%s", domain, path)
+		}
+
+		config.ResolvedTimeouts = resolveTimeouts(config.Timeouts, timeouts)
+
+		if err := setRateLimits(config.RateLimit, config.RateLimits); err != nil {
+			return nil, fmt.Errorf("%s%s: rate_limit: %v", domain, path, err)
+		}
+
 		// doing it here so i don't loop over routes twice
-		setBalancer(ctx,
+		err := setBalancer(ctx,
 			&config,
 			proto,
 			domain,
 			path,
 			healthCheckInterval,
 		)
+		if err != nil {
+			return nil, err
+		}
+
+		if config.Maintenance == nil {
+			config.Maintenance = &types.Maintenance{}
+		}
 
 		routes[path] = config
 		sortedRoutes = append(sortedRoutes, path)
@@ -134,13 +318,161 @@ func sortRoutes(
 	return sortedRoutes, nil
 }
 
+// setRateLimits checks limit and the limits stacked on it and parses their keys, limit may be nil
+func setRateLimits(limit *types.RateLimitConfig, stacked []types.RateLimitConfig) error {
+	if limit != nil {
+		if err := setRateLimit(limit); err != nil {
+			return err
+		}
+	}
+
+	for i := range stacked {
+		if err := setRateLimit(&stacked[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setRateLimit(limit *types.RateLimitConfig) error {
+	if err := limit.Limit().Validate(); err != nil {
+		return err
+	}
+	if err := ratekey.ValidateMissing(limit.OnMissing); err != nil {
+		return err
+	}
+
+	var err error
+	limit.Keyer, err = ratekey.Parse(limit.Key)
+	return err
+}
+
+// setALPNRoutes builds the TCP routes selected by the protocol negotiated with ALPN
+func setALPNRoutes(ctx context.Context, cfg *types.Config, domain string, healthCheckInterval time.Duration) error {
+	for proto, route := range cfg.ALPN {
+		switch {
+		case proto == "" || len(proto) > 255:
+			return fmt.Errorf("%s: invalid alpn protocol: %q", domain, proto)
+		case proto == "acme-tls/1":
+			return fmt.Errorf("%s: alpn protocol %s is reserved for certificates", domain, proto)
+		case cfg.Protocol == types.HTTPProtocol && (proto == "h2" || proto == "http/1.1"):
+			return fmt.Errorf("%s: alpn protocol %s is served by the http routes", domain, proto)
+		}
+
+		route.ResolvedTimeouts = resolveTimeouts(route.Timeouts, cfg.ResolvedTimeouts)
+
+		if err := setRateLimits(route.RateLimit, route.RateLimits); err != nil {
+			return fmt.Errorf("%s: alpn %s: rate_limit: %v", domain, proto, err)
+		}
+
+		err := setBalancer(ctx, &route, types.TCPProtocol, domain, " alpn "+proto, healthCheckInterval)
+		if err != nil {
+			return err
+		}
+
+		cfg.ALPN[proto] = route
+	}
+
+	return nil
+}
+
+// resolveTimeouts merges the timeouts of a domain or route with the enclosing section
+func resolveTimeouts(timeouts *timeout.Config, parent timeout.Config) timeout.Config {
+	if timeouts == nil {
+		return parent
+	}
+
+	return timeouts.Merge(parent)
+}
+
+// flushInterval converts the route setting in milliseconds, negative values flush immediately
+func flushInterval(ms int64) time.Duration {
+	if ms < 0 {
+		return -1
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
+
+// setDestTLS loads the upstream TLS settings of dest, the server name defaults to the one set on dest
+func setDestTLS(dest *types.Dest) error {
+	if dest.TLS == nil && dest.ServerName == "" {
+		return nil
+	}
+
+	tlsSettings := reverseproxy.TLSConfig{}
+	if dest.TLS != nil {
+		tlsSettings = *dest.TLS
+	}
+
+	if tlsSettings.ServerName == "" {
+		tlsSettings.ServerName = dest.ServerName
+	}
+
+	tlsConfig, err := tlsSettings.Build()
+	if err != nil {
+		return fmt.Errorf("%s: %v", dest.URL, err)
+	}
+
+	dest.TLSClientConfig = tlsConfig
+	return nil
+}
+
 func setBalancer(ctx context.Context, config *types.PathConfig, proto, domain, path string, healthCheckInterval time.Duration) error {
+	if config.Static != nil {
+		if config.Type == types.GRPCRoute {
+			return fmt.Errorf("grpc routes cannot be static: %s%s", domain, path)
+		}
+
+		return setStatic(config, proto, domain, path)
+	}
+
+	switch config.Type {
+	case "", types.HTTPRoute:
+	case types.GRPCRoute, types.WebSocketRoute:
+		if proto != types.HTTPProtocol {
+			return fmt.Errorf("%s routes are only supported for http: %s%s", config.Type, domain, path)
+		}
+	default:
+		return fmt.Errorf("unsupported route type %s: %s%s", config.Type, domain, path)
+	}
+
+	if config.WebSocket != nil && config.Type == types.GRPCRoute {
+		return fmt.Errorf("grpc routes cannot have websocket settings: %s%s", domain, path)
+	}
+
 	switch proto {
 	case types.HTTPProtocol:
+		grpc := config.Type == types.GRPCRoute
+
+		for i := range config.Dests {
+			if config.Dests[i].TLS != nil && !strings.HasPrefix(config.Dests[i].URL, "https://") {
+				return fmt.Errorf("%s%s: tls settings require an https url: %s", domain, path, config.Dests[i].URL)
+			}
+
+			if err := setDestTLS(&config.Dests[i]); err != nil {
+				return fmt.Errorf("%s%s: %v", domain, path, err)
+			}
+
+			if err := config.Dests[i].Upstream().Validate(grpc); err != nil {
+				return fmt.Errorf("%s%s: %v", domain, path, err)
+			}
+		}
+
 		balancer, err := loadbalancer.New(
 			ctx,
 			config.Dests,
-			config.RewriteRule,
+			reverseproxy.Config{
+				Route:            path,
+				RewriteRule:      config.RewriteRule,
+				Headers:          config.Headers,
+				Forwarded:        Forwarded,
+				GRPC:             grpc,
+				FlushInterval:    flushInterval(config.FlushInterval),
+				ConnectTimeout:   timeout.Duration(config.ResolvedTimeouts.Connect),
+				FirstByteTimeout: timeout.Duration(config.ResolvedTimeouts.FirstByte),
+			},
 			proto,
 			config.BalancerType,
 			path,
@@ -153,11 +485,35 @@ func setBalancer(ctx context.Context, config *types.PathConfig, proto, domain, p
 
 		config.Balancer = balancer
 
+		// every route that can upgrade gets a proxy, so its connections are counted even without limits
+		if !grpc {
+			wsConfig := wsproxy.Config{}
+			if config.WebSocket != nil {
+				wsConfig = *config.WebSocket
+			}
+
+			config.WSProxy, err = wsproxy.New(wsConfig)
+			if err != nil {
+				return fmt.Errorf("%s%s: %v", domain, path, err)
+			}
+		}
+
 	case types.TCPProtocol:
+		for i := range config.Dests {
+			if config.Dests[i].TLS != nil && !config.Dests[i].WithTLS {
+				return fmt.Errorf("%s%s: tls settings require with_tls: %s", domain, path, config.Dests[i].URL)
+			}
+
+			if err := setDestTLS(&config.Dests[i]); err != nil {
+				return fmt.Errorf("%s%s: %v", domain, path, err)
+			}
+		}
+
 		balancer, err := loadbalancer.NewTCP(
 			config.BalancerType,
 			ctx,
 			config.Dests,
+			config.ResolvedTimeouts,
 			healthCheckInterval,
 		)
 		if err != nil {
@@ -170,11 +526,40 @@ func setBalancer(ctx context.Context, config *types.PathConfig, proto, domain, p
 	return nil
 }
 
+func setStatic(config *types.PathConfig, proto, domain, path string) error {
+	if proto != types.HTTPProtocol {
+		return fmt.Errorf("static routes are only supported for http: %s%s", domain, path)
+	}
+
+	if len(config.Dests) > 0 {
+		return fmt.Errorf("route cannot have both dests and static: %s%s", domain, path)
+	}
+
+	handler, err := static.New(*config.Static)
+	if err != nil {
+		return fmt.Errorf("%s%s: %v", domain, path, err)
+	}
+
+	config.StaticHandler = rewriter.New(config.RewriteRule).Handler(handler)
+
+	log.Info().Str("path", path).Str("root", config.Static.Root).Str("status", "initialized").Msg("static")
+	return nil
+}
+
 func ParseToYAML() {
 	config := types.YAML{
-		Domains:   DomainTrie.GetAll(),
-		Misc:      Misc,
-		RateLimit: GlobalRateLimit,
+		Domains:     DomainTrie.GetAll(),
+		Misc:        Misc,
+		RateLimit:   GlobalRateLimit,
+		RateLimits:  GlobalRateLimits,
+		Clients:     ClientsConfig,
+		ErrorPages:  GlobalErrorPages,
+		Forwarded:   ForwardedConfig,
+		Compression: CompressionConfig,
+		Cache:       CacheConfig,
+		Timeouts:    Timeouts,
+		TLS:         TLS,
+		Connections: ConnectionsConfig,
 	}
 
 	data, err := yaml.Marshal(&config)
@@ -195,6 +580,14 @@ func Watch(ctx context.Context, path string) {
 			log.Error().Err(fmt.Errorf("failed to reload")).Msg("config")
 		} else {
 			log.Info().Str("status", "reloaded").Str("path", path).Msg("config")
+
+			reloadHooksMu.Lock()
+			hooks := reloadHooks
+			reloadHooksMu.Unlock()
+
+			for _, hook := range hooks {
+				hook(ctx)
+			}
 		}
 	})
 }
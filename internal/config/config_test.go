@@ -2,7 +2,9 @@ package config
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -317,6 +319,65 @@ rate_limit:
 	})
 }
 
+func TestLoadConnections(t *testing.T) {
+	write := func(max int) string {
+		file := filepath.Join(t.TempDir(), "mrps.yaml")
+		data := fmt.Sprintf(`
+domains:
+  db.localhost:
+    enabled: true
+    protocol: tcp
+    routes:
+      /:
+        dests:
+        - url: localhost:5432
+    connections:
+      max: %d
+connections:
+  max: %d
+`, max, max)
+		if err := os.WriteFile(file, []byte(data), 0o600); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		return file
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := Load(ctx, write(2)); err != nil {
+		t.Fatalf("config.Load() failed: %v", err)
+	}
+
+	global, domain := Connections, DomainTrie.Match("db.localhost").ConnLimiter
+	if _, err := global.Acquire("10.0.0.1"); err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+	if _, err := domain.Acquire("10.0.0.1"); err != nil {
+		t.Fatalf("Acquire() failed: %v", err)
+	}
+
+	t.Run("Unchanged", func(t *testing.T) {
+		if err := Load(ctx, write(2)); err != nil {
+			t.Fatalf("config.Load() failed: %v", err)
+		}
+
+		assertEqual(t, Connections, global, "Global limiter")
+		assertEqual(t, DomainTrie.Match("db.localhost").ConnLimiter, domain, "Domain limiter")
+		assertEqual(t, Connections.Active(), 1, "Global connections")
+		assertEqual(t, DomainTrie.Match("db.localhost").ConnLimiter.Active(), 1, "Domain connections")
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		if err := Load(ctx, write(3)); err != nil {
+			t.Fatalf("config.Load() failed: %v", err)
+		}
+
+		assertEqual(t, Connections.Config().Max, 3, "Global max")
+		assertEqual(t, DomainTrie.Match("db.localhost").ConnLimiter.Config().Max, 3, "Domain max")
+	})
+}
+
 func assertEqual(t *testing.T, got, want interface{}, name string) {
 	t.Helper()
 	if got != want {
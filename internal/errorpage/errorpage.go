@@ -0,0 +1,32 @@
+package errorpage
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
+)
+
+// Handler attaches the domain and global error pages to the request,
+// the domain's pages take precedence
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages := make([]*errorpage.Pages, 0, 2)
+
+		if cfg := config.DomainTrie.Match(strings.ToLower(r.Host)); cfg != nil && cfg.Pages != nil {
+			pages = append(pages, cfg.Pages)
+		}
+
+		if config.ErrorPages != nil {
+			pages = append(pages, config.ErrorPages)
+		}
+
+		if len(pages) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(errorpage.WithPages(r.Context(), pages...)))
+	})
+}
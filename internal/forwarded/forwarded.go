@@ -0,0 +1,16 @@
+package forwarded
+
+import (
+	"net/http"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/pkg/forwarded"
+)
+
+// Handler resolves the client IP once so the limiters and the proxy agree on it
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := config.Forwarded.Resolve(r)
+		next.ServeHTTP(w, r.WithContext(forwarded.WithClientIP(r.Context(), ip)))
+	})
+}
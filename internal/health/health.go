@@ -6,8 +6,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Dyastin-0/mrps/internal/certs"
 	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/types"
 	"github.com/Dyastin-0/mrps/internal/ws"
+	"github.com/Dyastin-0/mrps/pkg/certinfo"
+	"github.com/Dyastin-0/mrps/pkg/wsproxy"
 	"github.com/rs/zerolog/log"
 )
 
@@ -16,6 +20,8 @@ var Subscribers = sync.Map{}
 func InitBroadcaster(ctx context.Context) {
 	log.Info().Str("status", "running").Msg("health")
 
+	certs.OnAlert(broadcastCertificateAlert)
+
 	ticker := time.NewTicker(time.Duration(config.Misc.HealthCheckInterval) * time.Millisecond)
 
 	go func() {
@@ -27,6 +33,8 @@ func InitBroadcaster(ctx context.Context) {
 				return
 			case <-ticker.C:
 				broadcastHealthData()
+				broadcastMaintenanceData()
+				broadcastWebSocketData()
 			}
 		}
 	}()
@@ -55,3 +63,59 @@ func broadcastHealthData() {
 		return true
 	})
 }
+
+// broadcast sends v as JSON to every subscriber
+func broadcast(v any) {
+	dataBytes, err := json.Marshal(v)
+	if err != nil {
+		log.Error().Err(err).Msg("health")
+		return
+	}
+
+	Subscribers.Range(func(key, value interface{}) bool {
+		token := key.(string)
+		go func() {
+			ws.Clients.Send(token, dataBytes)
+		}()
+		return true
+	})
+}
+
+// broadcastMaintenanceData runs on the health tick so scheduled windows show up as they start and end
+func broadcastMaintenanceData() {
+	data := struct {
+		Type        string                             `json:"type"`
+		Maintenance map[string]types.MaintenanceStatus `json:"maintenance"`
+	}{
+		Type:        "maintenance",
+		Maintenance: config.DomainTrie.GetMaintenance(),
+	}
+
+	broadcast(data)
+}
+
+// broadcastWebSocketData sends the proxied WebSocket counters of each domain
+func broadcastWebSocketData() {
+	data := struct {
+		Type      string                   `json:"type"`
+		WebSocket map[string]wsproxy.Stats `json:"websocket"`
+	}{
+		Type:      "websocket",
+		WebSocket: config.DomainTrie.GetWebSockets(),
+	}
+
+	broadcast(data)
+}
+
+// broadcastCertificateAlert is sent as soon as a certificate needs attention, not on the tick
+func broadcastCertificateAlert(alert certinfo.Alert) {
+	data := struct {
+		Type  string         `json:"type"`
+		Alert certinfo.Alert `json:"alert"`
+	}{
+		Type:  "certificate",
+		Alert: alert,
+	}
+
+	broadcast(data)
+}
@@ -3,6 +3,7 @@ package hijack
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 )
@@ -32,6 +33,40 @@ func (rw *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return hj.Hijack()
 }
 
+// Flush sends buffered data to the client, server-sent events and chunked streams stall without it
+func (rw *ResponseWriter) Flush() {
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// ReadFrom keeps the sendfile and splice paths of the underlying writer available
+func (rw *ResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if rf, ok := rw.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+
+	return io.Copy(writerOnly{rw.ResponseWriter}, src)
+}
+
+// CloseNotify is kept for handlers that predate request contexts
+func (rw *ResponseWriter) CloseNotify() <-chan bool {
+	if cn, ok := rw.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+
+	// never fires, like a client that stays connected
+	return make(chan bool)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *ResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// writerOnly hides ReadFrom so io.Copy does not call back into it
+type writerOnly struct {
+	io.Writer
+}
+
 func StatusCode(handler http.Handler, w http.ResponseWriter, r *http.Request) int {
 	rec := NewResponseWriter(w)
 	handler.ServeHTTP(rec, r)
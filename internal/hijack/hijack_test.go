@@ -0,0 +1,33 @@
+package hijack
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+
+	// stacked the way the logger, metrics and balancers wrap it
+	rw := NewResponseWriter(NewResponseWriter(rec))
+
+	flusher, ok := interface{}(rw).(http.Flusher)
+	assert.True(t, ok)
+
+	rw.WriteHeader(http.StatusAccepted)
+	flusher.Flush()
+	assert.True(t, rec.Flushed)
+
+	n, err := rw.ReadFrom(strings.NewReader("streamed"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), n)
+	assert.Equal(t, "streamed", rec.Body.String())
+
+	assert.Equal(t, http.StatusAccepted, rw.StatusCode)
+	assert.NotNil(t, rw.CloseNotify())
+	assert.Same(t, rec, rw.Unwrap().(*ResponseWriter).Unwrap())
+}
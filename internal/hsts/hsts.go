@@ -0,0 +1,31 @@
+package hsts
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+)
+
+// Handler sends the Strict-Transport-Security header of the domain's TLS policy on HTTPS responses
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if cfg := config.DomainTrie.Match(host); cfg != nil && cfg.TLSPolicy != nil {
+			if value := cfg.TLSPolicy.HSTS(); value != "" {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package hsts
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/tlspolicy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	policy, err := tlspolicy.New(tlspolicy.Config{HSTS: &tlspolicy.HSTS{MaxAge: 600, IncludeSubdomains: true}})
+	assert.NoError(t, err)
+
+	config.DomainTrie = types.NewDomainTrie()
+	config.DomainTrie.Insert("secure.localhost", &types.Config{TLSPolicy: policy})
+	config.DomainTrie.Insert("plain.localhost", &types.Config{})
+
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name string
+		host string
+		tls  bool
+		want string
+	}{
+		{"HTTPS", "secure.localhost", true, "max-age=600; includeSubDomains"},
+		{"HTTPS with port", "secure.localhost:443", true, "max-age=600; includeSubDomains"},
+		{"Plain HTTP", "secure.localhost", false, ""},
+		{"Without policy", "plain.localhost", true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.want, rec.Header().Get("Strict-Transport-Security"))
+		})
+	}
+}
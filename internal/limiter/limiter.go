@@ -1,63 +1,139 @@
 package limiter
 
 import (
-	"net"
+	"context"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Dyastin-0/mrps/internal/config"
 	"github.com/Dyastin-0/mrps/internal/types"
-	"golang.org/x/time/rate"
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
+	"github.com/Dyastin-0/mrps/pkg/forwarded"
+	"github.com/Dyastin-0/mrps/pkg/limitstore"
+	"github.com/Dyastin-0/mrps/pkg/ratekey"
 )
 
 func Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if config.GlobalRateLimit.Burst == 0 || config.GlobalRateLimit.Rate == 0 {
-			next.ServeHTTP(w, r)
+		res, ok := Request(r, "global", config.GlobalRateLimit, config.GlobalRateLimits)
+		if !ok {
+			Refuse(w, r, res)
 			return
 		}
 
-		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		WriteHeaders(w.Header(), res)
+		next.ServeHTTP(w, r)
+	})
+}
 
-		key := "global:" + ip
-		value, exists := config.ClientMngr.Load(key)
-		var client *types.ClientLimiter
+// Request checks r against limit and the limits stacked on it, each one counts in its own
+// buckets keyed by scope and the value of its key. Requests missing a value a key references
+// are handled as the limit's OnMissing says. The result is the refusal or the limit closest
+// to exhaustion
+func Request(r *http.Request, scope string, limit types.RateLimitConfig, stacked []types.RateLimitConfig) (limitstore.Result, bool) {
+	return check(scope, forwarded.ClientIP(r), limit, stacked, func(k ratekey.Key) (string, bool) {
+		return k.Eval(r)
+	})
+}
 
-		if !exists {
-			client = &types.ClientLimiter{
-				Limiter:  rate.NewLimiter(config.GlobalRateLimit.Rate, config.GlobalRateLimit.Burst),
-				LastReq:  time.Now(),
-				Cooldown: time.Now(),
-			}
-			config.ClientMngr.Store(key, client)
-		} else {
-			client = value.(*types.ClientLimiter)
+// Conn checks a connection from ip like Request, the values of keys referencing more
+// than the client IP are always missing
+func Conn(ip, scope string, limit types.RateLimitConfig, stacked []types.RateLimitConfig) (limitstore.Result, bool) {
+	return check(scope, ip, limit, stacked, func(k ratekey.Key) (string, bool) {
+		return k.EvalClientIP(ip)
+	})
+}
+
+func check(scope, ip string, limit types.RateLimitConfig, stacked []types.RateLimitConfig, eval func(ratekey.Key) (string, bool)) (limitstore.Result, bool) {
+	result := limitstore.Result{Allowed: true}
+
+	for i := -1; i < len(stacked); i++ {
+		prefix := scope
+		if i >= 0 {
+			limit = stacked[i]
+			prefix = scope + "#" + strconv.Itoa(i)
 		}
 
-		if time.Now().Before(client.Cooldown) {
-			w.Header().Set("Retry-After", client.Cooldown.Format(time.RFC1123))
-			http.Error(w, "too many requests 💔⏳", http.StatusTooManyRequests)
-			return
+		if !limit.Enabled() {
+			continue
 		}
 
-		if !client.Limiter.Allow() {
-			cooldownDuration := config.GlobalRateLimit.Cooldown
-			if cooldownDuration == 0 {
-				cooldownDuration = 60000
+		key, ok := eval(limit.Keyer)
+		if !ok {
+			switch limit.OnMissing {
+			case ratekey.MissingSkip:
+				continue
+			case ratekey.MissingRefuse:
+				return limitstore.Result{Limit: limit.Burst}, false
+			default:
+				// kept apart from keys that happen to equal an IP
+				prefix += "!ip"
+				key = ip
 			}
+		}
 
-			client.Cooldown = time.Now().Add(time.Duration(cooldownDuration) * time.Millisecond)
-
-			config.ClientMngr.Store(key, client)
+		res := Allow(prefix+":"+key, limit)
+		if !res.Allowed {
+			return res, false
+		}
 
-			w.Header().Set("Retry-After", client.Cooldown.Format(time.RFC1123))
-			http.Error(w, "too many requests 💔", http.StatusTooManyRequests)
-			return
+		if result.Limit == 0 || res.Remaining < result.Remaining {
+			result = res
 		}
+	}
+
+	return result, true
+}
 
-		client.LastReq = time.Now()
-		config.ClientMngr.Store(key, client)
+// Allow counts a request or connection against the client stored under key, HTTP requests
+// and TCP connections share it. Disabled limits always allow
+func Allow(key string, limit types.RateLimitConfig) limitstore.Result {
+	if !limit.Enabled() {
+		return limitstore.Result{Allowed: true}
+	}
 
-		next.ServeHTTP(w, r)
-	})
+	return config.Clients.Take(key, limit.Limit())
+}
+
+// WriteHeaders sets the RateLimit headers from res, unless a limit closer to exhaustion set
+// them already. Results of disabled limits are ignored
+func WriteHeaders(h http.Header, res limitstore.Result) {
+	if res.Limit == 0 {
+		return
+	}
+
+	if current, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil && current <= res.Remaining && res.Allowed {
+		return
+	}
+
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+}
+
+// Refuse answers a request refused with res
+func Refuse(w http.ResponseWriter, r *http.Request, res limitstore.Result) {
+	WriteHeaders(w.Header(), res)
+	w.Header().Set("Retry-After", strconv.FormatInt(max(ceilSeconds(res.RetryAfter), 1), 10))
+	errorpage.Write(w, r, http.StatusTooManyRequests, "too many requests")
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
+// Sweep evicts idle clients from the store every interval until ctx is done
+func Sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			config.Clients.Sweep()
+		}
+	}
 }
@@ -9,6 +9,8 @@ import (
 	"github.com/Dyastin-0/mrps/internal/config"
 	"github.com/Dyastin-0/mrps/internal/limiter"
 	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/limitstore"
+	"github.com/Dyastin-0/mrps/pkg/ratekey"
 )
 
 func TestPerClientRateLimiter(t *testing.T) {
@@ -103,3 +105,88 @@ func TestPerClientRateLimiter(t *testing.T) {
 		time.Sleep(2 * time.Second)
 	}
 }
+
+func TestStackedLimits(t *testing.T) {
+	perIP, _ := ratekey.Parse("")
+	perKey, _ := ratekey.Parse("{header.X-Api-Key}")
+
+	limit := types.RateLimitConfig{Burst: 3, Rate: 0.001, Cooldown: 60000, Keyer: perIP}
+	stacked := func(onMissing string) []types.RateLimitConfig {
+		return []types.RateLimitConfig{{Burst: 2, Rate: 0.001, Cooldown: 60000, Keyer: perKey, OnMissing: onMissing}}
+	}
+
+	request := func(ip, apiKey string, stacked []types.RateLimitConfig) bool {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		if apiKey != "" {
+			r.Header.Set("X-Api-Key", apiKey)
+		}
+
+		_, ok := limiter.Request(r, "stacked", limit, stacked)
+		return ok
+	}
+
+	type step struct {
+		ip     string
+		apiKey string
+		want   bool
+	}
+
+	tests := []struct {
+		name      string
+		onMissing string
+		steps     []step
+	}{
+		{"Keyed", "", []step{
+			{"10.0.0.1", "a", true},
+			// same key from another IP
+			{"10.0.0.2", "a", true},
+			{"10.0.0.3", "a", false},
+			{"10.0.0.3", "b", true},
+		}},
+		{"Missing key counts by IP", "", []step{
+			{"10.0.0.4", "", true},
+			{"10.0.0.4", "", true},
+			{"10.0.0.4", "", false},
+			// keyed buckets are separate
+			{"10.0.0.8", "10.0.0.4", true},
+		}},
+		{"Missing key skipped", ratekey.MissingSkip, []step{
+			{"10.0.0.5", "", true},
+			{"10.0.0.5", "", true},
+			{"10.0.0.5", "", true},
+			// only the IP limit applies
+			{"10.0.0.5", "", false},
+		}},
+		{"Missing key refused", ratekey.MissingRefuse, []step{
+			{"10.0.0.6", "", false},
+			{"10.0.0.6", "c", true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Clients, _ = limitstore.New(limitstore.Config{})
+
+			for i, step := range tt.steps {
+				if got := request(step.ip, step.apiKey, stacked(tt.onMissing)); got != step.want {
+					t.Errorf("Request %d (%s, %q) = %v; want %v", i+1, step.ip, step.apiKey, got, step.want)
+				}
+			}
+		})
+	}
+
+	t.Run("Connections", func(t *testing.T) {
+		config.Clients, _ = limitstore.New(limitstore.Config{})
+
+		// connections never carry the API key, they fall back to the IP
+		for i := 0; i < 2; i++ {
+			if _, ok := limiter.Conn("10.0.0.7", "stacked", limit, stacked("")); !ok {
+				t.Fatalf("connection %d refused", i+1)
+			}
+		}
+		if _, ok := limiter.Conn("10.0.0.7", "stacked", limit, stacked("")); ok {
+			t.Errorf("connection over the fallback limit allowed")
+		}
+	})
+}
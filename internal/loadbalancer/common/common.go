@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Dyastin-0/mrps/internal/hijack"
+	"github.com/Dyastin-0/mrps/pkg/grpc"
 	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
 	"github.com/rs/zerolog/log"
 )
@@ -17,10 +19,65 @@ type Dest struct {
 	CurrentWeight int
 	Proxy         http.Handler           `yaml:"-" json:"-"`
 	ProxyTCP      *reverseproxy.TCPProxy `yaml:"-" json:"-"`
+
+	grpc      bool
+	transport *reverseproxy.Transport
 }
 
-var httpClient *http.Client = &http.Client{
-	Timeout: 500 * time.Millisecond,
+// NewDest creates a destination proxying to upstream, gRPC routes are health checked with the gRPC health service
+func NewDest(upstream reverseproxy.Upstream, proxyConfig reverseproxy.Config) *Dest {
+	transport := reverseproxy.NewTransport(upstream, proxyConfig)
+
+	return &Dest{
+		URL:       upstream.URL,
+		Proxy:     reverseproxy.NewWithTransport(upstream, proxyConfig, transport),
+		grpc:      proxyConfig.GRPC,
+		transport: transport,
+	}
+}
+
+// Serve proxies r to the destination and returns the response status, retry reports
+// whether the request may be sent to another destination. With canRetry, gRPC calls
+// rejected as unavailable are held back instead of reaching the client.
+func (d *Dest) Serve(w http.ResponseWriter, r *http.Request, canRetry bool) (statusCode int, retry bool) {
+	if !grpc.IsGRPC(r) {
+		statusCode = hijack.StatusCode(d.Proxy, w, r)
+		return statusCode, statusCode >= 500
+	}
+
+	// retries get the same request back, its body is already replayable then
+	replay, ok := grpc.ReplayOf(r.Body)
+	if !ok {
+		replay = grpc.NewReplay(r.Body)
+	}
+
+	if body, ok := replay.Body(); ok {
+		r.Body = body
+	} else {
+		canRetry = false
+	}
+
+	gw := grpc.NewWriter(w, canRetry)
+	d.Proxy.ServeHTTP(gw, r)
+
+	if gw.Held() {
+		if _, ok := replay.Body(); ok {
+			return http.StatusServiceUnavailable, true
+		}
+		gw.Release()
+	}
+
+	code, ok := gw.Code()
+	if !ok {
+		return http.StatusOK, false
+	}
+
+	return code.HTTPStatus(), false
+}
+
+// PoolStats returns the connection counters of the destination's transport
+func (d *Dest) PoolStats() reverseproxy.PoolStats {
+	return d.transport.Stats()
 }
 
 func (d *Dest) Check(ctx context.Context, host string, delay time.Duration) {
@@ -70,6 +127,20 @@ func (d *Dest) pingTCP(host string) {
 }
 
 func (d *Dest) ping(host string) {
+	if d.grpc {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		d.Alive = grpc.Check(ctx, d.transport, d.URL, "") == nil
+		return
+	}
+
+	// the proxy's transport trusts the same CAs as the requests it forwards
+	httpClient := &http.Client{
+		Transport: d.transport,
+		Timeout:   500 * time.Millisecond,
+	}
+
 	resp, err := httpClient.Get(d.URL)
 	if err != nil {
 		d.Alive = false
@@ -1,17 +1,15 @@
 package iphash
 
 import (
-	"net"
 	"net/http"
 	"sync"
 	"time"
 
-	"github.com/Dyastin-0/mrps/internal/hijack"
 	lbcommon "github.com/Dyastin-0/mrps/internal/loadbalancer/common"
 	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/forwarded"
 	"github.com/Dyastin-0/mrps/pkg/hash"
 	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
-	"github.com/Dyastin-0/mrps/pkg/rewriter"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/net/context"
 )
@@ -24,7 +22,7 @@ type IPHash struct {
 
 func New(ctx context.Context,
 	dests []types.Dest,
-	rewriteRule rewriter.RewriteRule,
+	proxyConfig reverseproxy.Config,
 	path, host string,
 	healthCheckInterval time.Duration,
 ) *IPHash {
@@ -36,12 +34,11 @@ func New(ctx context.Context,
 	}
 
 	for idx, dst := range dests {
-		newDest := &lbcommon.Dest{URL: dst.URL}
+		newDest := lbcommon.NewDest(dst.Upstream(), proxyConfig)
 		go newDest.Check(context,
 			host,
 			healthCheckInterval,
 		)
-		newDest.Proxy = reverseproxy.New(dst.URL, rewriteRule)
 		ip.Dests[idx] = newDest
 	}
 
@@ -55,17 +52,13 @@ func (ih *IPHash) Serve(w http.ResponseWriter, r *http.Request, retries int) boo
 	}
 
 	ih.mu.Lock()
-	defer ih.mu.Unlock()
-
-	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-	hash := hash.FNV(ip)
+	hash := hash.FNV(forwarded.ClientIP(r))
 	index := int(hash) % len(ih.Dests)
 
 	dest := ih.Dests[index]
+	ih.mu.Unlock()
 
-	statusCode := hijack.StatusCode(dest.Proxy, w, r)
-
-	if statusCode >= 500 {
+	if _, retry := dest.Serve(w, r, retries > 1); retry && retries > 1 {
 		ih.Serve(w, r, retries-1)
 	}
 
@@ -9,7 +9,7 @@ import (
 
 	"github.com/Dyastin-0/mrps/internal/loadbalancer/iphash"
 	"github.com/Dyastin-0/mrps/internal/types"
-	"github.com/Dyastin-0/mrps/pkg/rewriter"
+	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,7 +45,7 @@ func TestIPHashBasic(t *testing.T) {
 	}
 	path := "/api/v1"
 
-	ipHashInstance := iphash.New(context.Background(), dests, rewriter.RewriteRule{}, path, "localhost", 1000*time.Millisecond)
+	ipHashInstance := iphash.New(context.Background(), dests, reverseproxy.Config{}, path, "localhost", 1000*time.Millisecond)
 
 	assert.Equal(t, 3, len(ipHashInstance.Dests), "should initialize with 3 destinations")
 
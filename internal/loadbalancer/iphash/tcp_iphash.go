@@ -11,6 +11,7 @@ import (
 	"github.com/Dyastin-0/mrps/internal/types"
 	"github.com/Dyastin-0/mrps/pkg/hash"
 	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
+	"github.com/Dyastin-0/mrps/pkg/timeout"
 )
 
 type IPHashTCP struct {
@@ -22,6 +23,7 @@ type IPHashTCP struct {
 func NewTCP(
 	ctx context.Context,
 	dests []types.Dest,
+	timeouts timeout.Config,
 	healthCheckInterval time.Duration,
 ) types.BalancerTCP {
 	healthctx, cancel := context.WithCancel(ctx)
@@ -40,8 +42,12 @@ func NewTCP(
 			healthCheckInterval,
 		)
 		newDest.ProxyTCP = &reverseproxy.TCPProxy{
-			Addr:    dst.URL,
-			WithTLS: dst.WithTLS,
+			Addr:           dst.URL,
+			WithTLS:        dst.WithTLS,
+			TLSConfig:      dst.TLSClientConfig,
+			ConnectTimeout: timeout.Duration(timeouts.Connect),
+			IdleTimeout:    timeout.Duration(timeouts.TCPIdle),
+			MaxLifetime:    timeout.Duration(timeouts.TCPLifetime),
 		}
 		iptcp.Dests[idx] = newDest
 	}
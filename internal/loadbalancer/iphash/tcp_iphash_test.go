@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/timeout"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -49,7 +50,7 @@ func TestIPHashTCPForward(t *testing.T) {
 		{URL: "127.0.0.1:9002"},
 	}
 
-	balancer := NewTCP(context.Background(), dests, 1000*time.Millisecond)
+	balancer := NewTCP(context.Background(), dests, timeout.Config{}, 1000*time.Millisecond)
 
 	clientConn, serverConn := net.Pipe()
 
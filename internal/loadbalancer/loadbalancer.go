@@ -9,24 +9,25 @@ import (
 	"github.com/Dyastin-0/mrps/internal/loadbalancer/rr"
 	"github.com/Dyastin-0/mrps/internal/loadbalancer/wrr"
 	"github.com/Dyastin-0/mrps/internal/types"
-	"github.com/Dyastin-0/mrps/pkg/rewriter"
+	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
+	"github.com/Dyastin-0/mrps/pkg/timeout"
 )
 
 func new(
 	btype string,
 	ctx context.Context,
 	dests []types.Dest,
-	rewriteRule rewriter.RewriteRule,
+	proxyConfig reverseproxy.Config,
 	path, host string,
 	healthCheckInterval time.Duration,
 ) (types.Balancer, error) {
 	switch btype {
 	case "rr", "":
-		return rr.New(ctx, dests, rewriteRule, path, host, healthCheckInterval), nil
+		return rr.New(ctx, dests, proxyConfig, path, host, healthCheckInterval), nil
 	case "wrr":
-		return wrr.New(ctx, dests, rewriteRule, path, host, healthCheckInterval), nil
+		return wrr.New(ctx, dests, proxyConfig, path, host, healthCheckInterval), nil
 	case "ih":
-		return iphash.New(ctx, dests, rewriteRule, path, host, healthCheckInterval), nil
+		return iphash.New(ctx, dests, proxyConfig, path, host, healthCheckInterval), nil
 	default:
 		return nil, fmt.Errorf("unsupported balancer type: %s", btype)
 	}
@@ -35,22 +36,23 @@ func new(
 func New(
 	ctx context.Context,
 	dests []types.Dest,
-	rewriteRule rewriter.RewriteRule,
+	proxyConfig reverseproxy.Config,
 	proto, btype, path, host string,
 	healthCheckInterval time.Duration,
 ) (types.Balancer, error) {
-	return new(btype, ctx, dests, rewriteRule, path, host, healthCheckInterval)
+	return new(btype, ctx, dests, proxyConfig, path, host, healthCheckInterval)
 }
 
 func NewTCP(
 	btype string,
 	ctx context.Context,
 	dests []types.Dest,
+	timeouts timeout.Config,
 	healthCheckInterval time.Duration,
 ) (types.BalancerTCP, error) {
 	switch btype {
 	case "ih", "":
-		return iphash.NewTCP(ctx, dests, healthCheckInterval), nil
+		return iphash.NewTCP(ctx, dests, timeouts, healthCheckInterval), nil
 
 	default:
 		return nil, fmt.Errorf("unsupported balancer type: %s", btype)
@@ -6,11 +6,10 @@ import (
 	"sync"
 	"time"
 
-	"github.com/Dyastin-0/mrps/internal/hijack"
 	lbcommon "github.com/Dyastin-0/mrps/internal/loadbalancer/common"
 	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
 	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
-	"github.com/Dyastin-0/mrps/pkg/rewriter"
 	"github.com/rs/zerolog/log"
 )
 
@@ -24,7 +23,7 @@ type RR struct {
 func New(
 	ctx context.Context,
 	dests []types.Dest,
-	rewriteRule rewriter.RewriteRule,
+	proxyConfig reverseproxy.Config,
 	path, host string,
 	HealthCheckInterval time.Duration,
 ) *RR {
@@ -36,13 +35,12 @@ func New(
 	}
 
 	for idx, dst := range dests {
-		newDest := &lbcommon.Dest{URL: dst.URL}
+		newDest := lbcommon.NewDest(dst.Upstream(), proxyConfig)
 		go newDest.Check(
 			context,
 			host,
 			HealthCheckInterval,
 		)
-		newDest.Proxy = reverseproxy.New(dst.URL, rewriteRule)
 		rr.Dests[idx] = newDest
 	}
 
@@ -59,7 +57,7 @@ func (rr *RR) StopHealthChecks() {
 
 func (rr *RR) Serve(w http.ResponseWriter, r *http.Request, retries int) bool {
 	if len(rr.Dests) == 0 || retries <= 0 {
-		http.Error(w, "All backend servers are down", http.StatusBadGateway)
+		errorpage.Write(w, r, http.StatusBadGateway, "all backend servers are down")
 		return false
 	}
 
@@ -68,9 +66,9 @@ func (rr *RR) Serve(w http.ResponseWriter, r *http.Request, retries int) bool {
 	rr.index = (rr.index + 1) % len(rr.Dests)
 	rr.mu.Unlock()
 
-	statusCode := hijack.StatusCode(dest.Proxy, w, r)
+	statusCode, retry := dest.Serve(w, r, retries > 1)
 
-	if statusCode >= 500 {
+	if retry {
 		log.Printf("Server %s failed with status %d, retrying (%d retries left)...", dest.URL, statusCode, retries-1)
 		return rr.Serve(w, r, retries-1)
 	}
@@ -9,7 +9,7 @@ import (
 
 	"github.com/Dyastin-0/mrps/internal/loadbalancer/rr"
 	"github.com/Dyastin-0/mrps/internal/types"
-	"github.com/Dyastin-0/mrps/pkg/rewriter"
+	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -44,7 +44,7 @@ func TestRoundRobinBasic(t *testing.T) {
 	}
 
 	path := "/api/v1"
-	rrInstance := rr.New(context.Background(), dests, rewriter.RewriteRule{}, path, "localhost", 1000*time.Millisecond)
+	rrInstance := rr.New(context.Background(), dests, reverseproxy.Config{}, path, "localhost", 1000*time.Millisecond)
 
 	assert.Len(t, rrInstance.Dests, 3, "should initialize with 3 destinations")
 
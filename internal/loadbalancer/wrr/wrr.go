@@ -6,11 +6,9 @@ import (
 	"sync"
 	"time"
 
-	"github.com/Dyastin-0/mrps/internal/hijack"
 	lbcommon "github.com/Dyastin-0/mrps/internal/loadbalancer/common"
 	"github.com/Dyastin-0/mrps/internal/types"
 	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
-	"github.com/Dyastin-0/mrps/pkg/rewriter"
 	"github.com/rs/zerolog/log"
 )
 
@@ -24,7 +22,7 @@ type WRR struct {
 func New(
 	ctx context.Context,
 	dests []types.Dest,
-	rewriteRule rewriter.RewriteRule,
+	proxyConfig reverseproxy.Config,
 	path, host string,
 	healthCheckInterval time.Duration,
 ) *WRR {
@@ -36,13 +34,13 @@ func New(
 	}
 
 	for _, dst := range dests {
-		newDest := &lbcommon.Dest{URL: dst.URL, Weight: dst.Weight, CurrentWeight: 0}
+		newDest := lbcommon.NewDest(dst.Upstream(), proxyConfig)
+		newDest.Weight = dst.Weight
 		go newDest.Check(
 			context,
 			host,
 			healthCheckInterval,
 		)
-		newDest.Proxy = reverseproxy.New(dst.URL, rewriteRule)
 		wrr.Dests = append(wrr.Dests, newDest)
 		wrr.totalWeight += dst.Weight
 	}
@@ -64,9 +62,9 @@ func (wrr *WRR) Serve(w http.ResponseWriter, r *http.Request, retries int) bool
 	}
 
 	wrr.mu.Lock()
-	defer wrr.mu.Unlock()
 
 	if len(wrr.Dests) == 0 {
+		wrr.mu.Unlock()
 		return false
 	}
 
@@ -82,15 +80,17 @@ func (wrr *WRR) Serve(w http.ResponseWriter, r *http.Request, retries int) bool
 	}
 
 	if bestIndex == -1 {
+		wrr.mu.Unlock()
 		return false
 	}
 
 	dest := wrr.Dests[bestIndex]
-
-	statusCode := hijack.StatusCode(dest.Proxy, w, r)
 	dest.CurrentWeight -= wrr.totalWeight
 
-	if statusCode >= 500 {
+	// released before proxying, a retry picks the next destination
+	wrr.mu.Unlock()
+
+	if _, retry := dest.Serve(w, r, retries > 1); retry {
 		wrr.Serve(w, r, retries-1)
 	}
 
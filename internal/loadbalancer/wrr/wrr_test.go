@@ -9,7 +9,7 @@ import (
 
 	"github.com/Dyastin-0/mrps/internal/loadbalancer/wrr"
 	"github.com/Dyastin-0/mrps/internal/types"
-	"github.com/Dyastin-0/mrps/pkg/rewriter"
+	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,7 +45,7 @@ func TestWeightedRoundRobin(t *testing.T) {
 
 	path := "/api/v1"
 
-	wrrInstance := wrr.New(context.Background(), dests, rewriter.RewriteRule{}, path, "localhost", 1000*time.Millisecond)
+	wrrInstance := wrr.New(context.Background(), dests, reverseproxy.Config{}, path, "localhost", 1000*time.Millisecond)
 
 	assert.Len(t, wrrInstance.Dests, 3, "should initialize with 3 destinations")
 	counts := map[string]int{
@@ -0,0 +1,74 @@
+package maintenance
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
+	"github.com/Dyastin-0/mrps/pkg/forwarded"
+)
+
+const defaultMessage = "under maintenance, please try again later"
+
+// Handler replies with 503 when the matched domain or route is under maintenance,
+// route maintenance takes precedence over the domain's
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := config.DomainTrie.Match(strings.ToLower(r.Host))
+		if cfg == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+
+		if _, route, ok := cfg.MatchRoute(r.URL.Path); ok && route.Maintenance != nil {
+			if m := route.Maintenance.Get(); m.Active(now) {
+				serve(w, r, next, m, now)
+				return
+			}
+		}
+
+		if cfg.Maintenance != nil {
+			if m := cfg.Maintenance.Get(); m.Active(now) {
+				serve(w, r, next, m, now)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func serve(w http.ResponseWriter, r *http.Request, next http.Handler, m types.MaintenanceConfig, now time.Time) {
+	if m.Bypass(r, net.ParseIP(forwarded.ClientIP(r))) {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if retryAfter := retryAfter(m, now); retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	}
+
+	message := m.Message
+	if message == "" {
+		message = defaultMessage
+	}
+
+	errorpage.Write(w, r, http.StatusServiceUnavailable, message)
+}
+
+// retryAfter returns the seconds left until the window ends, or the configured fallback
+func retryAfter(m types.MaintenanceConfig, now time.Time) int64 {
+	if !m.End.IsZero() {
+		return int64(math.Ceil(m.End.Sub(now).Seconds()))
+	}
+
+	return m.RetryAfter
+}
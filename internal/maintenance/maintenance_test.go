@@ -0,0 +1,159 @@
+package maintenance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupMockConfig(t *testing.T, domain, route types.MaintenanceConfig) {
+	t.Helper()
+
+	domainMaintenance := &types.Maintenance{}
+	if err := domainMaintenance.Set(domain); err != nil {
+		t.Fatalf("failed to set domain maintenance: %v", err)
+	}
+
+	routeMaintenance := &types.Maintenance{}
+	if err := routeMaintenance.Set(route); err != nil {
+		t.Fatalf("failed to set route maintenance: %v", err)
+	}
+
+	config.DomainTrie = types.NewDomainTrie()
+	config.DomainTrie.Insert("localhost", &types.Config{
+		Enabled: true,
+		Routes: types.RouteConfig{
+			"/api": types.PathConfig{Maintenance: routeMaintenance},
+			"/":    types.PathConfig{Maintenance: &types.Maintenance{}},
+		},
+		SortedRoutes: []string{"/api", "/"},
+		Maintenance:  domainMaintenance,
+	})
+}
+
+func TestHandler(t *testing.T) {
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	now := time.Now()
+
+	tests := []struct {
+		name               string
+		domain             types.MaintenanceConfig
+		route              types.MaintenanceConfig
+		path               string
+		remoteAddr         string
+		cookie             *http.Cookie
+		expectedStatus     int
+		expectedRetryAfter int64
+	}{
+		{
+			name:           "Disabled",
+			path:           "/",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:               "Domain maintenance",
+			domain:             types.MaintenanceConfig{Enabled: true, RetryAfter: 120},
+			path:               "/",
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedRetryAfter: 120,
+		},
+		{
+			name:               "Retry after follows the window end",
+			domain:             types.MaintenanceConfig{Enabled: true, End: now.Add(time.Hour), RetryAfter: 5},
+			path:               "/",
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedRetryAfter: 3600,
+		},
+		{
+			name:           "Scheduled window not started",
+			domain:         types.MaintenanceConfig{Enabled: true, Start: now.Add(time.Hour)},
+			path:           "/",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Window already ended",
+			domain:         types.MaintenanceConfig{Enabled: true, Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)},
+			path:           "/",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Route maintenance",
+			route:          types.MaintenanceConfig{Enabled: true},
+			path:           "/api/users",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "Route maintenance leaves other routes",
+			route:          types.MaintenanceConfig{Enabled: true},
+			path:           "/home",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Allowlisted network",
+			domain:         types.MaintenanceConfig{Enabled: true, AllowedIPs: []string{"10.0.0.0/8"}},
+			path:           "/",
+			remoteAddr:     "10.1.2.3:5555",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Bypass cookie",
+			domain:         types.MaintenanceConfig{Enabled: true, BypassCookie: "mrps_bypass", BypassToken: "secret"},
+			path:           "/",
+			cookie:         &http.Cookie{Name: "mrps_bypass", Value: "secret"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Wrong bypass cookie",
+			domain:         types.MaintenanceConfig{Enabled: true, BypassCookie: "mrps_bypass", BypassToken: "secret"},
+			path:           "/",
+			cookie:         &http.Cookie{Name: "mrps_bypass", Value: "guess"},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupMockConfig(t, tt.domain, tt.route)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = "localhost"
+			req.RemoteAddr = "127.0.0.1:12345"
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+
+			if tt.expectedRetryAfter > 0 {
+				retryAfter, err := strconv.ParseInt(rec.Header().Get("Retry-After"), 10, 64)
+				assert.NoError(t, err)
+				assert.InDelta(t, tt.expectedRetryAfter, retryAfter, 1)
+			}
+		})
+	}
+}
+
+func TestMaintenanceSetValidation(t *testing.T) {
+	m := &types.Maintenance{}
+	now := time.Now()
+
+	assert.Error(t, m.Set(types.MaintenanceConfig{Start: now, End: now.Add(-time.Minute)}))
+	assert.Error(t, m.Set(types.MaintenanceConfig{AllowedIPs: []string{"not-an-ip"}}))
+	assert.Error(t, m.Set(types.MaintenanceConfig{BypassCookie: "mrps_bypass"}))
+	assert.NoError(t, m.Set(types.MaintenanceConfig{AllowedIPs: []string{"192.168.1.1", "::1", "10.0.0.0/8"}}))
+}
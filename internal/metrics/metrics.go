@@ -3,11 +3,15 @@ package metrics
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/Dyastin-0/mrps/internal/certs"
 	"github.com/Dyastin-0/mrps/internal/config"
 	"github.com/Dyastin-0/mrps/internal/hijack"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/grpc"
 	"github.com/go-chi/chi/v5"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -54,11 +58,217 @@ var (
 			Help: "Number of active WS connections",
 		},
 	)
+
+	ActiveTCPConns = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tcp_active_connections",
+			Help: "Number of forwarded TCP connections",
+		},
+		[]string{"host"},
+	)
+
+	TCPRefused = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tcp_connections_refused_total",
+			Help: "Total number of TCP connections refused by a connection limit",
+		},
+		[]string{"host", "scope", "reason"},
+	)
+
+	GRPCRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "grpc_requests_total",
+			Help: "Total number of gRPC calls by route and status code",
+		},
+		[]string{"host", "route", "code"},
+	)
+
+	CacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_cache_requests_total",
+			Help: "Total number of requests to cached routes by cache status",
+		},
+		[]string{"host", "status"},
+	)
+
+	CacheEntries = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "http_cache_entries",
+			Help: "Number of responses stored in the cache",
+		},
+		func() float64 {
+			if config.Cache == nil {
+				return 0
+			}
+			entries, _ := config.Cache.Stats()
+			return float64(entries)
+		},
+	)
+
+	CacheSize = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "http_cache_size_bytes",
+			Help: "Size of the responses stored in the cache",
+		},
+		func() float64 {
+			if config.Cache == nil {
+				return 0
+			}
+			_, size := config.Cache.Stats()
+			return float64(size)
+		},
+	)
+
+	RateLimitClients = prometheus.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "rate_limit_tracked_clients",
+			Help: "Number of clients tracked by the rate limiters",
+		},
+		func() float64 {
+			return float64(config.Clients.Len())
+		},
+	)
 )
 
-type ResponseWriter struct {
-	http.ResponseWriter
-	StatusCode int
+// wsCollector reports the counters kept by the WebSocket proxy of each route, summed per domain
+type wsCollector struct {
+	connections *prometheus.Desc
+	upgrades    *prometheus.Desc
+	rejected    *prometheus.Desc
+	closed      *prometheus.Desc
+	messages    *prometheus.Desc
+	bytes       *prometheus.Desc
+}
+
+var WSProxy = &wsCollector{
+	connections: prometheus.NewDesc("ws_proxy_connections", "Number of open proxied WebSocket connections", []string{"host"}, nil),
+	upgrades:    prometheus.NewDesc("ws_proxy_upgrades_total", "Total number of proxied WebSocket upgrades", []string{"host"}, nil),
+	rejected:    prometheus.NewDesc("ws_proxy_rejected_total", "Total number of WebSocket upgrades refused by the proxy", []string{"host", "reason"}, nil),
+	closed:      prometheus.NewDesc("ws_proxy_closed_total", "Total number of WebSocket connections closed by the proxy", []string{"host", "reason"}, nil),
+	messages:    prometheus.NewDesc("ws_proxy_messages_total", "Total number of proxied WebSocket messages", []string{"host", "direction"}, nil),
+	bytes:       prometheus.NewDesc("ws_proxy_bytes_total", "Total number of proxied WebSocket bytes", []string{"host", "direction"}, nil),
+}
+
+func (c *wsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.connections
+	ch <- c.upgrades
+	ch <- c.rejected
+	ch <- c.closed
+	ch <- c.messages
+	ch <- c.bytes
+}
+
+func (c *wsCollector) Collect(ch chan<- prometheus.Metric) {
+	if config.DomainTrie == nil {
+		return
+	}
+
+	for host, stats := range config.DomainTrie.GetWebSockets() {
+		ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stats.Active), host)
+		ch <- prometheus.MustNewConstMetric(c.upgrades, prometheus.CounterValue, float64(stats.Total), host)
+		ch <- prometheus.MustNewConstMetric(c.rejected, prometheus.CounterValue, float64(stats.RejectedOrigin), host, "origin")
+		ch <- prometheus.MustNewConstMetric(c.rejected, prometheus.CounterValue, float64(stats.RejectedLimit), host, "limit")
+		ch <- prometheus.MustNewConstMetric(c.closed, prometheus.CounterValue, float64(stats.ClosedIdle), host, "idle")
+		ch <- prometheus.MustNewConstMetric(c.closed, prometheus.CounterValue, float64(stats.ClosedLifetime), host, "lifetime")
+		ch <- prometheus.MustNewConstMetric(c.closed, prometheus.CounterValue, float64(stats.ClosedFrameSize), host, "frame_size")
+		ch <- prometheus.MustNewConstMetric(c.messages, prometheus.CounterValue, float64(stats.MessagesIn), host, "in")
+		ch <- prometheus.MustNewConstMetric(c.messages, prometheus.CounterValue, float64(stats.MessagesOut), host, "out")
+		ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.CounterValue, float64(stats.BytesIn), host, "in")
+		ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.CounterValue, float64(stats.BytesOut), host, "out")
+	}
+}
+
+// poolCollector reports the connections each destination keeps to its upstream,
+// the reuse rate is upstream_pool_reused_total over upstream_pool_requests_total
+type poolCollector struct {
+	connections *prometheus.Desc
+	requests    *prometheus.Desc
+	reused      *prometheus.Desc
+}
+
+var UpstreamPool = &poolCollector{
+	connections: prometheus.NewDesc("upstream_pool_connections", "Number of open connections to an upstream", []string{"host", "upstream"}, nil),
+	requests:    prometheus.NewDesc("upstream_pool_requests_total", "Total number of connections handed to upstream requests", []string{"host", "upstream"}, nil),
+	reused:      prometheus.NewDesc("upstream_pool_reused_total", "Total number of upstream requests sent on a reused connection", []string{"host", "upstream"}, nil),
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.connections
+	ch <- c.requests
+	ch <- c.reused
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	if config.DomainTrie == nil {
+		return
+	}
+
+	for host, upstreams := range config.DomainTrie.GetPools() {
+		for upstream, stats := range upstreams {
+			ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stats.Open), host, upstream)
+			ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(stats.Requests), host, upstream)
+			ch <- prometheus.MustNewConstMetric(c.reused, prometheus.CounterValue, float64(stats.Reused), host, upstream)
+		}
+	}
+}
+
+// certCollector reports the certificates of the inventory by their first name and source
+type certCollector struct {
+	expiry      *prometheus.Desc
+	lastRenewal *prometheus.Desc
+	failing     *prometheus.Desc
+	ocsp        *prometheus.Desc
+}
+
+var Certificates = &certCollector{
+	expiry:      prometheus.NewDesc("tls_certificate_expiry_timestamp_seconds", "Time a certificate expires", []string{"name", "source", "issuer"}, nil),
+	lastRenewal: prometheus.NewDesc("tls_certificate_last_renewal_timestamp_seconds", "Time of the last attempt to obtain or renew a certificate", []string{"name", "source"}, nil),
+	failing:     prometheus.NewDesc("tls_certificate_renewal_failing", "Whether the last attempt to obtain or renew a certificate failed", []string{"name", "source"}, nil),
+	ocsp:        prometheus.NewDesc("tls_certificate_ocsp_status", "OCSP status of a certificate, the status label is good, revoked, unknown or none", []string{"name", "source", "status"}, nil),
+}
+
+func (c *certCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.expiry
+	ch <- c.lastRenewal
+	ch <- c.failing
+	ch <- c.ocsp
+}
+
+func (c *certCollector) Collect(ch chan<- prometheus.Metric) {
+	if config.DomainTrie == nil {
+		return
+	}
+
+	// the inventory lists the certificates expiring first at the top, walking
+	// it backwards keeps the newest copy of a renewed certificate
+	infos := certs.Inventory()
+	seen := make(map[string]bool)
+	for i := len(infos) - 1; i >= 0; i-- {
+		info := infos[i]
+		if len(info.Names) == 0 {
+			continue
+		}
+
+		name := info.Names[0]
+		if seen[name+info.Source] {
+			continue
+		}
+		seen[name+info.Source] = true
+
+		ch <- prometheus.MustNewConstMetric(c.expiry, prometheus.GaugeValue, float64(info.NotAfter.Unix()), name, info.Source, info.Issuer)
+		ch <- prometheus.MustNewConstMetric(c.ocsp, prometheus.GaugeValue, 1, name, info.Source, info.OCSP)
+
+		if info.LastRenewal == nil {
+			continue
+		}
+
+		failing := 0.0
+		if info.LastError != "" {
+			failing = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.lastRenewal, prometheus.GaugeValue, float64(info.LastRenewal.Unix()), name, info.Source)
+		ch <- prometheus.MustNewConstMetric(c.failing, prometheus.GaugeValue, failing, name, info.Source)
+	}
 }
 
 func init() {
@@ -67,6 +277,16 @@ func init() {
 	prometheus.MustRegister(ActiveRequests)
 	prometheus.MustRegister(ActiveSSHConns)
 	prometheus.MustRegister(ActiveWSConns)
+	prometheus.MustRegister(ActiveTCPConns)
+	prometheus.MustRegister(TCPRefused)
+	prometheus.MustRegister(GRPCRequests)
+	prometheus.MustRegister(CacheRequests)
+	prometheus.MustRegister(CacheEntries)
+	prometheus.MustRegister(CacheSize)
+	prometheus.MustRegister(RateLimitClients)
+	prometheus.MustRegister(WSProxy)
+	prometheus.MustRegister(UpstreamPool)
+	prometheus.MustRegister(Certificates)
 }
 
 func Handler() http.HandlerFunc {
@@ -82,7 +302,16 @@ func UpdateHandler(next http.Handler) http.Handler {
 		ActiveRequests.Inc()
 		defer ActiveRequests.Dec()
 
-		statusCode := hijack.StatusCode(next, w, r)
+		rec := hijack.NewResponseWriter(w)
+		next.ServeHTTP(rec, r)
+
+		statusCode := rec.StatusCode
+
+		// gRPC calls answer 200 and carry their outcome in the grpc-status trailer
+		if code, ok := grpc.Status(rec.Header()); ok && grpc.IsGRPC(r) {
+			statusCode = code.HTTPStatus()
+			GRPCRequests.WithLabelValues(host, route(host, r.URL.Path), code.String()).Inc()
+		}
 
 		duration := time.Since(start).Seconds()
 
@@ -93,6 +322,18 @@ func UpdateHandler(next http.Handler) http.Handler {
 	})
 }
 
+// route returns the configured route matching path, the path itself is picked by the client
+// and would give every unknown method its own series
+func route(host, path string) string {
+	if cfg := config.DomainTrie.MatchWithProto(strings.ToLower(host), types.HTTPProtocol); cfg != nil {
+		if routePath, _, ok := cfg.MatchRoute(path); ok {
+			return routePath
+		}
+	}
+
+	return "unknown"
+}
+
 func Start() {
 	metricsRouter := chi.NewRouter()
 
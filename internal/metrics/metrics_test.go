@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/grpc"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGRPCRequests(t *testing.T) {
+	conf := &types.Config{
+		Protocol: types.HTTPProtocol,
+		Routes: types.RouteConfig{
+			"/greeter.Greeter/": types.PathConfig{Type: types.GRPCRoute},
+		},
+		SortedRoutes: []string{"/greeter.Greeter/"},
+	}
+
+	config.DomainTrie = types.NewDomainTrie()
+	config.DomainTrie.Insert("grpc.localhost", conf)
+
+	handler := UpdateHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(grpc.StatusHeader, "12")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	GRPCRequests.Reset()
+
+	for _, path := range []string{"/greeter.Greeter/SayHello", "/greeter.Greeter/Random1", "/other.Service/Random2"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Host = "grpc.localhost"
+		req.ProtoMajor = 2
+		req.Header.Set("Content-Type", grpc.ContentType)
+
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	assert.Equal(t, 2, testutil.CollectAndCount(GRPCRequests), "one series per route")
+	assert.Equal(t, 2.0, testutil.ToFloat64(GRPCRequests.WithLabelValues("grpc.localhost", "/greeter.Greeter/", "UNIMPLEMENTED")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(GRPCRequests.WithLabelValues("grpc.localhost", "unknown", "UNIMPLEMENTED")))
+}
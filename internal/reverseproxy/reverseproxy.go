@@ -5,7 +5,10 @@ import (
 	"strings"
 
 	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/metrics"
 	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
+	"github.com/Dyastin-0/mrps/pkg/wsproxy"
 )
 
 func routeAndServe(routes types.RouteConfig, sortedRoutes []string, w http.ResponseWriter, r *http.Request) bool {
@@ -15,26 +18,71 @@ func routeAndServe(routes types.RouteConfig, sortedRoutes []string, w http.Respo
 		if strings.HasPrefix(path, routePath) {
 			route := routes[routePath]
 
-			if route.BalancerType != "" {
-				if served := route.Balancer.Serve(w, r, len(sortedRoutes)); served {
-					return true
-				}
+			if route.StaticHandler != nil {
+				route.StaticHandler.ServeHTTP(w, r)
+				return true
+			}
+
+			if route.WSProxy != nil && wsproxy.IsWebSocket(r) {
+				route.WSProxy.Serve(w, r, balance(route, len(sortedRoutes)))
+				return true
+			}
+
+			if route.Type == types.WebSocketRoute {
+				w.Header().Set("Upgrade", "websocket")
+				errorpage.Write(w, r, http.StatusUpgradeRequired, "websocket upgrade required")
+				return true
 			}
 
-			if dest := route.Balancer.First(); dest != nil {
-				dest.Proxy.ServeHTTP(w, r)
+			if route.Cache != nil && route.Cache.Enabled && config.Cache != nil {
+				status := config.Cache.Serve(w, r, *route.Cache, balance(route, len(sortedRoutes)))
+				metrics.CacheRequests.WithLabelValues(r.Host, strings.ToLower(string(status))).Inc()
 				return true
 			}
+
+			if serve(route, len(sortedRoutes), w, r) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func serve(route types.PathConfig, retries int, w http.ResponseWriter, r *http.Request) bool {
+	// gRPC calls refused as unavailable move on to the next destination of the route
+	if route.Type == types.GRPCRoute {
+		retries = len(route.Dests)
+	}
+
+	if route.BalancerType != "" {
+		if served := route.Balancer.Serve(w, r, retries); served {
+			return true
 		}
 	}
 
+	if dest := route.Balancer.First(); dest != nil {
+		dest.Proxy.ServeHTTP(w, r)
+		return true
+	}
+
 	return false
 }
 
+// balance adapts serve for the cache, which always needs a response
+func balance(route types.PathConfig, retries int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !serve(route, retries, w, r) {
+			errorpage.Write(w, r, http.StatusBadGateway, "all backend servers are down")
+		}
+	})
+}
+
 func Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		host := strings.ToLower(r.Host)
-		if matchedConfig := config.DomainTrie.Match(host); matchedConfig != nil {
+		// tcp domains have no HTTP balancer
+		if matchedConfig := config.DomainTrie.MatchWithProto(host, types.HTTPProtocol); matchedConfig != nil {
 			if routeAndServe(matchedConfig.Routes, matchedConfig.SortedRoutes, w, r) {
 				return
 			}
@@ -48,13 +96,16 @@ func HTTPHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		host := strings.ToLower(r.Host)
 
-		if !config.Misc.AllowHTTP {
+		dest := config.DomainTrie.MatchWithProto(host, types.HTTPProtocol)
+
+		// client certificates can only be checked over TLS
+		if !config.Misc.AllowHTTP || (dest != nil && dest.ClientVerifier != nil) {
 			target := "https://" + r.Host + r.URL.RequestURI()
 			http.Redirect(w, r, target, http.StatusMovedPermanently)
 			return
 		}
 
-		if dest := config.DomainTrie.Match(host); dest != nil {
+		if dest != nil {
 			if routeAndServe(dest.Routes, dest.SortedRoutes, w, r) {
 				return
 			}
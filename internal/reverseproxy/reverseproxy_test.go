@@ -2,16 +2,25 @@ package reverseproxy
 
 import (
 	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Dyastin-0/mrps/internal/config"
 	"github.com/Dyastin-0/mrps/internal/loadbalancer"
 	"github.com/Dyastin-0/mrps/internal/types"
-	"github.com/Dyastin-0/mrps/pkg/rewriter"
+	"github.com/Dyastin-0/mrps/pkg/cache"
+	"github.com/Dyastin-0/mrps/pkg/grpc"
+	"github.com/Dyastin-0/mrps/pkg/headers"
+	proxy "github.com/Dyastin-0/mrps/pkg/reverseproxy"
+	"github.com/Dyastin-0/mrps/pkg/wsproxy"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func TestReverseProxyMiddlewareWithDomainTrie(t *testing.T) {
@@ -36,10 +45,11 @@ func TestReverseProxyMiddlewareWithDomainTrie(t *testing.T) {
 	config.DomainTrie = types.NewDomainTrie()
 	dests := []types.Dest{{URL: mockService.URL}}
 	dests1 := []types.Dest{{URL: mockService1.URL}}
-	bl, _ := loadbalancer.New(context.Background(), dests1, rewriter.RewriteRule{}, "http", "rr", "/mock", "localhost", 1000*time.Millisecond)
-	bl1, _ := loadbalancer.New(context.Background(), dests, rewriter.RewriteRule{}, "http", "rr", "/api", "localhost", 1000*time.Millisecond)
+	bl, _ := loadbalancer.New(context.Background(), dests1, proxy.Config{}, "http", "rr", "/mock", "localhost", 1000*time.Millisecond)
+	bl1, _ := loadbalancer.New(context.Background(), dests, proxy.Config{}, "http", "rr", "/api", "localhost", 1000*time.Millisecond)
 
 	conf := &types.Config{
+		Protocol: types.HTTPProtocol,
 		Routes: types.RouteConfig{
 			"/api":  types.PathConfig{Dests: dests, Balancer: bl1},
 			"/mock": types.PathConfig{Dests: dests1, Balancer: bl},
@@ -90,3 +100,271 @@ func TestReverseProxyMiddlewareWithDomainTrie(t *testing.T) {
 		assert.Equal(t, "Hello from the mockService1!", recorder.Body.String())
 	})
 }
+
+func TestReverseProxyHeaderRules(t *testing.T) {
+	mockService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		w.Header().Set("X-Powered-By", "php")
+		w.Header().Set("X-Seen-Route", r.Header.Get("X-Route"))
+		w.Header().Set("X-Seen-Cookie", r.Header.Get("Cookie"))
+		w.Write([]byte("ok"))
+	}))
+	defer mockService.Close()
+
+	config.DomainTrie = types.NewDomainTrie()
+	dests := []types.Dest{{URL: mockService.URL}}
+	proxyConfig := proxy.Config{
+		Route: "/api",
+		Headers: headers.Config{
+			Request: headers.Rules{
+				Remove: []string{"Cookie"},
+				Set:    map[string]string{"X-Route": "{route}"},
+			},
+			Response: headers.Rules{
+				Remove: []string{"Server", "X-Powered-By"},
+				Set:    map[string]string{"X-Request-Id": "{request_id}"},
+			},
+		},
+	}
+	bl, _ := loadbalancer.New(context.Background(), dests, proxyConfig, "http", "rr", "/api", "localhost", 1000*time.Millisecond)
+
+	conf := &types.Config{
+		Protocol:     types.HTTPProtocol,
+		Routes:       types.RouteConfig{"/api": types.PathConfig{Dests: dests, Balancer: bl}},
+		SortedRoutes: []string{"/api"},
+	}
+	config.DomainTrie.Insert("localhost", conf)
+
+	handler := Handler(http.NotFoundHandler())
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.Host = "localhost"
+	req.Header.Set("Cookie", "session=secret")
+	req.Header.Set("X-Request-Id", "req-1")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	resp := recorder.Result()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Server"))
+	assert.Empty(t, resp.Header.Get("X-Powered-By"))
+	assert.Empty(t, resp.Header.Get("X-Seen-Cookie"))
+	assert.Equal(t, "/api", resp.Header.Get("X-Seen-Route"))
+	assert.Equal(t, "req-1", resp.Header.Get("X-Request-Id"))
+}
+
+func TestReverseProxyCache(t *testing.T) {
+	calls := 0
+	mockService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("cached"))
+	}))
+	defer mockService.Close()
+
+	var err error
+	config.Cache, err = cache.New(cache.Config{})
+	assert.NoError(t, err)
+
+	config.DomainTrie = types.NewDomainTrie()
+	dests := []types.Dest{{URL: mockService.URL}}
+	bl, _ := loadbalancer.New(context.Background(), dests, proxy.Config{}, "http", "rr", "/", "localhost", 1000*time.Millisecond)
+
+	conf := &types.Config{
+		Protocol: types.HTTPProtocol,
+		Routes: types.RouteConfig{
+			"/": types.PathConfig{Dests: dests, Balancer: bl, Cache: &cache.Policy{Enabled: true}},
+		},
+		SortedRoutes: []string{"/"},
+	}
+	config.DomainTrie.Insert("localhost", conf)
+
+	handler := Handler(http.NotFoundHandler())
+
+	for _, expected := range []string{"MISS", "HIT"} {
+		req := httptest.NewRequest(http.MethodGet, "/page", nil)
+		req.Host = "localhost"
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, expected, recorder.Header().Get(cache.StatusHeader))
+		assert.Equal(t, "cached", recorder.Body.String())
+	}
+
+	assert.Equal(t, 1, calls)
+}
+
+func h2cServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestReverseProxyGRPC(t *testing.T) {
+	unavailable := h2cServer(t, func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		grpc.WriteError(w, grpc.Unavailable, "shutting down")
+	})
+
+	streaming := h2cServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", grpc.ContentType)
+		w.Header().Set("Trailer", grpc.StatusHeader)
+		w.WriteHeader(http.StatusOK)
+
+		for i := 0; i < 3; i++ {
+			w.Write(body)
+			w.(http.Flusher).Flush()
+		}
+
+		w.Header().Set(grpc.StatusHeader, "0")
+	})
+
+	config.DomainTrie = types.NewDomainTrie()
+	dests := []types.Dest{{URL: unavailable.URL}, {URL: streaming.URL}}
+	bl, err := loadbalancer.New(context.Background(), dests, proxy.Config{GRPC: true}, "http", "rr", "/", "localhost", time.Minute)
+	assert.NoError(t, err)
+
+	conf := &types.Config{
+		Protocol: types.HTTPProtocol,
+		Routes: types.RouteConfig{
+			"/": types.PathConfig{Type: types.GRPCRoute, Dests: dests, Balancer: bl, BalancerType: "rr"},
+		},
+		SortedRoutes: []string{"/"},
+	}
+	config.DomainTrie.Insert("localhost", conf)
+
+	handler := Handler(http.NotFoundHandler())
+
+	req := httptest.NewRequest(http.MethodPost, "/echo.Echo/Stream", strings.NewReader("ping"))
+	req.Host = "localhost"
+	req.ProtoMajor = 2
+	req.Header.Set("Content-Type", grpc.ContentType)
+	req.Header.Set("Te", "trailers")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	resp := recorder.Result()
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "pingpingping", string(body))
+	assert.Equal(t, "0", resp.Trailer.Get(grpc.StatusHeader))
+	assert.True(t, recorder.Flushed)
+}
+
+func TestReverseProxyWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, message)
+		}
+	}))
+	defer backend.Close()
+
+	config.DomainTrie = types.NewDomainTrie()
+	dests := []types.Dest{{URL: backend.URL}}
+	bl, err := loadbalancer.New(context.Background(), dests, proxy.Config{}, "http", "rr", "/ws", "localhost", time.Minute)
+	assert.NoError(t, err)
+
+	wsProxy, err := wsproxy.New(wsproxy.Config{MaxConnections: 1, AllowedOrigins: []string{"https://localhost"}})
+	assert.NoError(t, err)
+
+	conf := &types.Config{
+		Protocol: types.HTTPProtocol,
+		Routes: types.RouteConfig{
+			"/ws": types.PathConfig{Type: types.WebSocketRoute, Dests: dests, Balancer: bl, WSProxy: wsProxy},
+		},
+		SortedRoutes: []string{"/ws"},
+	}
+	config.DomainTrie.Insert("localhost", conf)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Host = "localhost"
+		Handler(http.NotFoundHandler()).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	t.Run("Requires an upgrade", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/ws")
+		assert.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+		assert.Equal(t, "websocket", resp.Header.Get("Upgrade"))
+	})
+
+	t.Run("Proxies messages", func(t *testing.T) {
+		target := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+		header := http.Header{"Origin": {"https://localhost"}}
+
+		conn, _, err := websocket.DefaultDialer.Dial(target, header)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+		_, message, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(message))
+
+		_, resp, err := websocket.DefaultDialer.Dial(target, header)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+		stats := config.DomainTrie.GetWebSockets()["localhost"]
+		assert.Equal(t, int64(1), stats.Active)
+		assert.Equal(t, int64(1), stats.MessagesIn)
+		assert.Equal(t, int64(1), stats.MessagesOut)
+		assert.Equal(t, int64(1), stats.RejectedLimit)
+	})
+}
+
+func TestReverseProxySkipsTCPDomains(t *testing.T) {
+	config.DomainTrie = types.NewDomainTrie()
+	config.DomainTrie.Insert("db.localhost", &types.Config{
+		Enabled:  true,
+		Protocol: types.TCPProtocol,
+		Routes: types.RouteConfig{
+			"/": types.PathConfig{Dests: []types.Dest{{URL: "localhost:5432"}}},
+		},
+		SortedRoutes: []string{"/"},
+	})
+
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for name, handler := range map[string]http.Handler{"HTTPS": Handler(notFound), "HTTP": HTTPHandler(notFound)} {
+		t.Run(name, func(t *testing.T) {
+			config.Misc.AllowHTTP = true
+			defer func() { config.Misc.AllowHTTP = false }()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = "db.localhost"
+
+			recorder := httptest.NewRecorder()
+			assert.NotPanics(t, func() { handler.ServeHTTP(recorder, req) })
+			assert.Equal(t, http.StatusNotFound, recorder.Code)
+		})
+	}
+}
@@ -1,13 +1,11 @@
 package routelimiter
 
 import (
-	"net"
 	"net/http"
-	"time"
 
 	"github.com/Dyastin-0/mrps/internal/config"
-	"github.com/Dyastin-0/mrps/internal/types"
-	"golang.org/x/time/rate"
+	"github.com/Dyastin-0/mrps/internal/limiter"
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
 )
 
 func Handler(next http.Handler) http.Handler {
@@ -22,57 +20,29 @@ func Handler(next http.Handler) http.Handler {
 
 		// If the domain is not enabled, return 404
 		if !routeConfig.Enabled {
-			http.Error(w, "not found 🤷", http.StatusNotFound)
+			errorpage.Write(w, r, http.StatusNotFound, "not found")
 			return
 		}
 
-		// If the rate limit is not set, assume there is no rate limit
-		if routeConfig.RateLimit.Burst == 0 || routeConfig.RateLimit.Rate == 0 {
-			next.ServeHTTP(w, r)
+		res, ok := limiter.Request(r, host, routeConfig.RateLimit, routeConfig.RateLimits)
+		if !ok {
+			limiter.Refuse(w, r, res)
 			return
 		}
+		limiter.WriteHeaders(w.Header(), res)
 
-		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-
-		key := host + ":" + ip
-		value, exists := config.ClientMngr.Load(key)
-		var client *types.ClientLimiter
+		// routes count in buckets of their own, on top of the domain ones
+		if path, route, ok := routeConfig.MatchRoute(r.URL.Path); ok {
+			limit, stacked := route.Limits()
 
-		if !exists {
-			client = &types.ClientLimiter{
-				Limiter:  rate.NewLimiter(routeConfig.RateLimit.Rate, routeConfig.RateLimit.Burst),
-				LastReq:  time.Now(),
-				Cooldown: time.Now(),
+			res, ok := limiter.Request(r, host+path, limit, stacked)
+			if !ok {
+				limiter.Refuse(w, r, res)
+				return
 			}
-			config.ClientMngr.Store(key, client)
-		} else {
-			client = value.(*types.ClientLimiter)
+			limiter.WriteHeaders(w.Header(), res)
 		}
 
-		if time.Now().Before(client.Cooldown) {
-			w.Header().Set("Retry-After", client.Cooldown.Format(time.RFC1123))
-			http.Error(w, "too many requests ⏳💔", http.StatusTooManyRequests)
-			return
-		}
-
-		if !client.Limiter.Allow() {
-			cooldownDuration := routeConfig.RateLimit.Cooldown
-			if cooldownDuration == 0 {
-				cooldownDuration = 60000
-			}
-
-			client.Cooldown = time.Now().Add(time.Duration(cooldownDuration) * time.Millisecond)
-
-			config.ClientMngr.Store(key, client)
-
-			w.Header().Set("Retry-After", client.Cooldown.Format(time.RFC1123))
-			http.Error(w, "too many requests 💔", http.StatusTooManyRequests)
-			return
-		}
-
-		client.LastReq = time.Now()
-		config.ClientMngr.Store(key, client)
-
 		next.ServeHTTP(w, r)
 	})
 }
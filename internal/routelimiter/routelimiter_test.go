@@ -3,16 +3,16 @@ package routelimiter
 import (
 	"net/http"
 	"net/http/httptest"
-	"sync"
 	"testing"
 	"time"
 
 	"github.com/Dyastin-0/mrps/internal/config"
 	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/limitstore"
 )
 
 func setupMockConfig() {
-	config.ClientMngr = sync.Map{}
+	config.Clients, _ = limitstore.New(limitstore.Config{})
 	config.DomainTrie = types.NewDomainTrie()
 }
 
@@ -112,3 +112,72 @@ func TestDomainHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestRouteLimits(t *testing.T) {
+	setupMockConfig()
+
+	routeConfig := types.Config{
+		Enabled: true,
+		Routes: types.RouteConfig{
+			"/": types.PathConfig{Dests: []types.Dest{{URL: "localhost"}}},
+			"/login": types.PathConfig{
+				Dests:     []types.Dest{{URL: "localhost"}},
+				RateLimit: &types.RateLimitConfig{Algorithm: "gcra", Rate: 0.5, Burst: 2},
+			},
+		},
+		SortedRoutes: []string{"/login", "/"},
+		RateLimit:    types.RateLimitConfig{Algorithm: "sliding_window_log", Rate: 1, Burst: 5},
+	}
+	config.DomainTrie.Insert("routes.localhost", &routeConfig)
+
+	handler := Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "routes.localhost"
+		req.RemoteAddr = "127.0.0.2:12345"
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		code      int
+		limit     string
+		remaining string
+		reset     string
+		retry     string
+	}{
+		{"Domain limit", "/", http.StatusOK, "5", "4", "5", ""},
+		{"Route limit closer to exhaustion", "/login", http.StatusOK, "2", "1", "2", ""},
+		{"Route limit exhausted", "/login", http.StatusOK, "2", "0", "4", ""},
+		{"Refused by the route", "/login", http.StatusTooManyRequests, "2", "0", "4", "2"},
+		{"Other routes only count against the domain", "/", http.StatusOK, "5", "0", "5", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := request(tt.path)
+
+			if rr.Code != tt.code {
+				t.Errorf("Expected status %d but got %d", tt.code, rr.Code)
+			}
+
+			for header, want := range map[string]string{
+				"RateLimit-Limit":     tt.limit,
+				"RateLimit-Remaining": tt.remaining,
+				"RateLimit-Reset":     tt.reset,
+				"Retry-After":         tt.retry,
+			} {
+				if got := rr.Header().Get(header); got != want {
+					t.Errorf("Expected %s %q but got %q", header, want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package router
+
+import (
+	"crypto/tls"
+	nhttp "net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// newHTTP3Server serves handler over QUIC, sharing the certificates of the TLS listener
+func newHTTP3Server(addr string, tlsConfig *tls.Config, handler nhttp.Handler) *http3.Server {
+	return &http3.Server{
+		Addr:      addr,
+		TLSConfig: http3.ConfigureTLSConfig(tlsConfig),
+		Handler:   handler,
+	}
+}
+
+// altSvc advertises the HTTP/3 listener to clients of the TCP listener,
+// nothing is advertised until it is accepting connections
+func altSvc(h3 *http3.Server, next nhttp.Handler) nhttp.Handler {
+	return nhttp.HandlerFunc(func(w nhttp.ResponseWriter, r *nhttp.Request) {
+		h3.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
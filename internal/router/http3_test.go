@@ -0,0 +1,80 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	nhttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/loadbalancer"
+	"github.com/Dyastin-0/mrps/internal/testcert"
+	"github.com/Dyastin-0/mrps/internal/types"
+	proxy "github.com/Dyastin-0/mrps/pkg/reverseproxy"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTP3(t *testing.T) {
+	backend := httptest.NewServer(nhttp.HandlerFunc(func(w nhttp.ResponseWriter, r *nhttp.Request) {
+		w.Write([]byte("hello from " + r.Header.Get("X-Forwarded-Proto")))
+	}))
+	defer backend.Close()
+
+	dests := []types.Dest{{URL: backend.URL}}
+
+	config.DomainTrie = types.NewDomainTrie()
+	bl, err := loadbalancer.New(context.Background(), dests, proxy.Config{}, "http", "rr", "/", "localhost", time.Minute)
+	assert.NoError(t, err)
+
+	config.DomainTrie.Insert("localhost", &types.Config{
+		Enabled:      true,
+		Protocol:     "http",
+		Routes:       types.RouteConfig{"/": types.PathConfig{Dests: dests, Balancer: bl}},
+		SortedRoutes: []string{"/"},
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	handler := httpsRouter()
+	h3Server := newHTTP3Server(conn.LocalAddr().String(), &tls.Config{Certificates: []tls.Certificate{*testcert.SelfSigned(t, "localhost")}}, handler)
+	go h3Server.Serve(conn)
+	defer h3Server.Close()
+
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	t.Run("Serves over QUIC", func(t *testing.T) {
+		transport := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		defer transport.Close()
+
+		req, _ := nhttp.NewRequest(nhttp.MethodGet, "https://"+conn.LocalAddr().String()+"/", nil)
+		req.Host = "localhost"
+
+		resp, err := transport.RoundTrip(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, nhttp.StatusOK, resp.StatusCode)
+		assert.Equal(t, 3, resp.ProtoMajor)
+		assert.Equal(t, "hello from https", string(body))
+	})
+
+	t.Run("Advertises with Alt-Svc", func(t *testing.T) {
+		assert.Eventually(t, func() bool {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(nhttp.MethodGet, "/", nil)
+			req.Host = "localhost"
+
+			altSvc(h3Server, handler).ServeHTTP(rec, req)
+
+			return rec.Header().Get("Alt-Svc") == `h3=":`+strconv.Itoa(port)+`"; ma=2592000`
+		}, time.Second, 10*time.Millisecond)
+	})
+}
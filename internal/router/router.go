@@ -4,37 +4,71 @@ import (
 	"context"
 	"fmt"
 	nhttp "net/http"
-	"os"
+	"time"
 
 	"github.com/Dyastin-0/mrps/internal/allowedhost"
+	"github.com/Dyastin-0/mrps/internal/certs"
+	"github.com/Dyastin-0/mrps/internal/clientauth"
+	"github.com/Dyastin-0/mrps/internal/compress"
 	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/errorpage"
+	"github.com/Dyastin-0/mrps/internal/forwarded"
+	"github.com/Dyastin-0/mrps/internal/hsts"
 	"github.com/Dyastin-0/mrps/internal/limiter"
 	"github.com/Dyastin-0/mrps/internal/logger"
+	"github.com/Dyastin-0/mrps/internal/maintenance"
 	"github.com/Dyastin-0/mrps/internal/metrics"
 	"github.com/Dyastin-0/mrps/internal/reverseproxy"
 	"github.com/Dyastin-0/mrps/internal/routelimiter"
+	"github.com/Dyastin-0/mrps/internal/timeout"
 	"github.com/Dyastin-0/mrps/internal/tls"
-	"github.com/caddyserver/certmagic"
+	"github.com/Dyastin-0/mrps/internal/types"
+	errorpages "github.com/Dyastin-0/mrps/pkg/errorpage"
+	timeouts "github.com/Dyastin-0/mrps/pkg/timeout"
 	"github.com/go-chi/chi/v5"
-	cf "github.com/libdns/cloudflare"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+)
+
+// setTimeouts bounds reading request headers and keeping idle connections with the global
+// timeouts, the rest is applied per request by timeout.Handler once the route is known
+func setTimeouts(server *nhttp.Server) {
+	server.ReadHeaderTimeout = defaultReadHeaderTimeout
+	if config.Timeouts.Read != 0 {
+		server.ReadHeaderTimeout = timeouts.Duration(config.Timeouts.Read)
+	}
+
+	server.IdleTimeout = defaultIdleTimeout
+	if config.Timeouts.Idle != 0 {
+		server.IdleTimeout = timeouts.Duration(config.Timeouts.Idle)
+	}
+}
+
 func httpsRouter() *chi.Mux {
 	router := chi.NewRouter()
 
 	router.Use(logger.Handler)
 	router.Use(metrics.UpdateHandler)
+	router.Use(timeout.Handler)
+	router.Use(forwarded.Handler)
+	router.Use(hsts.Handler)
+	router.Use(errorpage.Handler)
+	router.Use(compress.Handler)
 	router.Use(allowedhost.Handler)
+	router.Use(clientauth.Handler)
+	router.Use(maintenance.Handler)
 	router.Use(limiter.Handler)
 	router.Use(routelimiter.Handler)
 	router.Use(reverseproxy.Handler)
 
-	router.Get("/*", func(w nhttp.ResponseWriter, r *nhttp.Request) {
-		host := r.Host
-		resp := fmt.Sprintf("%s is not configured.\n", host)
-		w.Write([]byte(resp))
-	})
+	router.Get("/*", notConfigured)
 
 	return router
 }
@@ -44,69 +78,88 @@ func httpRouter() *chi.Mux {
 
 	router.Use(logger.Handler)
 	router.Use(metrics.UpdateHandler)
+	router.Use(timeout.Handler)
+	router.Use(forwarded.Handler)
+	router.Use(clientauth.Strip)
+	router.Use(errorpage.Handler)
+	router.Use(compress.Handler)
+	router.Use(maintenance.Handler)
 	router.Use(limiter.Handler)
 	router.Use(routelimiter.Handler)
 	router.Use(reverseproxy.HTTPHandler)
 
-	router.Get("/*", func(w nhttp.ResponseWriter, r *nhttp.Request) {
-		host := r.Host
-		resp := fmt.Sprintf("%s is not configured.\n", host)
-		w.Write([]byte(resp))
-	})
+	router.Get("/*", notConfigured)
 
 	return router
 }
 
-func startHTTPS(ctx context.Context) {
-	apiToken := os.Getenv("CLOUDFLARE_API_TOKEN")
-	if apiToken == "" {
-		log.Fatal().Msg("CLOUDFLARE_API_TOKEN environment variable is required")
-	}
+func notConfigured(w nhttp.ResponseWriter, r *nhttp.Request) {
+	errorpages.Write(w, r, nhttp.StatusNotFound, fmt.Sprintf("%s is not configured.", r.Host))
+}
 
-	provider := &cf.Provider{
-		APIToken: apiToken,
+func startHTTPS(ctx context.Context) {
+	err := certs.Sync(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to obtain certificates")
 	}
 
-	certmagic.DefaultACME.Email = config.Misc.Email
-	certmagic.DefaultACME.Agreed = true
-	certmagic.DefaultACME.DisableHTTPChallenge = true
-	certmagic.DefaultACME.CA = certmagic.LetsEncryptProductionCA
-	certmagic.DefaultACME.DNS01Solver = &certmagic.DNS01Solver{
-		DNSManager: certmagic.DNSManager{
-			DNSProvider: provider,
-		},
-	}
+	tlsConfig := certs.TLSConfig(types.HTTPProtocol, "h2", "http/1.1")
+	handler := nhttp.Handler(httpsRouter())
 
-	magic := certmagic.NewDefault()
+	if config.Misc.HTTP3Enabled {
+		h3Server := newHTTP3Server(":443", tlsConfig, handler)
+		handler = altSvc(h3Server, handler)
 
-	err := magic.ManageSync(ctx, config.Domains)
-	if err != nil {
-		log.Warn().Err(err).Msg("failed to obtain certificates")
+		go startHTTP3(ctx, h3Server)
 	}
 
 	httpsServer := &nhttp.Server{
 		Addr:      ":443",
-		TLSConfig: magic.TLSConfig(),
-		Handler:   httpsRouter(),
+		TLSConfig: tlsConfig,
+		Handler:   handler,
 	}
+	setTimeouts(httpsServer)
 
 	go func() {
 		<-ctx.Done()
 		httpsServer.Shutdown(context.Background())
 	}()
 
+	// the mux terminates TLS, forwards TCP and ALPN routes and hands HTTP connections to httpsServer
+	mux := tls.NewMux(":443")
+	go func() {
+		if err := mux.Start(ctx); err != nil {
+			log.Fatal().Err(err).Msg("https")
+		}
+	}()
+
 	log.Info().Str("status", "listening").Msg("https")
-	err = httpsServer.ListenAndServeTLS("", "")
-	if err != nil {
+	err = httpsServer.Serve(mux.HTTPListener())
+	if err != nil && err != nhttp.ErrServerClosed && ctx.Err() == nil {
 		log.Fatal().Err(err).Msg("https")
 	}
 }
 
+func startHTTP3(ctx context.Context, h3Server *http3.Server) {
+	go func() {
+		<-ctx.Done()
+		h3Server.Shutdown(context.Background())
+	}()
+
+	log.Info().Str("status", "listening").Msg("http3")
+	err := h3Server.ListenAndServe()
+	if err != nil && err != nhttp.ErrServerClosed {
+		log.Fatal().Err(err).Msg("http3")
+	}
+}
+
 func startHTTP(ctx context.Context) {
+	// h2c lets plaintext gRPC clients reach grpc routes
 	httpServer := &nhttp.Server{
 		Addr:    ":80",
-		Handler: httpRouter(),
+		Handler: certs.HTTPChallengeHandler(h2c.NewHandler(httpRouter(), &http2.Server{})),
 	}
+	setTimeouts(httpServer)
 
 	go func() {
 		<-ctx.Done()
@@ -132,7 +185,13 @@ func startTLS(ctx context.Context) {
 }
 
 func Start(ctx context.Context) {
+	if err := certs.Setup(ctx); err != nil {
+		log.Fatal().Err(err).Msg("certs")
+	}
+
 	go startHTTPS(ctx)
 	go startTLS(ctx)
 	go startHTTP(ctx)
+	go certs.Monitor(ctx)
+	go limiter.Sweep(ctx, time.Minute)
 }
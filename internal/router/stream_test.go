@@ -0,0 +1,109 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	nhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/loadbalancer"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/compress"
+	proxy "github.com/Dyastin-0/mrps/pkg/reverseproxy"
+	"github.com/stretchr/testify/assert"
+)
+
+// streamServer sends each event once the client has read the previous one,
+// a buffered response would never reach the client and the test would time out
+func streamServer(t *testing.T, contentType string, next <-chan struct{}) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(nhttp.HandlerFunc(func(w nhttp.ResponseWriter, r *nhttp.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(nhttp.StatusOK)
+
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(nhttp.Flusher).Flush()
+
+			select {
+			case <-next:
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Second):
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestStreaming(t *testing.T) {
+	var err error
+	config.Compressor, err = compress.New(compress.Config{Enabled: true, MinSize: 1})
+	assert.NoError(t, err)
+	defer func() { config.Compressor = nil }()
+
+	tests := []struct {
+		name          string
+		contentType   string
+		flushInterval time.Duration
+	}{
+		{"Server-sent events", "text/event-stream", 0},
+		{"Long polling", "application/json", -1},
+		{"Periodic flush", "application/json", 10 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := make(chan struct{})
+			backend := streamServer(t, tt.contentType, next)
+
+			dests := []types.Dest{{URL: backend.URL}}
+
+			config.DomainTrie = types.NewDomainTrie()
+			bl, err := loadbalancer.New(context.Background(), dests, proxy.Config{FlushInterval: tt.flushInterval}, "http", "rr", "/", "localhost", time.Minute)
+			assert.NoError(t, err)
+
+			config.DomainTrie.Insert("localhost", &types.Config{
+				Enabled:      true,
+				Protocol:     "http",
+				Routes:       types.RouteConfig{"/": types.PathConfig{Dests: dests, Balancer: bl}},
+				SortedRoutes: []string{"/"},
+			})
+
+			server := httptest.NewServer(httpsRouter())
+			defer server.Close()
+
+			req, _ := nhttp.NewRequest(nhttp.MethodGet, server.URL+"/events", nil)
+			req.Host = "localhost"
+			req.Header.Set("Accept-Encoding", "gzip")
+
+			resp, err := nhttp.DefaultClient.Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			assert.Equal(t, nhttp.StatusOK, resp.StatusCode)
+			assert.Empty(t, resp.Header.Get("Content-Encoding"))
+
+			reader := bufio.NewReader(resp.Body)
+			for i := 0; i < 3; i++ {
+				line, err := reader.ReadString('\n')
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("data: %d", i), strings.TrimSpace(line))
+
+				reader.ReadString('\n')
+				next <- struct{}{}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Package testcert issues throwaway certificates for tests
+package testcert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// CA signs the certificates of a test
+type CA struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// NewCA returns a CA valid for an hour
+func NewCA(t testing.TB) *CA {
+	t.Helper()
+
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "mrps test ca"},
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	cert := sign(t, template, nil, nil)
+
+	return &CA{Cert: cert.Leaf, Key: cert.PrivateKey.(*ecdsa.PrivateKey)}
+}
+
+// Issue signs template with a new key, the chain holds the CA after the leaf
+func (ca *CA) Issue(t testing.TB, template *x509.Certificate) *tls.Certificate {
+	t.Helper()
+
+	return sign(t, template, ca.Cert, ca.Key)
+}
+
+// SelfSigned returns a certificate for names, the first one is also its common name
+func SelfSigned(t testing.TB, names ...string) *tls.Certificate {
+	t.Helper()
+
+	return sign(t, &x509.Certificate{Subject: pkix.Name{CommonName: names[0]}, DNSNames: names}, nil, nil)
+}
+
+// sign fills in the serial and an hour of validity when template leaves them
+// unset, a nil parent self-signs it
+func sign(t testing.TB, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain := [][]byte{der}
+	if parent != template {
+		chain = append(chain, parent.Raw)
+	}
+
+	return &tls.Certificate{Certificate: chain, PrivateKey: key, Leaf: leaf}
+}
+
+// Write writes the chain and key of cert as dir/name.crt and dir/name.key
+func Write(t testing.TB, dir, name string, cert *tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chain []byte
+	for _, der := range cert.Certificate {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	write(t, certFile, chain)
+	write(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	return certFile, keyFile
+}
+
+// WriteCert writes cert alone as dir/name.crt, for files listing trusted CAs
+func WriteCert(t testing.TB, dir, name string, cert *x509.Certificate) string {
+	t.Helper()
+
+	file := filepath.Join(dir, name+".crt")
+	write(t, file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+
+	return file
+}
+
+func write(t testing.TB, file string, data []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
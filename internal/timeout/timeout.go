@@ -0,0 +1,27 @@
+package timeout
+
+import (
+	"net/http"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+)
+
+// Handler applies the timeouts of the matched route, or domain, to the request
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeouts := config.Timeouts
+
+		if cfg := config.DomainTrie.Match(r.Host); cfg != nil {
+			timeouts = cfg.ResolvedTimeouts
+
+			if _, route, ok := cfg.MatchRoute(r.URL.Path); ok {
+				timeouts = route.ResolvedTimeouts
+			}
+		}
+
+		r, cancel := timeouts.Apply(w, r)
+		defer cancel()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,140 @@
+package timeout
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/loadbalancer"
+	"github.com/Dyastin-0/mrps/internal/reverseproxy"
+	"github.com/Dyastin-0/mrps/internal/types"
+	proxy "github.com/Dyastin-0/mrps/pkg/reverseproxy"
+	"github.com/Dyastin-0/mrps/pkg/timeout"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	routeTimeouts := timeout.Config{Read: 100, FirstByte: 50}
+	dests := []types.Dest{{URL: backend.URL}}
+
+	config.DomainTrie = types.NewDomainTrie()
+	bl, err := loadbalancer.New(context.Background(), dests, proxy.Config{FirstByteTimeout: timeout.Duration(routeTimeouts.FirstByte)}, "http", "rr", "/", "localhost", time.Minute)
+	assert.NoError(t, err)
+
+	config.DomainTrie.Insert("localhost", &types.Config{
+		Protocol: types.HTTPProtocol,
+		Routes: types.RouteConfig{
+			"/": types.PathConfig{Dests: dests, Balancer: bl, ResolvedTimeouts: routeTimeouts},
+		},
+		SortedRoutes: []string{"/"},
+	})
+
+	server := httptest.NewServer(Handler(reverseproxy.Handler(http.NotFoundHandler())))
+	defer server.Close()
+
+	request := func(t *testing.T, raw string) int {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		fmt.Fprint(conn, raw)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	t.Run("Served in time", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(t, "GET /fast HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	})
+
+	t.Run("Upstream first byte", func(t *testing.T) {
+		assert.Equal(t, http.StatusGatewayTimeout, request(t, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	})
+
+	t.Run("Client read", func(t *testing.T) {
+		assert.Equal(t, http.StatusRequestTimeout, request(t, "POST /fast HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nab"))
+	})
+}
+
+func TestHandlerWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, message)
+		}
+	}))
+	defer backend.Close()
+
+	routeTimeouts := timeout.Config{Read: 100, Write: 100, Request: 100}
+	dests := []types.Dest{{URL: backend.URL}}
+
+	config.DomainTrie = types.NewDomainTrie()
+	bl, err := loadbalancer.New(context.Background(), dests, proxy.Config{}, "http", "rr", "/", "localhost", time.Minute)
+	assert.NoError(t, err)
+
+	config.DomainTrie.Insert("localhost", &types.Config{
+		Protocol: types.HTTPProtocol,
+		Routes: types.RouteConfig{
+			"/": types.PathConfig{Dests: dests, Balancer: bl, ResolvedTimeouts: routeTimeouts},
+		},
+		SortedRoutes: []string{"/"},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Host = "localhost"
+		Handler(reverseproxy.Handler(http.NotFoundHandler())).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	// the client timeouts of the route would have cut the connection by now
+	for i := 0; i < 3; i++ {
+		time.Sleep(150 * time.Millisecond)
+
+		assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("ping")))
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, message, err := conn.ReadMessage()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, "ping", string(message))
+	}
+}
@@ -0,0 +1,54 @@
+package tls
+
+import (
+	"net"
+	"sync"
+)
+
+// handoff is a net.Listener fed with the connections a mux recognized as HTTP
+type handoff struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newHandoff(addr string) *handoff {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		tcpAddr = &net.TCPAddr{}
+	}
+
+	return &handoff{
+		addr:  tcpAddr,
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (h *handoff) push(conn net.Conn) error {
+	select {
+	case h.conns <- conn:
+		return nil
+	case <-h.done:
+		return net.ErrClosed
+	}
+}
+
+func (h *handoff) Accept() (net.Conn, error) {
+	select {
+	case conn := <-h.conns:
+		return conn, nil
+	case <-h.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (h *handoff) Close() error {
+	h.once.Do(func() { close(h.done) })
+	return nil
+}
+
+func (h *handoff) Addr() net.Addr {
+	return h.addr
+}
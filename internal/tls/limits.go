@@ -0,0 +1,76 @@
+package tls
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/Dyastin-0/mrps/internal/limiter"
+	"github.com/Dyastin-0/mrps/internal/metrics"
+	"github.com/Dyastin-0/mrps/internal/types"
+	"github.com/Dyastin-0/mrps/pkg/connlimit"
+	"github.com/rs/zerolog/log"
+)
+
+// refusal reasons, reported as the reason label of tcp_connections_refused_total
+const (
+	reasonRate         = "rate"
+	reasonMax          = "max"
+	reasonMaxPerClient = "max_per_client"
+)
+
+// admit applies the global, domain and route limits to a connection about to be forwarded
+// to the route at path, release must be called once it is closed
+func admit(conn net.Conn, sni, path string, cfg *types.Config, route types.PathConfig) (release func(), err error) {
+	ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		ip = conn.RemoteAddr().String()
+	}
+
+	if _, ok := limiter.Conn(ip, "global", config.GlobalRateLimit, config.GlobalRateLimits); !ok {
+		return nil, refuse(ip, sni, "global", reasonRate)
+	}
+	if _, ok := limiter.Conn(ip, sni, cfg.RateLimit, cfg.RateLimits); !ok {
+		return nil, refuse(ip, sni, "domain", reasonRate)
+	}
+
+	limit, stacked := route.Limits()
+	if _, ok := limiter.Conn(ip, sni+path, limit, stacked); !ok {
+		return nil, refuse(ip, sni, "route", reasonRate)
+	}
+
+	releaseGlobal, err := config.Connections.Acquire(ip)
+	if err != nil {
+		return nil, refuse(ip, sni, "global", reason(err))
+	}
+
+	releaseDomain, err := cfg.ConnLimiter.Acquire(ip)
+	if err != nil {
+		releaseGlobal()
+		return nil, refuse(ip, sni, "domain", reason(err))
+	}
+
+	metrics.ActiveTCPConns.WithLabelValues(sni).Inc()
+
+	return func() {
+		metrics.ActiveTCPConns.WithLabelValues(sni).Dec()
+		releaseDomain()
+		releaseGlobal()
+	}, nil
+}
+
+func reason(err error) string {
+	if errors.Is(err, connlimit.ErrMaxPerClient) {
+		return reasonMaxPerClient
+	}
+
+	return reasonMax
+}
+
+func refuse(ip, sni, scope, reason string) error {
+	metrics.TCPRefused.WithLabelValues(sni, scope, reason).Inc()
+	log.Warn().Str("client", ip).Str("host", sni).Str("scope", scope).Str("reason", reason).Msg("tcp")
+
+	return fmt.Errorf("%s: connection from %s refused: %s %s limit", sni, ip, scope, reason)
+}
@@ -1,6 +1,6 @@
 // Package tls implements a tls conection handler, uses the same config structure as http
 // will have to fix the configuration, it doesn't make sense for it to have Routes,
-// currently it uses the root ["/"]
+// currently it uses the root ["/"] unless a route is selected by ALPN
 package tls
 
 import (
@@ -9,16 +9,24 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"time"
 
+	"github.com/Dyastin-0/mrps/internal/certs"
 	"github.com/Dyastin-0/mrps/internal/config"
 	"github.com/Dyastin-0/mrps/internal/types"
-	"github.com/caddyserver/certmagic"
+	"github.com/Dyastin-0/mrps/pkg/timeout"
 	"github.com/rs/zerolog/log"
 )
 
+// protocols recognized as HTTP on a mux
+var httpProtos = []string{"h2", "http/1.1"}
+
 type TLS struct {
 	addr, domain string
 	cancel       context.CancelFunc
+
+	// http receives the connections recognized as HTTP, nil unless the listener is a mux
+	http *handoff
 }
 
 func New(addr, domain string) *TLS {
@@ -28,6 +36,25 @@ func New(addr, domain string) *TLS {
 	}
 }
 
+// NewMux returns a listener serving every domain on addr. Connections of http domains and
+// those of unknown names or without SNI are accepted by HTTPListener, the connections of
+// tcp domains are forwarded like on a TCP listener whatever protocol they negotiated
+func NewMux(addr string) *TLS {
+	return &TLS{
+		addr: addr,
+		http: newHandoff(addr),
+	}
+}
+
+// HTTPListener returns the listener to serve HTTP from, nil when t is not a mux
+func (t *TLS) HTTPListener() net.Listener {
+	if t.http == nil {
+		return nil
+	}
+
+	return t.http
+}
+
 func (t *TLS) StopHealthChecks() {
 	if t.cancel != nil {
 		t.cancel()
@@ -39,18 +66,31 @@ func (t *TLS) Start(ctx context.Context) error {
 
 	t.cancel = cancel
 
-	magic := certmagic.NewDefault()
+	if t.domain != "" {
+		err := certs.Magic.ManageSync(ctx, certs.ManagedDomains([]string{t.domain}))
+		if err != nil {
+			return err
+		}
+	}
 
-	err := magic.ManageSync(ctx, []string{t.domain})
-	if err != nil {
-		return err
+	tlsConfig := certs.TLSConfig(types.TCPProtocol)
+	if t.http != nil {
+		tlsConfig = certs.TLSConfig("", httpProtos...)
 	}
 
-	ln, err := tls.Listen("tcp", t.addr, magic.TLSConfig())
+	ln, err := tls.Listen("tcp", t.addr, tlsConfig)
 	if err != nil {
 		return err
 	}
 
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+		if t.http != nil {
+			t.http.Close()
+		}
+	}()
+
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
@@ -65,8 +105,6 @@ func (t *TLS) Start(ctx context.Context) error {
 		}
 
 		go func() {
-			defer conn.Close()
-
 			err := t.handleConn(conn)
 			if err != nil {
 				log.Error().Err(err).Msg("tcp")
@@ -76,65 +114,129 @@ func (t *TLS) Start(ctx context.Context) error {
 }
 
 func (t *TLS) handleConn(conn net.Conn) error {
-	sni := getSNI(conn)
+	handedOff := false
+	defer func() {
+		if !handedOff {
+			conn.Close()
+		}
+	}()
+
+	// clients that stall the handshake would hold the connection forever
+	conn.SetDeadline(time.Now().Add(handshakeTimeout()))
+
+	state, err := handshake(conn)
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	sni, proto := state.ServerName, state.NegotiatedProtocol
+	cfg := config.DomainTrie.Match(sni)
+
+	// ALPN routes win over everything else for their protocol
+	if cfg != nil {
+		if route, ok := cfg.ALPN[proto]; ok {
+			if !cfg.Enabled {
+				return fmt.Errorf("%s is disabled", sni)
+			}
+			return limitAndForward(conn, sni, " alpn "+proto, cfg, route)
+		}
+	}
+
+	if t.http != nil && isHTTP(cfg) {
+		if err := t.http.push(conn); err != nil {
+			return err
+		}
+		handedOff = true
+		return nil
+	}
+
 	if sni == "" {
 		return errors.New("missing sni")
 	}
 
-	config := config.DomainTrie.MatchWithProto(sni, types.TCPProtocol)
-	if config == nil {
+	if cfg == nil || cfg.Protocol != types.TCPProtocol {
 		return fmt.Errorf("config not found")
 	}
 
-	if !config.Enabled {
+	if !cfg.Enabled {
 		return fmt.Errorf("%s is disabled", sni)
 	}
 
-	if config.Routes == nil {
+	if cfg.Routes == nil {
 		return fmt.Errorf("routes not set")
 	}
 
-	route, ok := config.Routes["/"]
+	route, ok := cfg.Routes["/"]
 	if !ok {
 		return fmt.Errorf("route not found")
 	}
 
+	return limitAndForward(conn, sni, "/", cfg, route)
+}
+
+func limitAndForward(conn net.Conn, sni, path string, cfg *types.Config, route types.PathConfig) error {
+	release, err := admit(conn, sni, path, cfg, route)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return forward(conn, sni, route)
+}
+
+// isHTTP tells whether a mux hands the connection to the HTTP server, the HTTP
+// router answers for unknown and SNI-less names. Connections of tcp domains are
+// forwarded even when they negotiated h2 or http/1.1, their config has no HTTP balancer
+func isHTTP(cfg *types.Config) bool {
+	return cfg == nil || cfg.Protocol != types.TCPProtocol
+}
+
+func forward(conn net.Conn, sni string, route types.PathConfig) error {
 	if route.BalancerTCP == nil {
-		conn.Close()
 		return fmt.Errorf("nil tcp balancer")
 	}
 
 	if route.BalancerType != "" {
 		route.BalancerTCP.Serve(conn, sni)
-	} else {
-		dst := route.BalancerTCP.First()
+		return nil
+	}
 
-		var err error
-		if dst.ProxyTCP.WithTLS {
-			err = dst.ProxyTCP.ForwardTLS(conn, sni)
-		} else {
-			err = dst.ProxyTCP.Forward(conn)
-		}
-		if err != nil {
-			log.Error().Err(err).Msg("tcp err")
-		}
+	dst := route.BalancerTCP.First()
+
+	var err error
+	if dst.ProxyTCP.WithTLS {
+		err = dst.ProxyTCP.ForwardTLS(conn, sni)
+	} else {
+		err = dst.ProxyTCP.Forward(conn)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("tcp err")
 	}
 
 	return nil
 }
 
-func getSNI(conn net.Conn) string {
+func handshakeTimeout() time.Duration {
+	if config.Timeouts.Read > 0 {
+		return timeout.Duration(config.Timeouts.Read)
+	}
+
+	return 10 * time.Second
+}
+
+func handshake(conn net.Conn) (tls.ConnectionState, error) {
 	tlsConn, ok := conn.(*tls.Conn)
 	if !ok {
-		return ""
+		return tls.ConnectionState{}, errors.New("not a tls connection")
 	}
 
 	if err := tlsConn.Handshake(); err != nil {
-		log.Warn().Err(err).Msg("tls handshake failed")
-		return ""
+		return tls.ConnectionState{}, fmt.Errorf("tls handshake failed: %v", err)
 	}
 
 	state := tlsConn.ConnectionState()
-	log.Debug().Msg("sni: " + state.ServerName)
-	return state.ServerName
+	log.Debug().Msg("sni: " + state.ServerName + ", alpn: " + state.NegotiatedProtocol)
+	return state, nil
 }
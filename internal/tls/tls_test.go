@@ -0,0 +1,374 @@
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Dyastin-0/mrps/internal/certs"
+	"github.com/Dyastin-0/mrps/internal/config"
+	"github.com/caddyserver/certmagic"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+// backend accepts connections with serve until the test ends
+func backend(t *testing.T, serve func(conn net.Conn)) net.Listener {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				serve(conn)
+			}()
+		}
+	}()
+
+	return ln
+}
+
+func echo(conn net.Conn) {
+	io.Copy(conn, conn)
+}
+
+func banner(name string) func(conn net.Conn) {
+	return func(conn net.Conn) {
+		conn.Write([]byte(name))
+	}
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+// setup loads domains with certificates from a local CA and returns the pool trusting it
+func setup(t *testing.T, ctx context.Context, domains string) *x509.CertPool {
+	t.Helper()
+
+	dir := t.TempDir()
+	certmagic.Default.Storage = &certmagic.FileStorage{Path: filepath.Join(dir, "storage")}
+
+	yaml := fmt.Sprintf("tls:\n  ca: local\n  local_ca_dir: %s\ndomains:\n%s", filepath.Join(dir, "ca"), domains)
+
+	file := filepath.Join(dir, "mrps.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte(yaml), 0o600))
+
+	if err := config.Load(ctx, file); err != nil {
+		t.Fatalf("config.Load() failed: %v", err)
+	}
+	if err := certs.Setup(ctx); err != nil {
+		t.Fatalf("certs.Setup() failed: %v", err)
+	}
+
+	root, err := certs.LocalRoot()
+	assert.NoError(t, err)
+
+	roots := x509.NewCertPool()
+	assert.True(t, roots.AppendCertsFromPEM(root))
+
+	return roots
+}
+
+// dial retries until the listener at addr is up
+func dial(t *testing.T, addr string, config *tls.Config) (*tls.Conn, error) {
+	t.Helper()
+
+	var conn *tls.Conn
+	var err error
+	assert.Eventually(t, func() bool {
+		conn, err = tls.Dial("tcp", addr, config)
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	return conn, err
+}
+
+func read(t *testing.T, conn net.Conn, n int) string {
+	t.Helper()
+
+	buf := make([]byte, n)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := io.ReadFull(conn, buf)
+	assert.NoError(t, err)
+
+	return string(buf)
+}
+
+// TestStartLocalCA runs the TCP-TLS listener end to end with certificates from the local CA
+func TestStartLocalCA(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	echoServer := backend(t, echo)
+
+	roots := setup(t, ctx, fmt.Sprintf(`
+  "*.tcp.localhost":
+    enabled: true
+    protocol: tcp
+    routes:
+      /:
+        dests:
+        - url: %s
+`, echoServer.Addr()))
+
+	addr := freeAddr(t)
+	s := New(addr, "*.tcp.localhost")
+	go s.Start(ctx)
+
+	conn, err := dial(t, addr, &tls.Config{ServerName: "db.tcp.localhost", RootCAs: roots})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ping", read(t, conn, 4))
+
+	t.Run("Unknown name", func(t *testing.T) {
+		_, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "db.other.localhost", RootCAs: roots})
+		assert.Error(t, err)
+	})
+}
+
+func TestMux(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tcpServer := backend(t, banner("tcp"))
+	pgServer := backend(t, banner("postgresql"))
+	customServer := backend(t, banner("custom"))
+
+	roots := setup(t, ctx, fmt.Sprintf(`
+  app.localhost:
+    enabled: true
+    protocol: http
+    routes:
+      /:
+        dests:
+        - url: http://localhost:1
+    alpn:
+      custom/1:
+        dests:
+        - url: %s
+  db.localhost:
+    enabled: true
+    protocol: tcp
+    routes:
+      /:
+        dests:
+        - url: %s
+    alpn:
+      postgresql:
+        dests:
+        - url: %s
+`, customServer.Addr(), tcpServer.Addr(), pgServer.Addr()))
+
+	// the mux manages no domain of its own, startHTTPS syncs them first
+	assert.NoError(t, certs.Sync(ctx))
+
+	addr := freeAddr(t)
+	mux := NewMux(addr)
+	go mux.Start(ctx)
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s", r.Proto, r.TLS.ServerName)
+		}),
+	}
+	http2.ConfigureServer(server, nil)
+	go server.Serve(mux.HTTPListener())
+	defer server.Close()
+
+	conn, err := dial(t, addr, &tls.Config{ServerName: "db.localhost", RootCAs: roots})
+	if !assert.NoError(t, err) {
+		return
+	}
+	conn.Close()
+
+	t.Run("TCP routes", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			sni    string
+			protos []string
+			want   string
+		}{
+			{"Without ALPN", "db.localhost", nil, "tcp"},
+			{"ALPN route", "db.localhost", []string{"postgresql"}, "postgresql"},
+			{"ALPN route on http domain", "app.localhost", []string{"custom/1", "h2"}, "custom"},
+			{"HTTP protocols on tcp domain", "db.localhost", []string{"h2", "http/1.1"}, "tcp"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: tt.sni, RootCAs: roots, NextProtos: tt.protos})
+				if !assert.NoError(t, err) {
+					return
+				}
+				defer conn.Close()
+
+				assert.Equal(t, tt.want, read(t, conn, len(tt.want)))
+			})
+		}
+	})
+
+	t.Run("Unknown ALPN", func(t *testing.T) {
+		// clients offering only protocols the domain doesn't serve are refused
+		_, err := tls.Dial("tcp", addr, &tls.Config{ServerName: "db.localhost", RootCAs: roots, NextProtos: []string{"redis"}})
+		assert.Error(t, err)
+	})
+
+	t.Run("HTTP", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			sni   string
+			h2    bool
+			proto string
+		}{
+			{"HTTP/2", "app.localhost", true, "HTTP/2.0"},
+			{"HTTP/1.1", "app.localhost", false, "HTTP/1.1"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				transport := &http.Transport{
+					TLSClientConfig:   &tls.Config{ServerName: tt.sni, RootCAs: roots},
+					ForceAttemptHTTP2: tt.h2,
+				}
+				if !tt.h2 {
+					transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+				}
+				defer transport.CloseIdleConnections()
+
+				resp, err := (&http.Client{Transport: transport}).Get("https://" + addr)
+				if !assert.NoError(t, err) {
+					return
+				}
+				defer resp.Body.Close()
+
+				body, err := io.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.proto+" "+tt.sni, string(body))
+			})
+		}
+	})
+}
+
+func TestLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	echoServer := backend(t, echo)
+
+	roots := setup(t, ctx, fmt.Sprintf(`
+  capped.limits.localhost:
+    enabled: true
+    protocol: tcp
+    connections:
+      max_per_client: 1
+    routes:
+      /:
+        dests:
+        - url: %[1]s
+  rated.limits.localhost:
+    enabled: true
+    protocol: tcp
+    rate_limit:
+      burst: 1
+      rate: 0.001
+      cooldown: 60000
+    routes:
+      /:
+        dests:
+        - url: %[1]s
+`, echoServer.Addr()))
+
+	assert.NoError(t, certs.Sync(ctx))
+
+	addr := freeAddr(t)
+	mux := NewMux(addr)
+	go mux.Start(ctx)
+
+	conn, err := dial(t, addr, &tls.Config{ServerName: "capped.limits.localhost", RootCAs: roots})
+	if !assert.NoError(t, err) {
+		return
+	}
+	conn.Close()
+
+	// ping reports whether a connection to sni is forwarded to the echo server
+	ping := func(t *testing.T, sni string) (net.Conn, bool) {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: sni, RootCAs: roots})
+		if !assert.NoError(t, err) {
+			return nil, false
+		}
+
+		conn.Write([]byte("ping"))
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			conn.Close()
+			return nil, false
+		}
+
+		return conn, string(buf) == "ping"
+	}
+
+	t.Run("Max per client", func(t *testing.T) {
+		var first net.Conn
+		assert.Eventually(t, func() bool {
+			var ok bool
+			first, ok = ping(t, "capped.limits.localhost")
+			return ok
+		}, 5*time.Second, 50*time.Millisecond)
+		if first == nil {
+			return
+		}
+
+		_, ok := ping(t, "capped.limits.localhost")
+		assert.False(t, ok)
+
+		first.Close()
+
+		assert.Eventually(t, func() bool {
+			conn, ok := ping(t, "capped.limits.localhost")
+			if ok {
+				conn.Close()
+			}
+			return ok
+		}, 5*time.Second, 50*time.Millisecond)
+	})
+
+	t.Run("Rate", func(t *testing.T) {
+		conn, ok := ping(t, "rated.limits.localhost")
+		if assert.True(t, ok) {
+			conn.Close()
+		}
+
+		_, ok = ping(t, "rated.limits.localhost")
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,145 @@
+package types
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Dyastin-0/mrps/pkg/forwarded"
+)
+
+type MaintenanceConfig struct {
+	Enabled      bool      `json:"enabled" yaml:"enabled"`
+	Start        time.Time `json:"start,omitempty" yaml:"start,omitempty"`
+	End          time.Time `json:"end,omitempty" yaml:"end,omitempty"`
+	RetryAfter   int64     `json:"retry_after,omitempty" yaml:"retry_after,omitempty"`
+	Message      string    `json:"message,omitempty" yaml:"message,omitempty"`
+	AllowedIPs   []string  `json:"allowed_ips,omitempty" yaml:"allowed_ips,omitempty"`
+	BypassCookie string    `json:"bypass_cookie,omitempty" yaml:"bypass_cookie,omitempty"`
+	BypassToken  string    `json:"bypass_token,omitempty" yaml:"bypass_token,omitempty"`
+
+	allowed []*net.IPNet
+}
+
+// Maintenance guards a MaintenanceConfig so it can be updated through the API while requests read it
+type Maintenance struct {
+	mu     sync.RWMutex
+	config MaintenanceConfig
+}
+
+type MaintenanceStatus struct {
+	Active  bool      `json:"active"`
+	Start   time.Time `json:"start,omitempty"`
+	End     time.Time `json:"end,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+func (m *Maintenance) Get() MaintenanceConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.config
+}
+
+func (m *Maintenance) Set(config MaintenanceConfig) error {
+	if !config.Start.IsZero() && !config.End.IsZero() && !config.End.After(config.Start) {
+		return fmt.Errorf("maintenance end must be after start")
+	}
+
+	if (config.BypassCookie == "") != (config.BypassToken == "") {
+		return fmt.Errorf("maintenance bypass requires both a cookie and a token")
+	}
+
+	allowed := make([]*net.IPNet, 0, len(config.AllowedIPs))
+	for _, ip := range config.AllowedIPs {
+		network, err := forwarded.ParseCIDR(ip)
+		if err != nil {
+			return fmt.Errorf("invalid maintenance allowed ip: %s", ip)
+		}
+
+		allowed = append(allowed, network)
+	}
+	config.allowed = allowed
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.config = config
+	return nil
+}
+
+// Active reports whether maintenance is enabled and now falls within its window
+func (c MaintenanceConfig) Active(now time.Time) bool {
+	if !c.Enabled {
+		return false
+	}
+
+	if !c.Start.IsZero() && now.Before(c.Start) {
+		return false
+	}
+
+	if !c.End.IsZero() && !now.Before(c.End) {
+		return false
+	}
+
+	return true
+}
+
+// Bypass reports whether r is allowed through during maintenance
+func (c MaintenanceConfig) Bypass(r *http.Request, ip net.IP) bool {
+	for _, network := range c.allowed {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+
+	if c.BypassCookie == "" {
+		return false
+	}
+
+	cookie, err := r.Cookie(c.BypassCookie)
+	if err != nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(c.BypassToken)) == 1
+}
+
+func (c MaintenanceConfig) Status(now time.Time) MaintenanceStatus {
+	return MaintenanceStatus{
+		Active:  c.Active(now),
+		Start:   c.Start,
+		End:     c.End,
+		Message: c.Message,
+	}
+}
+
+func (m *Maintenance) IsZero() bool {
+	return m == nil || !m.Get().Enabled
+}
+
+func (m *Maintenance) MarshalYAML() (interface{}, error) {
+	return m.Get(), nil
+}
+
+func (m *Maintenance) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	config := MaintenanceConfig{}
+	if err := unmarshal(&config); err != nil {
+		return err
+	}
+
+	return m.Set(config)
+}
+
+func (m *Maintenance) MarshalJSON() ([]byte, error) {
+	config := m.Get()
+
+	// the token grants access during maintenance, keep it out of the API
+	config.BypassToken = ""
+
+	return json.Marshal(config)
+}
@@ -3,6 +3,10 @@ package types
 import (
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
+	"github.com/Dyastin-0/mrps/pkg/wsproxy"
 )
 
 type TrieNode struct {
@@ -170,6 +174,113 @@ func (t *DomainTrieConfig) SetEnabled(domain string, enabled bool) bool {
 	return modified
 }
 
+func (t *DomainTrieConfig) GetMaintenance() map[string]MaintenanceStatus {
+	statuses := make(map[string]MaintenanceStatus)
+	now := time.Now()
+
+	var traverse func(node *TrieNode, path []string)
+	traverse = func(node *TrieNode, path []string) {
+		if node.Config != nil {
+			domain := strings.Join(reverseSlice(path), ".")
+
+			if node.Config.Maintenance != nil {
+				if cfg := node.Config.Maintenance.Get(); cfg.Enabled {
+					statuses[domain] = cfg.Status(now)
+				}
+			}
+
+			for routePath, routeConfig := range node.Config.Routes {
+				if routeConfig.Maintenance == nil {
+					continue
+				}
+				if cfg := routeConfig.Maintenance.Get(); cfg.Enabled {
+					statuses[domain+routePath] = cfg.Status(now)
+				}
+			}
+		}
+
+		for part, child := range node.Children {
+			traverse(child, append(path, part))
+		}
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	traverse(t.Root, []string{})
+	return statuses
+}
+
+// GetWebSockets sums the WebSocket counters of the routes of each domain
+func (t *DomainTrieConfig) GetWebSockets() map[string]wsproxy.Stats {
+	stats := make(map[string]wsproxy.Stats)
+
+	var traverse func(node *TrieNode, path []string)
+	traverse = func(node *TrieNode, path []string) {
+		if node.Config != nil {
+			domain := strings.Join(reverseSlice(path), ".")
+
+			for _, routeConfig := range node.Config.Routes {
+				if routeConfig.WSProxy == nil {
+					continue
+				}
+
+				domainStats := stats[domain]
+				domainStats.Add(routeConfig.WSProxy.Stats())
+				stats[domain] = domainStats
+			}
+		}
+
+		for part, child := range node.Children {
+			traverse(child, append(path, part))
+		}
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	traverse(t.Root, []string{})
+	return stats
+}
+
+// GetPools returns the upstream connection counters of each domain by destination url
+func (t *DomainTrieConfig) GetPools() map[string]map[string]reverseproxy.PoolStats {
+	stats := make(map[string]map[string]reverseproxy.PoolStats)
+
+	var traverse func(node *TrieNode, path []string)
+	traverse = func(node *TrieNode, path []string) {
+		if node.Config != nil && node.Config.Protocol == HTTPProtocol {
+			domain := strings.Join(reverseSlice(path), ".")
+
+			for _, routeConfig := range node.Config.Routes {
+				if routeConfig.Balancer == nil {
+					continue
+				}
+
+				if stats[domain] == nil {
+					stats[domain] = make(map[string]reverseproxy.PoolStats)
+				}
+
+				for _, dest := range routeConfig.Balancer.GetDests() {
+					destStats := stats[domain][dest.URL]
+					destStats.Add(dest.PoolStats())
+					stats[domain][dest.URL] = destStats
+				}
+			}
+		}
+
+		for part, child := range node.Children {
+			traverse(child, append(path, part))
+		}
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	traverse(t.Root, []string{})
+	return stats
+}
+
 func (t *DomainTrieConfig) GetHealth() map[string]map[string]bool {
 	healthStatus := make(map[string]map[string]bool)
 
@@ -179,6 +290,16 @@ func (t *DomainTrieConfig) GetHealth() map[string]map[string]bool {
 			domain := strings.Join(reverseSlice(path), ".")
 			healthStatus[domain] = make(map[string]bool)
 
+			for _, routeConfig := range node.Config.ALPN {
+				if routeConfig.BalancerTCP == nil {
+					continue
+				}
+
+				for _, dest := range routeConfig.BalancerTCP.GetDests() {
+					healthStatus[domain][dest.URL] = dest.Alive
+				}
+			}
+
 			for _, routeConfig := range node.Config.Routes {
 				if routeConfig.Balancer == nil && routeConfig.BalancerTCP == nil {
 					continue
@@ -220,7 +341,17 @@ func (t *DomainTrieConfig) StopHealthChecks() {
 	traverse = func(node *TrieNode, path []string) {
 		if node.Config != nil {
 			for _, config := range node.Config.Routes {
-				config.Balancer.StopHealthChecks()
+				if config.Balancer != nil {
+					config.Balancer.StopHealthChecks()
+				}
+				if config.BalancerTCP != nil {
+					config.BalancerTCP.StopHealthChecks()
+				}
+			}
+			for _, config := range node.Config.ALPN {
+				if config.BalancerTCP != nil {
+					config.BalancerTCP.StopHealthChecks()
+				}
 			}
 		}
 		for part, child := range node.Children {
@@ -1,44 +1,122 @@
 package types
 
 import (
+	"crypto/tls"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Dyastin-0/mrps/internal/loadbalancer/common"
+	"github.com/Dyastin-0/mrps/pkg/acme"
+	"github.com/Dyastin-0/mrps/pkg/cache"
+	"github.com/Dyastin-0/mrps/pkg/clientauth"
+	"github.com/Dyastin-0/mrps/pkg/compress"
+	"github.com/Dyastin-0/mrps/pkg/connlimit"
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
+	"github.com/Dyastin-0/mrps/pkg/forwarded"
+	"github.com/Dyastin-0/mrps/pkg/headers"
+	"github.com/Dyastin-0/mrps/pkg/limitstore"
+	"github.com/Dyastin-0/mrps/pkg/ratekey"
+	"github.com/Dyastin-0/mrps/pkg/reverseproxy"
 	"github.com/Dyastin-0/mrps/pkg/rewriter"
+	"github.com/Dyastin-0/mrps/pkg/static"
+	"github.com/Dyastin-0/mrps/pkg/timeout"
+	"github.com/Dyastin-0/mrps/pkg/tlspolicy"
+	"github.com/Dyastin-0/mrps/pkg/wsproxy"
 	"golang.org/x/time/rate"
 )
 
 type DomainsConfig map[string]Config
 
-type ClientLimiter struct {
-	Limiter  *rate.Limiter
-	LastReq  time.Time
-	Cooldown time.Time
-}
-
 const (
 	HTTPProtocol = "http"
 	TCPProtocol  = "tcp"
 )
 
+// route types, an empty type is a plain HTTP route
+const (
+	HTTPRoute      = "http"
+	GRPCRoute      = "grpc"
+	WebSocketRoute = "websocket"
+)
+
 type Config struct {
-	Enabled      bool            `yaml:"enabled"`
-	Routes       RouteConfig     `yaml:"routes,omitempty"`
-	SortedRoutes []string        `yaml:"-"`
-	RateLimit    RateLimitConfig `yaml:"rate_limit,omitempty"`
-	Protocol     string          `yaml:"protocol,omitempty"`
+	Enabled      bool                 `yaml:"enabled"`
+	Routes       RouteConfig          `yaml:"routes,omitempty"`
+	SortedRoutes []string             `yaml:"-"`
+	RateLimit    RateLimitConfig      `yaml:"rate_limit,omitempty"`
+	RateLimits   []RateLimitConfig    `yaml:"rate_limits,omitempty"`
+	Protocol     string               `yaml:"protocol,omitempty"`
+	ErrorPages   errorpage.Config     `yaml:"error_pages,omitempty"`
+	Pages        *errorpage.Pages     `yaml:"-" json:"-"`
+	Maintenance  *Maintenance         `yaml:"maintenance,omitempty"`
+	Compression  *compress.Config     `yaml:"compression,omitempty"`
+	Compressor   *compress.Compressor `yaml:"-" json:"-"`
+	Timeouts     *timeout.Config      `yaml:"timeouts,omitempty"`
+
+	ClientAuth     *clientauth.Config   `yaml:"client_auth,omitempty"`
+	ClientVerifier *clientauth.Verifier `yaml:"-" json:"-"`
+	TLS            *tlspolicy.Config    `yaml:"tls,omitempty"`
+	TLSPolicy      *tlspolicy.Policy    `yaml:"-" json:"-"`
+
+	// Connections caps the TCP connections forwarded for the domain
+	Connections *connlimit.Config  `yaml:"connections,omitempty"`
+	ConnLimiter *connlimit.Limiter `yaml:"-" json:"-"`
+
+	// ALPN holds TCP routes keyed by the protocol negotiated with ALPN, they take
+	// precedence over Routes on the TLS listeners
+	ALPN RouteConfig `yaml:"alpn,omitempty"`
+
+	// ResolvedTimeouts is Timeouts merged with the global section
+	ResolvedTimeouts timeout.Config `yaml:"-" json:"-"`
 }
 
 type RouteConfig map[string]PathConfig
 
+// MatchRoute returns the most specific route prefixing path
+func (c *Config) MatchRoute(path string) (string, PathConfig, bool) {
+	for _, routePath := range c.SortedRoutes {
+		if strings.HasPrefix(path, routePath) {
+			return routePath, c.Routes[routePath], true
+		}
+	}
+
+	return "", PathConfig{}, false
+}
+
 type PathConfig struct {
-	Dests        []Dest               `json:"Dests,omitempty" yaml:"dests,omitempty"`
-	RewriteRule  rewriter.RewriteRule `yaml:"rewrite,omitempty"`
-	BalancerType string               `yaml:"balancer,omitempty"`
-	Balancer     Balancer             `yaml:"-"`
-	BalancerTCP  BalancerTCP          `yaml:"-"`
+	Dests         []Dest               `json:"Dests,omitempty" yaml:"dests,omitempty"`
+	Type          string               `json:"Type,omitempty" yaml:"type,omitempty"`
+	Static        *static.Config       `json:"Static,omitempty" yaml:"static,omitempty"`
+	RewriteRule   rewriter.RewriteRule `yaml:"rewrite,omitempty"`
+	Headers       headers.Config       `yaml:"headers,omitempty"`
+	BalancerType  string               `yaml:"balancer,omitempty"`
+	Maintenance   *Maintenance         `yaml:"maintenance,omitempty"`
+	Cache         *cache.Policy        `yaml:"cache,omitempty"`
+	FlushInterval int64                `yaml:"flush_interval,omitempty"`
+	WebSocket     *wsproxy.Config      `json:"WebSocket,omitempty" yaml:"websocket,omitempty"`
+	Balancer      Balancer             `yaml:"-"`
+	BalancerTCP   BalancerTCP          `yaml:"-"`
+	StaticHandler http.Handler         `yaml:"-" json:"-"`
+	WSProxy       *wsproxy.Proxy       `yaml:"-" json:"-"`
+	Timeouts      *timeout.Config      `yaml:"timeouts,omitempty"`
+
+	// RateLimit and RateLimits apply on top of the limits of the domain, with their own counters
+	RateLimit  *RateLimitConfig  `yaml:"rate_limit,omitempty"`
+	RateLimits []RateLimitConfig `yaml:"rate_limits,omitempty"`
+
+	// ResolvedTimeouts is Timeouts merged with the domain and global sections
+	ResolvedTimeouts timeout.Config `yaml:"-" json:"-"`
+}
+
+// Limits returns the rate limit of the route, disabled when unset, and those stacked on it
+func (c PathConfig) Limits() (RateLimitConfig, []RateLimitConfig) {
+	if c.RateLimit == nil {
+		return RateLimitConfig{}, c.RateLimits
+	}
+
+	return *c.RateLimit, c.RateLimits
 }
 
 type Dest struct {
@@ -46,15 +124,63 @@ type Dest struct {
 	WithTLS    bool   `yaml:"with_tls,omitempty"`
 	ServerName string `yaml:"server_name,omitempty"`
 	Weight     int    `yaml:"weight,omitempty"`
+	Protocol   string `yaml:"protocol,omitempty"`
+
+	Pool *reverseproxy.PoolConfig `json:"Pool,omitempty" yaml:"pool,omitempty"`
+	TLS  *reverseproxy.TLSConfig  `json:"TLS,omitempty" yaml:"tls,omitempty"`
+
+	TLSClientConfig *tls.Config `yaml:"-" json:"-"`
+}
+
+// Upstream returns the settings the proxy of d connects with
+func (d Dest) Upstream() reverseproxy.Upstream {
+	upstream := reverseproxy.Upstream{
+		URL:      d.URL,
+		Protocol: d.Protocol,
+		TLS:      d.TLSClientConfig,
+	}
+
+	if d.Pool != nil {
+		upstream.Pool = *d.Pool
+	}
+
+	return upstream
 }
 
+// RateLimitConfig limits each value of Key, an expression such as "{header.X-Api-Key}",
+// clients are keyed by IP when it is empty
 type RateLimitConfig struct {
 	Burst           int           `yaml:"burst,omitempty"`
 	Rate            rate.Limit    `yaml:"rate,omitempty"`
 	Cooldown        int64         `yaml:"cooldown,omitempty"`
+	Algorithm       string        `yaml:"algorithm,omitempty"`
+	Key             string        `yaml:"key,omitempty"`
+	OnMissing       string        `yaml:"on_missing,omitempty"`
+	Keyer           ratekey.Key   `yaml:"-" json:"-"`
 	DefaultCooldown time.Duration `yaml:"-"`
 }
 
+// Enabled tells whether c sets a limit
+func (c RateLimitConfig) Enabled() bool {
+	return c.Burst != 0 && c.Rate != 0
+}
+
+// Limit returns the limit of c, token buckets cool clients down for a minute unless
+// Cooldown is set while the other algorithms only do when it is
+func (c RateLimitConfig) Limit() limitstore.Limit {
+	cooldown := c.Cooldown
+	if cooldown == 0 && (c.Algorithm == "" || c.Algorithm == limitstore.TokenBucket) {
+		cooldown = 60000
+	}
+
+	return limitstore.Limit{
+		Algorithm: c.Algorithm,
+		Rate:      c.Rate,
+		Burst:     c.Burst,
+		Cooldown:  time.Duration(cooldown) * time.Millisecond,
+	}
+}
+
 type MiscConfig struct {
 	Email               string   `yaml:"email,omitempty"`
 	Secure              bool     `yaml:"secure"`
@@ -67,12 +193,30 @@ type MiscConfig struct {
 	IP                  string   `yaml:"ip,omitempty"`
 	AllowHTTP           bool     `yaml:"allow_http"`
 	HealthCheckInterval int64    `yaml:"health_check_interval,omitempty"`
+	HTTP3Enabled        bool     `yaml:"enable_http3,omitempty"`
+}
+
+// TLSConfig is the global tls section, certificates in CertDir are served instead of ACME ones for the names they cover
+type TLSConfig struct {
+	acme.Config     `yaml:",inline"`
+	CertDir         string `yaml:"cert_dir,omitempty"`
+	LocalCADir      string `yaml:"local_ca_dir,omitempty"`
+	ExpiryAlertDays int    `yaml:"expiry_alert_days,omitempty"`
 }
 
 type YAML struct {
-	Domains   DomainsConfig   `yaml:"domains,omitempty"`
-	Misc      MiscConfig      `yaml:"misc,omitempty"`
-	RateLimit RateLimitConfig `yaml:"rate_limit,omitempty"`
+	Domains     DomainsConfig     `yaml:"domains,omitempty"`
+	Misc        MiscConfig        `yaml:"misc,omitempty"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit,omitempty"`
+	RateLimits  []RateLimitConfig `yaml:"rate_limits,omitempty"`
+	Clients     limitstore.Config `yaml:"rate_limit_clients,omitempty"`
+	ErrorPages  errorpage.Config  `yaml:"error_pages,omitempty"`
+	Forwarded   forwarded.Config  `yaml:"forwarded,omitempty"`
+	Compression compress.Config   `yaml:"compression,omitempty"`
+	Cache       cache.Config      `yaml:"cache,omitempty"`
+	Timeouts    timeout.Config    `yaml:"timeouts,omitempty"`
+	TLS         TLSConfig         `yaml:"tls,omitempty"`
+	Connections connlimit.Config  `yaml:"connections,omitempty"`
 }
 
 type Balancer interface {
@@ -0,0 +1,189 @@
+package acme
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/caddyserver/certmagic"
+	"golang.org/x/time/rate"
+)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]ProviderFactory)
+)
+
+// Register makes a DNS provider available to dns-01 challenges under name
+func Register(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	providers[name] = factory
+}
+
+// Providers returns the names of the registered DNS providers
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func provider(name string) (ProviderFactory, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	factory, ok := providers[name]
+	return factory, ok
+}
+
+// Validate checks the settings that don't need a certificate manager
+func (c Config) Validate() error {
+	switch c.Challenge {
+	case "", DNS01:
+	case HTTP01, TLSALPN01:
+		if c.DNS != nil {
+			return fmt.Errorf("dns settings require the %s challenge", DNS01)
+		}
+	default:
+		return fmt.Errorf("unsupported challenge: %s", c.Challenge)
+	}
+
+	if c.Challenge == DNS01 && c.DNS == nil {
+		return fmt.Errorf("%s requires a dns provider", DNS01)
+	}
+
+	if c.DNS != nil {
+		if _, ok := provider(c.DNS.Provider); !ok {
+			return fmt.Errorf("unknown dns provider %q, available: %v", c.DNS.Provider, Providers())
+		}
+	}
+
+	if c.CA == Local && (c.Challenge != "" || c.DNS != nil || c.CARoot != "") {
+		return fmt.Errorf("the %s ca doesn't use challenges or a ca root", Local)
+	}
+
+	if c.OnDemand != nil && (c.OnDemand.Rate < 0 || c.OnDemand.Burst < 0) {
+		return fmt.Errorf("on_demand: rate and burst must not be negative")
+	}
+
+	return nil
+}
+
+// Wildcards tells whether wildcard certificates can be obtained, only dns-01 and the local CA can
+func (c Config) Wildcards() bool {
+	return c.CA == Local || c.Challenge == DNS01 || (c.Challenge == "" && c.DNS != nil)
+}
+
+// Limiter returns the limiter shared by on-demand issuances, nil when on-demand is disabled
+func (o *OnDemand) Limiter() *rate.Limiter {
+	if o == nil || !o.Enabled {
+		return nil
+	}
+
+	r, burst := o.Rate, o.Burst
+	if r == 0 {
+		r = DefaultOnDemandRate
+	}
+	if burst == 0 {
+		burst = DefaultOnDemandBurst
+	}
+
+	return rate.NewLimiter(r, burst)
+}
+
+// DirectoryURL resolves CA to the URL of an ACME directory
+func (c Config) DirectoryURL() string {
+	switch c.CA {
+	case "", Production:
+		return certmagic.LetsEncryptProductionCA
+	case Staging:
+		return certmagic.LetsEncryptStagingCA
+	default:
+		return c.CA
+	}
+}
+
+// Issuer returns an ACME issuer for magic solving only the configured challenge
+func (c Config) Issuer(magic *certmagic.Config, email string) (*certmagic.ACMEIssuer, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	if c.CA == Local {
+		return nil, fmt.Errorf("the %s ca has no ACME directory", Local)
+	}
+
+	template := certmagic.ACMEIssuer{
+		CA:     c.DirectoryURL(),
+		Email:  email,
+		Agreed: true,
+	}
+
+	if c.CARoot != "" {
+		data, err := os.ReadFile(c.CARoot)
+		if err != nil {
+			return nil, fmt.Errorf("ca root: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("ca root: no certificates found in %s", c.CARoot)
+		}
+		template.TrustedRoots = pool
+	}
+
+	challenge := c.Challenge
+	if challenge == "" && c.DNS != nil {
+		challenge = DNS01
+	}
+
+	switch challenge {
+	case DNS01:
+		dnsProvider, err := c.dnsProvider()
+		if err != nil {
+			return nil, err
+		}
+
+		template.DisableHTTPChallenge = true
+		template.DisableTLSALPNChallenge = true
+		template.DNS01Solver = &certmagic.DNS01Solver{
+			DNSManager: certmagic.DNSManager{
+				DNSProvider: dnsProvider,
+			},
+		}
+
+	case HTTP01:
+		template.DisableTLSALPNChallenge = true
+
+	case TLSALPN01:
+		template.DisableHTTPChallenge = true
+	}
+
+	return certmagic.NewACMEIssuer(magic, template), nil
+}
+
+func (c Config) dnsProvider() (certmagic.DNSProvider, error) {
+	factory, _ := provider(c.DNS.Provider)
+
+	options := make(map[string]string, len(c.DNS.Options))
+	for key, value := range c.DNS.Options {
+		options[key] = os.ExpandEnv(value)
+	}
+
+	dnsProvider, err := factory(options)
+	if err != nil {
+		return nil, fmt.Errorf("dns provider %s: %v", c.DNS.Provider, err)
+	}
+
+	return dnsProvider, nil
+}
@@ -0,0 +1,172 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/libdns/libdns"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	options map[string]string
+}
+
+func (p *fakeProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return recs, nil
+}
+
+func (p *fakeProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return recs, nil
+}
+
+func init() {
+	Register("fake", func(options map[string]string) (certmagic.DNSProvider, error) {
+		if options["fail"] != "" {
+			return nil, errors.New(options["fail"])
+		}
+		return &fakeProvider{options: options}, nil
+	})
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"Default", Config{}, false},
+		{"HTTP-01", Config{Challenge: HTTP01}, false},
+		{"TLS-ALPN-01", Config{Challenge: TLSALPN01}, false},
+		{"DNS-01", Config{Challenge: DNS01, DNS: &DNSConfig{Provider: "fake"}}, false},
+		{"DNS provider only", Config{DNS: &DNSConfig{Provider: "cloudflare"}}, false},
+		{"DNS-01 without provider", Config{Challenge: DNS01}, true},
+		{"Unknown provider", Config{DNS: &DNSConfig{Provider: "nope"}}, true},
+		{"DNS with HTTP-01", Config{Challenge: HTTP01, DNS: &DNSConfig{Provider: "fake"}}, true},
+		{"Unknown challenge", Config{Challenge: "email-01"}, true},
+		{"Local", Config{CA: Local}, false},
+		{"Local with challenge", Config{CA: Local, Challenge: HTTP01}, true},
+		{"On-demand", Config{OnDemand: &OnDemand{Enabled: true, Rate: 1, Burst: 5}}, false},
+		{"Negative on-demand rate", Config{OnDemand: &OnDemand{Enabled: true, Rate: -1}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDirectoryURL(t *testing.T) {
+	assert.Equal(t, certmagic.LetsEncryptProductionCA, Config{}.DirectoryURL())
+	assert.Equal(t, certmagic.LetsEncryptProductionCA, Config{CA: Production}.DirectoryURL())
+	assert.Equal(t, certmagic.LetsEncryptStagingCA, Config{CA: Staging}.DirectoryURL())
+	assert.Equal(t, "https://localhost:14000/dir", Config{CA: "https://localhost:14000/dir"}.DirectoryURL())
+}
+
+func TestWildcards(t *testing.T) {
+	assert.False(t, Config{}.Wildcards())
+	assert.False(t, Config{Challenge: HTTP01}.Wildcards())
+	assert.True(t, Config{Challenge: DNS01, DNS: &DNSConfig{Provider: "fake"}}.Wildcards())
+	assert.True(t, Config{DNS: &DNSConfig{Provider: "fake"}}.Wildcards())
+	assert.True(t, Config{CA: Local}.Wildcards())
+}
+
+func TestLimiter(t *testing.T) {
+	var disabled *OnDemand
+	assert.Nil(t, disabled.Limiter())
+	assert.Nil(t, (&OnDemand{}).Limiter())
+
+	limiter := (&OnDemand{Enabled: true}).Limiter()
+	assert.Equal(t, DefaultOnDemandRate, limiter.Limit())
+	assert.Equal(t, DefaultOnDemandBurst, limiter.Burst())
+
+	limiter = (&OnDemand{Enabled: true, Rate: 2, Burst: 1}).Limiter()
+	assert.True(t, limiter.Allow())
+	assert.False(t, limiter.Allow())
+}
+
+func TestIssuer(t *testing.T) {
+	magic := certmagic.NewDefault()
+
+	t.Run("Challenges", func(t *testing.T) {
+		tests := []struct {
+			name        string
+			config      Config
+			wantHTTP    bool
+			wantTLSALPN bool
+			wantDNS     bool
+		}{
+			{"Default", Config{}, true, true, false},
+			{"HTTP-01", Config{Challenge: HTTP01}, true, false, false},
+			{"TLS-ALPN-01", Config{Challenge: TLSALPN01}, false, true, false},
+			{"DNS-01", Config{DNS: &DNSConfig{Provider: "fake"}}, false, false, true},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				issuer, err := tt.config.Issuer(magic, "admin@domain.com")
+				assert.NoError(t, err)
+
+				assert.Equal(t, tt.wantHTTP, !issuer.DisableHTTPChallenge)
+				assert.Equal(t, tt.wantTLSALPN, !issuer.DisableTLSALPNChallenge)
+				assert.Equal(t, tt.wantDNS, issuer.DNS01Solver != nil)
+				assert.Equal(t, "admin@domain.com", issuer.Email)
+				assert.True(t, issuer.Agreed)
+			})
+		}
+	})
+
+	t.Run("Provider options", func(t *testing.T) {
+		t.Setenv("FAKE_TOKEN", "secret")
+
+		issuer, err := Config{DNS: &DNSConfig{Provider: "fake", Options: map[string]string{"token": "${FAKE_TOKEN}"}}}.Issuer(magic, "")
+		assert.NoError(t, err)
+
+		provider := issuer.DNS01Solver.(*certmagic.DNS01Solver).DNSProvider.(*fakeProvider)
+		assert.Equal(t, "secret", provider.options["token"])
+	})
+
+	t.Run("Provider error", func(t *testing.T) {
+		_, err := Config{DNS: &DNSConfig{Provider: "fake", Options: map[string]string{"fail": "no token"}}}.Issuer(magic, "")
+		assert.ErrorContains(t, err, "no token")
+	})
+
+	t.Run("Cloudflare without token", func(t *testing.T) {
+		t.Setenv("CLOUDFLARE_API_TOKEN", "")
+
+		_, err := Config{DNS: &DNSConfig{Provider: "cloudflare"}}.Issuer(magic, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("CA root", func(t *testing.T) {
+		_, err := Config{CA: "https://localhost:14000/dir", CARoot: "missing.pem"}.Issuer(magic, "")
+		assert.Error(t, err)
+
+		empty := filepath.Join(t.TempDir(), "root.pem")
+		assert.NoError(t, os.WriteFile(empty, []byte("not a certificate"), 0o600))
+
+		_, err = Config{CA: "https://localhost:14000/dir", CARoot: empty}.Issuer(magic, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("Local", func(t *testing.T) {
+		_, err := Config{CA: Local}.Issuer(magic, "")
+		assert.Error(t, err)
+	})
+
+	t.Run("Staging", func(t *testing.T) {
+		issuer, err := Config{CA: Staging}.Issuer(magic, "")
+		assert.NoError(t, err)
+		assert.Equal(t, certmagic.LetsEncryptStagingCA, issuer.CA)
+	})
+}
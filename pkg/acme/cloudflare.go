@@ -0,0 +1,30 @@
+package acme
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/caddyserver/certmagic"
+	cf "github.com/libdns/cloudflare"
+)
+
+func init() {
+	Register("cloudflare", newCloudflare)
+}
+
+// newCloudflare reads api_token and zone_token, the API token defaults to CLOUDFLARE_API_TOKEN
+func newCloudflare(options map[string]string) (certmagic.DNSProvider, error) {
+	token := options["api_token"]
+	if token == "" {
+		token = os.Getenv("CLOUDFLARE_API_TOKEN")
+	}
+
+	if token == "" {
+		return nil, fmt.Errorf("api_token or CLOUDFLARE_API_TOKEN is required")
+	}
+
+	return &cf.Provider{
+		APIToken:  token,
+		ZoneToken: options["zone_token"],
+	}, nil
+}
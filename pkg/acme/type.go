@@ -0,0 +1,55 @@
+package acme
+
+import (
+	"github.com/caddyserver/certmagic"
+	"golang.org/x/time/rate"
+)
+
+// on-demand issuance defaults, one name every 10 seconds with bursts of 10
+const (
+	DefaultOnDemandRate  = rate.Limit(0.1)
+	DefaultOnDemandBurst = 10
+)
+
+// challenge types
+const (
+	HTTP01    = "http-01"
+	TLSALPN01 = "tls-alpn-01"
+	DNS01     = "dns-01"
+)
+
+// directories that can be named instead of a URL, Local issues from a
+// local CA without ACME
+const (
+	Production = "production"
+	Staging    = "staging"
+	Local      = "local"
+)
+
+// Config selects how certificates are obtained. An empty Challenge uses dns-01
+// when DNS is set, http-01 and tls-alpn-01 otherwise. CA is Production (default),
+// Staging, Local or a directory URL, CARoot a PEM bundle trusted for that directory
+type Config struct {
+	Challenge string     `json:"challenge,omitempty" yaml:"challenge,omitempty"`
+	CA        string     `json:"ca,omitempty" yaml:"ca,omitempty"`
+	CARoot    string     `json:"ca_root,omitempty" yaml:"ca_root,omitempty"`
+	DNS       *DNSConfig `json:"dns,omitempty" yaml:"dns,omitempty"`
+	OnDemand  *OnDemand  `json:"on_demand,omitempty" yaml:"on_demand,omitempty"`
+}
+
+// OnDemand obtains certificates during the first handshake for a name. Rate is the
+// number of new names allowed per second and Burst how many can be obtained at once
+type OnDemand struct {
+	Enabled bool       `json:"enabled" yaml:"enabled"`
+	Rate    rate.Limit `json:"rate,omitempty" yaml:"rate,omitempty"`
+	Burst   int        `json:"burst,omitempty" yaml:"burst,omitempty"`
+}
+
+// DNSConfig names a registered provider, its options may reference environment variables as ${NAME}
+type DNSConfig struct {
+	Provider string            `json:"provider" yaml:"provider"`
+	Options  map[string]string `json:"options,omitempty" yaml:"options,omitempty"`
+}
+
+// ProviderFactory builds a DNS provider from its options
+type ProviderFactory func(options map[string]string) (certmagic.DNSProvider, error)
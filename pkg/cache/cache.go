@@ -0,0 +1,682 @@
+// Package cache implements a shared HTTP cache honoring Cache-Control, Expires and Vary,
+// with ETag revalidation, stale-while-revalidate, an LRU memory tier and an optional disk tier.
+package cache
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxSize      = 64 << 20
+	defaultMaxEntrySize = 8 << 20
+	defaultDiskMaxSize  = 1 << 30
+	defaultTagHeader    = "Cache-Tag"
+)
+
+// statuses that may be stored without explicit freshness, RFC 9110 section 15.1
+var heuristic = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+func New(config Config) (*Cache, error) {
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaultMaxSize
+	}
+	if config.MaxEntrySize <= 0 {
+		config.MaxEntrySize = defaultMaxEntrySize
+	}
+	if config.MaxEntrySize > config.MaxSize {
+		config.MaxEntrySize = config.MaxSize
+	}
+	if config.TagHeader == "" {
+		config.TagHeader = defaultTagHeader
+	}
+
+	s := &store{
+		memory: newLRU(config.MaxSize),
+		vary:   map[string][]string{},
+	}
+
+	if config.DiskPath != "" {
+		if config.DiskMaxSize <= 0 {
+			config.DiskMaxSize = defaultDiskMaxSize
+		}
+
+		var err error
+		s.disk, err = newDisk(config.DiskPath, config.DiskMaxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Cache{
+		store:        s,
+		maxEntrySize: config.MaxEntrySize,
+		tagHeader:    http.CanonicalHeaderKey(config.TagHeader),
+		calls:        map[string]*call{},
+		now:          time.Now,
+	}, nil
+}
+
+// Serve answers r from the cache or from next, storing cacheable responses
+func (c *Cache) Serve(w http.ResponseWriter, r *http.Request, policy Policy, next http.Handler) Status {
+	primary := primaryKey(r)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		// unsafe methods invalidate what is stored for the URL, RFC 9111 section 4.4
+		if r.Method != http.MethodOptions && r.Method != http.MethodTrace {
+			c.store.purge(func(rec *record) bool { return rec.primary == primary })
+		}
+
+		return c.bypass(w, r, next)
+	}
+
+	directives := parseCacheControl(r.Header.Values("Cache-Control"))
+	if _, ok := directives["no-store"]; ok || r.Header.Get("Upgrade") != "" {
+		return c.bypass(w, r, next)
+	}
+
+	if e := c.lookup(primary, r); e != nil {
+		now := c.now()
+
+		if c.fresh(e, directives, now) {
+			c.write(w, r, e, now, Hit)
+			return Hit
+		}
+
+		if c.servableStale(e, directives, now) {
+			c.revalidate(primary, r, e, policy, next)
+			c.write(w, r, e, now, Stale)
+			return Stale
+		}
+
+		return c.fetch(w, r, primary, e, policy, next)
+	}
+
+	// HEAD responses have no body to store
+	if r.Method == http.MethodHead {
+		return c.bypass(w, r, next)
+	}
+
+	current, leader := c.join(primary)
+	if leader {
+		defer c.leave(primary, current)
+		return c.fetch(w, r, primary, nil, policy, next)
+	}
+
+	// another request is already fetching this key, wait for it and answer from the store
+	select {
+	case <-current.done:
+	case <-r.Context().Done():
+		return Bypass
+	}
+
+	if e := c.lookup(primary, r); e != nil && c.fresh(e, directives, c.now()) {
+		c.write(w, r, e, c.now(), Hit)
+		return Hit
+	}
+
+	return c.fetch(w, r, primary, nil, policy, next)
+}
+
+// Purge removes the entries matching filter and returns how many were removed
+func (c *Cache) Purge(filter Filter) int {
+	host := strings.ToLower(filter.Host)
+
+	return c.store.purge(func(rec *record) bool {
+		if host != "" && rec.host != host {
+			return false
+		}
+
+		if filter.Prefix != "" && !strings.HasPrefix(rec.path, filter.Prefix) {
+			return false
+		}
+
+		if len(filter.Tags) > 0 && !slices.ContainsFunc(filter.Tags, func(tag string) bool {
+			return slices.Contains(rec.tags, tag)
+		}) {
+			return false
+		}
+
+		return true
+	})
+}
+
+// Stats returns the number of stored entries and their size in bytes across both tiers
+func (c *Cache) Stats() (int, int64) {
+	return c.store.stats()
+}
+
+func (c *Cache) bypass(w http.ResponseWriter, r *http.Request, next http.Handler) Status {
+	w.Header().Set(StatusHeader, string(Bypass))
+	next.ServeHTTP(w, r)
+	return Bypass
+}
+
+func (c *Cache) lookup(primary string, r *http.Request) *entry {
+	names, ok := c.store.varyOf(primary)
+	if !ok {
+		return nil
+	}
+
+	return c.store.get(variantKey(primary, names, r.Header))
+}
+
+func (c *Cache) fresh(e *entry, directives map[string]string, now time.Time) bool {
+	if _, ok := directives["no-cache"]; ok {
+		return false
+	}
+
+	age := e.age(now)
+	if maxAge, ok := seconds(directives, "max-age"); ok && age > maxAge {
+		return false
+	}
+
+	return age < e.TTL
+}
+
+func (c *Cache) servableStale(e *entry, directives map[string]string, now time.Time) bool {
+	if _, ok := directives["no-cache"]; ok || e.MustRevalidate {
+		return false
+	}
+
+	if _, ok := directives["max-age"]; ok {
+		return false
+	}
+
+	return e.age(now) < e.TTL+e.SWR
+}
+
+// revalidate refreshes e in the background, at most once at a time per key
+func (c *Cache) revalidate(primary string, r *http.Request, e *entry, policy Policy, next http.Handler) {
+	current, leader := c.join(primary)
+	if !leader {
+		return
+	}
+
+	req := r.Clone(context.WithoutCancel(r.Context()))
+
+	go func() {
+		defer c.leave(primary, current)
+		c.fetch(nil, req, primary, e, policy, next)
+	}()
+}
+
+// fetch forwards r to next, revalidating stale when it has validators, and stores the response.
+// With a nil w the response is only stored.
+func (c *Cache) fetch(w http.ResponseWriter, r *http.Request, primary string, stale *entry, policy Policy, next http.Handler) Status {
+	replaced := stale
+
+	req := r
+	if stale != nil {
+		etag, modified := stale.Header.Get("ETag"), stale.Header.Get("Last-Modified")
+
+		if etag != "" || modified != "" {
+			req = r.Clone(r.Context())
+			req.Header.Del("If-None-Match")
+			req.Header.Del("If-Modified-Since")
+
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if modified != "" {
+				req.Header.Set("If-Modified-Since", modified)
+			}
+		} else {
+			stale = nil
+		}
+	}
+
+	cw := &captureWriter{
+		w:          w,
+		header:     http.Header{},
+		tagHeader:  c.tagHeader,
+		max:        c.maxEntrySize,
+		holdNotMod: stale != nil,
+	}
+
+	next.ServeHTTP(cw, req)
+
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	now := c.now()
+
+	if stale != nil && cw.status == http.StatusNotModified {
+		refreshed := c.refresh(stale, cw.snapshot, policy, now)
+		if refreshed != nil {
+			c.store.set(refreshed)
+		}
+
+		if w != nil {
+			if refreshed == nil {
+				refreshed = stale
+			}
+			c.write(w, r, refreshed, now, Revalidated)
+		}
+
+		return Revalidated
+	}
+
+	// HEAD responses have no body to store
+	if r.Method == http.MethodHead {
+		return Miss
+	}
+
+	if e := c.newEntry(r, primary, cw, policy, now); e != nil {
+		c.store.set(e)
+	} else if replaced != nil && cw.status < http.StatusInternalServerError {
+		// the new response must not be stored, drop the one it replaces
+		c.store.purge(func(rec *record) bool { return rec.key == replaced.Key })
+	}
+
+	return Miss
+}
+
+// refresh applies the headers of a 304 to a copy of e, nil if they forbid storing it
+func (c *Cache) refresh(e *entry, header http.Header, policy Policy, now time.Time) *entry {
+	refreshed := *e
+	refreshed.Header = e.Header.Clone()
+
+	for name, values := range header {
+		if name == "Content-Length" || name == c.tagHeader {
+			continue
+		}
+		refreshed.Header[name] = values
+	}
+
+	ttl, swr, mustRevalidate, ok := freshness(refreshed.Header, policy, now)
+	if !ok {
+		return nil
+	}
+
+	refreshed.Stored = now
+	refreshed.InitialAge = initialAge(header)
+	refreshed.TTL, refreshed.SWR, refreshed.MustRevalidate = ttl, swr, mustRevalidate
+
+	return &refreshed
+}
+
+func (c *Cache) newEntry(r *http.Request, primary string, cw *captureWriter, policy Policy, now time.Time) *entry {
+	if cw.overflow || !heuristic[cw.status] {
+		return nil
+	}
+
+	h := cw.snapshot
+	if h.Get("Set-Cookie") != "" {
+		return nil
+	}
+
+	directives := parseCacheControl(h.Values("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return nil
+	}
+	if _, ok := directives["private"]; ok {
+		return nil
+	}
+
+	// authorized responses are only shared when explicitly allowed, RFC 9111 section 3.5
+	if r.Header.Get("Authorization") != "" {
+		_, public := directives["public"]
+		_, shared := directives["s-maxage"]
+		_, must := directives["must-revalidate"]
+		if !public && !shared && !must {
+			return nil
+		}
+	}
+
+	names := varyNames(h)
+	if slices.Contains(names, "*") {
+		return nil
+	}
+
+	ttl, swr, mustRevalidate, ok := freshness(h, policy, now)
+	if !ok {
+		return nil
+	}
+
+	header := h.Clone()
+	header.Del(c.tagHeader)
+	header.Del(StatusHeader)
+	header.Del("Age")
+
+	return &entry{
+		Key:            variantKey(primary, names, r.Header),
+		Primary:        primary,
+		Host:           strings.ToLower(r.Host),
+		Path:           r.URL.Path,
+		Tags:           tags(h.Values(c.tagHeader)),
+		Vary:           names,
+		Status:         cw.status,
+		Header:         header,
+		Body:           cw.body,
+		Stored:         now,
+		InitialAge:     initialAge(h),
+		TTL:            ttl,
+		SWR:            swr,
+		MustRevalidate: mustRevalidate,
+	}
+}
+
+func (c *Cache) write(w http.ResponseWriter, r *http.Request, e *entry, now time.Time, status Status) {
+	h := w.Header()
+	for name, values := range e.Header {
+		h[name] = slices.Clone(values)
+	}
+
+	h.Set("Age", strconv.Itoa(int(e.age(now)/time.Second)))
+	h.Set(StatusHeader, string(status))
+
+	if notModified(r, e) {
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(e.Body)))
+	w.WriteHeader(e.Status)
+
+	if r.Method != http.MethodHead {
+		w.Write(e.Body)
+	}
+}
+
+func (c *Cache) join(key string) (*call, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if current, ok := c.calls[key]; ok {
+		return current, false
+	}
+
+	current := &call{done: make(chan struct{})}
+	c.calls[key] = current
+
+	return current, true
+}
+
+func (c *Cache) leave(key string, current *call) {
+	c.mu.Lock()
+	delete(c.calls, key)
+	c.mu.Unlock()
+
+	close(current.done)
+}
+
+func (e *entry) age(now time.Time) time.Duration {
+	return e.InitialAge + now.Sub(e.Stored)
+}
+
+// freshness returns how long a response stays fresh and may be served stale,
+// ok is false when it must not be stored
+func freshness(h http.Header, policy Policy, now time.Time) (ttl, swr time.Duration, mustRevalidate, ok bool) {
+	directives := parseCacheControl(h.Values("Cache-Control"))
+
+	swr, _ = seconds(directives, "stale-while-revalidate")
+
+	_, noCache := directives["no-cache"]
+	_, must := directives["must-revalidate"]
+	_, proxy := directives["proxy-revalidate"]
+	mustRevalidate = noCache || must || proxy
+
+	validator := h.Get("ETag") != "" || h.Get("Last-Modified") != ""
+
+	switch {
+	case noCache:
+		// stored, but every use has to be revalidated
+		return 0, 0, true, validator
+
+	case has(directives, "s-maxage"):
+		ttl, _ = seconds(directives, "s-maxage")
+
+	case has(directives, "max-age"):
+		ttl, _ = seconds(directives, "max-age")
+
+	case h.Get("Expires") != "":
+		expires, err := http.ParseTime(h.Get("Expires"))
+		if err != nil {
+			return 0, 0, false, false
+		}
+
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = now
+		}
+
+		ttl = expires.Sub(date)
+
+	case policy.DefaultTTL > 0:
+		ttl = time.Duration(policy.DefaultTTL) * time.Second
+
+	default:
+		return 0, 0, false, false
+	}
+
+	if ttl <= 0 && !validator && swr == 0 {
+		return 0, 0, false, false
+	}
+
+	return max(ttl, 0), swr, mustRevalidate, true
+}
+
+func parseCacheControl(values []string) map[string]string {
+	directives := map[string]string{}
+
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+
+			directives[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+
+	return directives
+}
+
+func has(directives map[string]string, name string) bool {
+	_, ok := directives[name]
+	return ok
+}
+
+func seconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return time.Duration(n) * time.Second, true
+}
+
+func initialAge(h http.Header) time.Duration {
+	age, err := strconv.ParseInt(h.Get("Age"), 10, 64)
+	if err != nil || age < 0 {
+		return 0
+	}
+
+	return time.Duration(age) * time.Second
+}
+
+// primaryKey keeps the responses of the HTTP and HTTPS listeners apart, they may
+// differ by their redirects and absolute links
+func primaryKey(r *http.Request) string {
+	scheme := "http://"
+	if r.TLS != nil {
+		scheme = "https://"
+	}
+
+	return scheme + strings.ToLower(r.Host) + r.URL.RequestURI()
+}
+
+// variantKey extends primary with the request's values of the Vary header fields
+func variantKey(primary string, names []string, h http.Header) string {
+	var b strings.Builder
+	b.WriteString(primary)
+	b.WriteByte(0)
+
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strings.Join(h.Values(name), ","))
+		b.WriteByte(0)
+	}
+
+	return b.String()
+}
+
+func varyNames(h http.Header) []string {
+	names := []string{}
+
+	for _, value := range h.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+func tags(values []string) []string {
+	result := []string{}
+
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				result = append(result, tag)
+			}
+		}
+	}
+
+	return result
+}
+
+// notModified evaluates the client's conditional headers against e, RFC 9110 section 13.2.2
+func notModified(r *http.Request, e *entry) bool {
+	if e.Status != http.StatusOK {
+		return false
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(e.Header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	modified, err := http.ParseTime(e.Header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+func (cw *captureWriter) Header() http.Header {
+	return cw.header
+}
+
+func (cw *captureWriter) WriteHeader(statusCode int) {
+	if cw.wroteHeader {
+		return
+	}
+
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		if cw.w != nil && !cw.holdNotMod {
+			cw.w.WriteHeader(statusCode)
+		}
+		return
+	}
+
+	cw.wroteHeader = true
+	cw.status = statusCode
+	cw.snapshot = cw.header.Clone()
+
+	// a 304 to our own revalidation is answered from the stored entry instead
+	cw.forward = cw.w != nil && !(cw.holdNotMod && statusCode == http.StatusNotModified)
+	if !cw.forward {
+		return
+	}
+
+	h := cw.w.Header()
+	for name, values := range cw.header {
+		if name != cw.tagHeader {
+			h[name] = values
+		}
+	}
+	h.Set(StatusHeader, string(Miss))
+
+	cw.w.WriteHeader(statusCode)
+}
+
+func (cw *captureWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.overflow {
+		if int64(len(cw.body)+len(p)) > cw.max {
+			cw.overflow = true
+			cw.body = nil
+		} else {
+			cw.body = append(cw.body, p...)
+		}
+	}
+
+	if cw.forward {
+		return cw.w.Write(p)
+	}
+
+	return len(p), nil
+}
+
+func (cw *captureWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.forward {
+		http.NewResponseController(cw.w).Flush()
+	}
+}
@@ -0,0 +1,440 @@
+package cache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var policy = Policy{Enabled: true}
+
+type upstream struct {
+	calls   atomic.Int32
+	handler http.HandlerFunc
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.calls.Add(1)
+	u.handler(w, r)
+}
+
+func newCache(t *testing.T, config Config) (*Cache, *time.Time) {
+	t.Helper()
+
+	c, err := New(config)
+	assert.NoError(t, err)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	return c, &now
+}
+
+func get(c *Cache, next http.Handler, path string, header ...string) (*httptest.ResponseRecorder, Status) {
+	req := httptest.NewRequest(http.MethodGet, "http://domain.com"+path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	status := c.Serve(rec, req, policy, next)
+
+	return rec, status
+}
+
+func TestServe(t *testing.T) {
+	c, now := newCache(t, Config{})
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Cache-Tag", "assets")
+		io.WriteString(w, "hello")
+	}}
+
+	rec, status := get(c, u, "/a")
+	assert.Equal(t, Miss, status)
+	assert.Equal(t, "MISS", rec.Header().Get(StatusHeader))
+	assert.Empty(t, rec.Header().Get("Cache-Tag"))
+	assert.Equal(t, "hello", rec.Body.String())
+
+	*now = now.Add(10 * time.Second)
+
+	rec, status = get(c, u, "/a")
+	assert.Equal(t, Hit, status)
+	assert.Equal(t, "10", rec.Header().Get("Age"))
+	assert.Equal(t, "hello", rec.Body.String())
+	assert.Equal(t, int32(1), u.calls.Load())
+
+	*now = now.Add(time.Minute)
+
+	_, status = get(c, u, "/a")
+	assert.Equal(t, Miss, status)
+	assert.Equal(t, int32(2), u.calls.Load())
+}
+
+func TestNotStored(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []string
+		handler http.HandlerFunc
+	}{
+		{"No store", nil, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-store")
+		}},
+		{"Private", nil, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		}},
+		{"Set-Cookie", nil, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Set-Cookie", "session=1")
+		}},
+		{"Vary *", nil, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "*")
+		}},
+		{"No freshness", nil, func(w http.ResponseWriter, r *http.Request) {}},
+		{"Server error", nil, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.WriteHeader(http.StatusBadGateway)
+		}},
+		{"Authorized", []string{"Authorization", "Bearer token"}, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+		}},
+		{"Request no-store", []string{"Cache-Control", "no-store"}, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newCache(t, Config{})
+			u := &upstream{handler: tt.handler}
+
+			get(c, u, "/a", tt.request...)
+			get(c, u, "/a", tt.request...)
+
+			assert.Equal(t, int32(2), u.calls.Load())
+		})
+	}
+}
+
+func TestExpires(t *testing.T) {
+	c, now := newCache(t, Config{})
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", now.Format(http.TimeFormat))
+		w.Header().Set("Expires", now.Add(30*time.Second).Format(http.TimeFormat))
+	}}
+
+	get(c, u, "/a")
+	*now = now.Add(20 * time.Second)
+
+	_, status := get(c, u, "/a")
+	assert.Equal(t, Hit, status)
+}
+
+func TestDefaultTTL(t *testing.T) {
+	c, _ := newCache(t, Config{})
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://domain.com/a", nil)
+	c.Serve(httptest.NewRecorder(), req, Policy{Enabled: true, DefaultTTL: 60}, u)
+	status := c.Serve(httptest.NewRecorder(), req, Policy{Enabled: true, DefaultTTL: 60}, u)
+
+	assert.Equal(t, Hit, status)
+}
+
+func TestVary(t *testing.T) {
+	c, _ := newCache(t, Config{})
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		io.WriteString(w, r.Header.Get("Accept-Language"))
+	}}
+
+	get(c, u, "/a", "Accept-Language", "en")
+	get(c, u, "/a", "Accept-Language", "fr")
+
+	rec, status := get(c, u, "/a", "Accept-Language", "en")
+	assert.Equal(t, Hit, status)
+	assert.Equal(t, "en", rec.Body.String())
+
+	rec, status = get(c, u, "/a", "Accept-Language", "fr")
+	assert.Equal(t, Hit, status)
+	assert.Equal(t, "fr", rec.Body.String())
+
+	assert.Equal(t, int32(2), u.calls.Load())
+}
+
+func TestScheme(t *testing.T) {
+	c, _ := newCache(t, Config{})
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.TLS == nil {
+			http.Redirect(w, r, "https://domain.com"+r.URL.Path, http.StatusMovedPermanently)
+			return
+		}
+		io.WriteString(w, "secure")
+	}}
+
+	serve := func(url string) (*httptest.ResponseRecorder, Status) {
+		rec := httptest.NewRecorder()
+		return rec, c.Serve(rec, httptest.NewRequest(http.MethodGet, url, nil), policy, u)
+	}
+
+	serve("http://domain.com/a")
+
+	rec, status := serve("https://domain.com/a")
+	assert.Equal(t, Miss, status)
+	assert.Equal(t, "secure", rec.Body.String())
+
+	rec, status = serve("http://domain.com/a")
+	assert.Equal(t, Hit, status)
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+
+	rec, status = serve("https://domain.com/a")
+	assert.Equal(t, Hit, status)
+	assert.Equal(t, "secure", rec.Body.String())
+}
+
+func TestRevalidate(t *testing.T) {
+	c, now := newCache(t, Config{})
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=10")
+		w.Header().Set("ETag", `"v1"`)
+
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		io.WriteString(w, "hello")
+	}}
+
+	get(c, u, "/a")
+	*now = now.Add(time.Minute)
+
+	rec, status := get(c, u, "/a")
+	assert.Equal(t, Revalidated, status)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "hello", rec.Body.String())
+
+	_, status = get(c, u, "/a")
+	assert.Equal(t, Hit, status)
+	assert.Equal(t, int32(2), u.calls.Load())
+
+	rec, status = get(c, u, "/a", "If-None-Match", `"v1"`)
+	assert.Equal(t, Hit, status)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	c, now := newCache(t, Config{})
+
+	var version atomic.Int32
+	revalidated := make(chan struct{}, 1)
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=10, stale-while-revalidate=30")
+		io.WriteString(w, "v"+string(rune('0'+version.Add(1))))
+
+		if version.Load() > 1 {
+			revalidated <- struct{}{}
+		}
+	}}
+
+	get(c, u, "/a")
+	*now = now.Add(20 * time.Second)
+
+	rec, status := get(c, u, "/a")
+	assert.Equal(t, Stale, status)
+	assert.Equal(t, "v1", rec.Body.String())
+
+	select {
+	case <-revalidated:
+	case <-time.After(time.Second):
+		t.Fatal("stale entry was not revalidated")
+	}
+
+	assert.Eventually(t, func() bool {
+		rec, status := get(c, u, "/a")
+		return status == Hit && rec.Body.String() == "v2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestCollapse(t *testing.T) {
+	c, _ := newCache(t, Config{})
+
+	release := make(chan struct{})
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, "hello")
+	}}
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 10)
+
+	for i := range bodies {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec, _ := get(c, u, "/a")
+			bodies[i] = rec.Body.String()
+		}()
+	}
+
+	assert.Eventually(t, func() bool { return u.calls.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), u.calls.Load())
+	for _, body := range bodies {
+		assert.Equal(t, "hello", body)
+	}
+}
+
+func TestUnsafeMethodInvalidates(t *testing.T) {
+	c, _ := newCache(t, Config{})
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+	}}
+
+	get(c, u, "/a")
+
+	req := httptest.NewRequest(http.MethodPost, "http://domain.com/a", nil)
+	status := c.Serve(httptest.NewRecorder(), req, policy, u)
+	assert.Equal(t, Bypass, status)
+
+	_, status = get(c, u, "/a")
+	assert.Equal(t, Miss, status)
+}
+
+func TestPurge(t *testing.T) {
+	c, _ := newCache(t, Config{})
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		if strings.HasPrefix(r.URL.Path, "/assets") {
+			w.Header().Set("Cache-Tag", "assets, v1")
+		}
+	}}
+
+	for _, path := range []string{"/", "/assets/app.js", "/assets/app.css", "/api/users"} {
+		get(c, u, path)
+	}
+
+	other := httptest.NewRequest(http.MethodGet, "http://other.com/", nil)
+	c.Serve(httptest.NewRecorder(), other, policy, u)
+
+	entries, _ := c.Stats()
+	assert.Equal(t, 5, entries)
+
+	assert.Equal(t, 0, c.Purge(Filter{Tags: []string{"v2"}}))
+	assert.Equal(t, 2, c.Purge(Filter{Tags: []string{"v1"}}))
+	assert.Equal(t, 1, c.Purge(Filter{Host: "domain.com", Prefix: "/api"}))
+	assert.Equal(t, 1, c.Purge(Filter{Host: "OTHER.com"}))
+
+	entries, _ = c.Stats()
+	assert.Equal(t, 1, entries)
+
+	_, status := get(c, u, "/assets/app.js")
+	assert.Equal(t, Miss, status)
+}
+
+func TestEviction(t *testing.T) {
+	body := strings.Repeat("x", 400)
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, body)
+	}}
+
+	t.Run("Memory only", func(t *testing.T) {
+		c, _ := newCache(t, Config{MaxSize: 1000})
+
+		get(c, u, "/a")
+		get(c, u, "/b")
+		get(c, u, "/a")
+		get(c, u, "/c")
+
+		entries, size := c.Stats()
+		assert.Equal(t, 2, entries)
+		assert.LessOrEqual(t, size, int64(1000))
+
+		_, status := get(c, u, "/a")
+		assert.Equal(t, Hit, status)
+
+		_, status = get(c, u, "/b")
+		assert.Equal(t, Miss, status)
+	})
+
+	t.Run("Disk tier", func(t *testing.T) {
+		c, _ := newCache(t, Config{MaxSize: 1000, DiskPath: t.TempDir()})
+
+		get(c, u, "/a")
+		get(c, u, "/b")
+		get(c, u, "/c")
+
+		entries, _ := c.Stats()
+		assert.Equal(t, 3, entries)
+
+		calls := u.calls.Load()
+		rec, status := get(c, u, "/a")
+		assert.Equal(t, Hit, status)
+		assert.Equal(t, body, rec.Body.String())
+		assert.Equal(t, calls, u.calls.Load())
+	})
+
+	t.Run("Concurrent disk tier", func(t *testing.T) {
+		c, _ := newCache(t, Config{MaxSize: 1000, DiskPath: t.TempDir()})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, path := range []string{"/a", "/b", "/c", "/d"} {
+					rec, _ := get(c, u, path)
+					assert.Equal(t, body, rec.Body.String())
+				}
+			}()
+		}
+		wg.Wait()
+
+		entries, size := c.Stats()
+		assert.Equal(t, 4, entries)
+		assert.Positive(t, size)
+	})
+}
+
+func TestMaxEntrySize(t *testing.T) {
+	c, _ := newCache(t, Config{MaxEntrySize: 4})
+
+	u := &upstream{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, "hello")
+	}}
+
+	rec, _ := get(c, u, "/a")
+	assert.Equal(t, "hello", rec.Body.String())
+
+	_, status := get(c, u, "/a")
+	assert.Equal(t, Miss, status)
+}
@@ -0,0 +1,323 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const diskExt = ".cache"
+
+func newLRU(max int64) *lru {
+	return &lru{
+		max:   max,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+	}
+}
+
+func (l *lru) get(key string) *record {
+	el, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+
+	l.ll.MoveToFront(el)
+	return el.Value.(*record)
+}
+
+func (l *lru) push(rec *record) {
+	l.items[rec.key] = l.ll.PushFront(rec)
+	l.size += rec.size
+}
+
+func (l *lru) remove(key string) *record {
+	el, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+
+	rec := el.Value.(*record)
+	l.ll.Remove(el)
+	delete(l.items, key)
+	l.size -= rec.size
+
+	return rec
+}
+
+func (l *lru) oldest() *record {
+	el := l.ll.Back()
+	if el == nil {
+		return nil
+	}
+
+	return el.Value.(*record)
+}
+
+// newDisk prepares dir, entries left by a previous run are removed since their index is gone
+func newDisk(dir string, max int64) (*disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	stale, err := filepath.Glob(filepath.Join(dir, "*"+diskExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range stale {
+		os.Remove(file)
+	}
+
+	return &disk{lru: newLRU(max), dir: dir}, nil
+}
+
+func (d *disk) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+diskExt)
+}
+
+// write stores e in its file and returns the size it takes, entries larger than the tier are skipped
+func (d *disk) write(e *entry) (int64, bool) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		log.Error().Err(err).Str("key", e.Key).Msg("cache")
+		return 0, false
+	}
+
+	if int64(buf.Len()) > d.max {
+		return 0, false
+	}
+
+	if err := os.WriteFile(d.file(e.Key), buf.Bytes(), 0o644); err != nil {
+		log.Error().Err(err).Str("key", e.Key).Msg("cache")
+		return 0, false
+	}
+
+	return int64(buf.Len()), true
+}
+
+// load reads the entry stored under key and removes its file
+func (d *disk) load(key string) *entry {
+	file := d.file(key)
+	defer os.Remove(file)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("cache")
+		return nil
+	}
+
+	e := &entry{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(e); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("cache")
+		return nil
+	}
+
+	return e
+}
+
+func newRecord(e *entry) *record {
+	size := int64(len(e.Key) + len(e.Body))
+	for name, values := range e.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+
+	return &record{
+		key:     e.Key,
+		primary: e.Primary,
+		host:    e.Host,
+		path:    e.Path,
+		tags:    e.Tags,
+		size:    size,
+		entry:   e,
+	}
+}
+
+// get returns the entry stored under key, an entry found on disk moves back to memory.
+// The disk index only changes under the lock, its files are read and written after it is released
+func (s *store) get(key string) *entry {
+	s.mu.Lock()
+	if rec := s.memory.get(key); rec != nil {
+		s.mu.Unlock()
+		return rec.entry
+	}
+
+	if s.disk == nil || s.disk.remove(key) == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	e := s.disk.load(key)
+	if e == nil {
+		return nil
+	}
+
+	var ops diskOps
+
+	s.mu.Lock()
+	// a response stored meanwhile is newer than the one read back
+	if _, ok := s.memory.items[key]; !ok {
+		s.put(e, &ops)
+	}
+	s.mu.Unlock()
+
+	s.flush(ops)
+	return e
+}
+
+// put stores e in memory, the least recently used entries are queued on ops to move to disk when it is full
+func (s *store) put(e *entry, ops *diskOps) {
+	s.memory.remove(e.Key)
+	if s.disk != nil && s.disk.remove(e.Key) != nil {
+		ops.removes = append(ops.removes, e.Key)
+	}
+
+	rec := newRecord(e)
+	if rec.size > s.memory.max {
+		if s.disk != nil {
+			ops.writes = append(ops.writes, e)
+		}
+		return
+	}
+
+	s.memory.push(rec)
+
+	for s.memory.size > s.memory.max {
+		evicted := s.memory.remove(s.memory.oldest().key)
+		if s.disk != nil {
+			ops.writes = append(ops.writes, evicted.entry)
+		}
+	}
+}
+
+func (s *store) set(e *entry) {
+	var ops diskOps
+
+	s.mu.Lock()
+	s.vary[e.Primary] = e.Vary
+	s.put(e, &ops)
+	s.mu.Unlock()
+
+	s.flush(ops)
+}
+
+// flush carries out the disk work queued under the lock, taking it again only to update the index
+func (s *store) flush(ops diskOps) {
+	for _, key := range ops.removes {
+		os.Remove(s.disk.file(key))
+	}
+
+	for _, e := range ops.writes {
+		size, ok := s.disk.write(e)
+		if !ok {
+			continue
+		}
+
+		rec := newRecord(e)
+		rec.size = size
+		rec.entry = nil
+
+		var evicted []string
+
+		s.mu.Lock()
+		s.disk.remove(e.Key)
+		s.disk.push(rec)
+		for s.disk.size > s.disk.max {
+			evicted = append(evicted, s.disk.remove(s.disk.oldest().key).key)
+		}
+		s.mu.Unlock()
+
+		for _, key := range evicted {
+			os.Remove(s.disk.file(key))
+		}
+	}
+}
+
+func (s *store) varyOf(primary string) ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names, ok := s.vary[primary]
+	return names, ok
+}
+
+func (s *store) purge(match func(rec *record) bool) int {
+	s.mu.Lock()
+
+	purged := 0
+	primaries := map[string]bool{}
+
+	for key, el := range s.memory.items {
+		if rec := el.Value.(*record); match(rec) {
+			s.memory.remove(key)
+			primaries[rec.primary] = true
+			purged++
+		}
+	}
+
+	var removed []string
+	if s.disk != nil {
+		for key, el := range s.disk.items {
+			if rec := el.Value.(*record); match(rec) {
+				s.disk.remove(key)
+				removed = append(removed, key)
+				primaries[rec.primary] = true
+				purged++
+			}
+		}
+	}
+
+	for primary := range primaries {
+		if !s.has(primary) {
+			delete(s.vary, primary)
+		}
+	}
+
+	s.mu.Unlock()
+
+	s.flush(diskOps{removes: removed})
+
+	return purged
+}
+
+func (s *store) has(primary string) bool {
+	for key := range s.memory.items {
+		if strings.HasPrefix(key, primary+"\x00") {
+			return true
+		}
+	}
+
+	if s.disk != nil {
+		for key := range s.disk.items {
+			if strings.HasPrefix(key, primary+"\x00") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (s *store) stats() (entries int, size int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, size = len(s.memory.items), s.memory.size
+	if s.disk != nil {
+		entries += len(s.disk.items)
+		size += s.disk.size
+	}
+
+	return entries, size
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Status describes how a request was answered, it is sent to clients in the X-Cache header
+type Status string
+
+const (
+	Hit         Status = "HIT"
+	Miss        Status = "MISS"
+	Stale       Status = "STALE"
+	Revalidated Status = "REVALIDATED"
+	Bypass      Status = "BYPASS"
+)
+
+const StatusHeader = "X-Cache"
+
+// Config sizes the shared store, sizes are in bytes
+type Config struct {
+	MaxSize      int64  `yaml:"max_size,omitempty"`
+	MaxEntrySize int64  `yaml:"max_entry_size,omitempty"`
+	TagHeader    string `yaml:"tag_header,omitempty"`
+	DiskPath     string `yaml:"disk_path,omitempty"`
+	DiskMaxSize  int64  `yaml:"disk_max_size,omitempty"`
+}
+
+// Policy enables caching on a route, DefaultTTL (seconds) applies to
+// responses without explicit freshness information
+type Policy struct {
+	Enabled    bool  `yaml:"enabled"`
+	DefaultTTL int64 `yaml:"default_ttl,omitempty"`
+}
+
+// Filter selects entries to purge, set fields must all match
+type Filter struct {
+	Host   string   `json:"host,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+type Cache struct {
+	store        *store
+	maxEntrySize int64
+	tagHeader    string
+
+	mu    sync.Mutex
+	calls map[string]*call
+
+	now func() time.Time
+}
+
+type call struct {
+	done chan struct{}
+}
+
+type entry struct {
+	Key     string
+	Primary string
+	Host    string
+	Path    string
+	Tags    []string
+	Vary    []string
+
+	Status int
+	Header http.Header
+	Body   []byte
+
+	Stored         time.Time
+	InitialAge     time.Duration
+	TTL            time.Duration
+	SWR            time.Duration
+	MustRevalidate bool
+}
+
+type store struct {
+	mu     sync.Mutex
+	memory *lru
+	disk   *disk
+	vary   map[string][]string
+}
+
+// record is an LRU element, entry is nil once the record lives on disk
+type record struct {
+	key     string
+	primary string
+	host    string
+	path    string
+	tags    []string
+	size    int64
+	entry   *entry
+}
+
+type lru struct {
+	max   int64
+	size  int64
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type disk struct {
+	*lru
+	dir string
+}
+
+// diskOps is the disk work decided under the store lock and carried out once it is released
+type diskOps struct {
+	writes  []*entry
+	removes []string
+}
+
+type captureWriter struct {
+	w         http.ResponseWriter
+	header    http.Header
+	tagHeader string
+
+	status      int
+	wroteHeader bool
+	forward     bool
+	holdNotMod  bool
+	snapshot    http.Header
+
+	body     []byte
+	max      int64
+	overflow bool
+}
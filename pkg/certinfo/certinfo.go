@@ -0,0 +1,146 @@
+// Package certinfo describes certificates and the outcome of their renewals
+package certinfo
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// New describes cert, Leaf is parsed when it isn't set
+func New(cert *tls.Certificate, source string) (Info, error) {
+	if cert == nil || len(cert.Certificate) == 0 {
+		return Info{}, errors.New("empty certificate")
+	}
+
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return Info{}, err
+		}
+	}
+
+	info := Info{
+		Names:     Names(leaf),
+		Subject:   leaf.Subject.String(),
+		Issuer:    leaf.Issuer.String(),
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+		Source:    source,
+		OCSP:      OCSPNone,
+	}
+
+	sum := sha256.Sum256(leaf.Raw)
+	info.Fingerprint = hex.EncodeToString(sum[:])
+
+	if len(cert.OCSPStaple) > 0 {
+		info.OCSP = ocspStatus(cert)
+	}
+
+	return info, nil
+}
+
+// Names returns the SANs of cert, its common name when it has none
+func Names(cert *x509.Certificate) []string {
+	names := make([]string, 0, len(cert.DNSNames)+len(cert.IPAddresses))
+	names = append(names, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+
+	if len(names) == 0 && cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+
+	return names
+}
+
+func ocspStatus(cert *tls.Certificate) string {
+	var issuer *x509.Certificate
+	if len(cert.Certificate) > 1 {
+		issuer, _ = x509.ParseCertificate(cert.Certificate[1])
+	}
+
+	resp, err := ocsp.ParseResponse(cert.OCSPStaple, issuer)
+	if err != nil {
+		return OCSPUnknown
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		return OCSPGood
+	case ocsp.Revoked:
+		return OCSPRevoked
+	default:
+		return OCSPUnknown
+	}
+}
+
+// Expiring tells whether the certificate expires within d of now
+func (i Info) Expiring(now time.Time, d time.Duration) bool {
+	return i.NotAfter.Sub(now) <= d
+}
+
+// NewTracker returns an empty tracker
+func NewTracker() *Tracker {
+	return &Tracker{attempts: make(map[string]Attempt)}
+}
+
+// Record stores the outcome of an attempt for name, err is nil when it succeeded
+func (t *Tracker) Record(name string, err error) {
+	attempt := Attempt{Time: time.Now()}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.attempts[strings.ToLower(name)] = attempt
+}
+
+// Get returns the last attempt for name
+func (t *Tracker) Get(name string) (Attempt, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	attempt, ok := t.attempts[strings.ToLower(name)]
+	return attempt, ok
+}
+
+// Names returns every name with a recorded attempt
+func (t *Tracker) Names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	names := make([]string, 0, len(t.attempts))
+	for name := range t.attempts {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// Annotate sets the last attempt on info, the latest one among its names
+func (t *Tracker) Annotate(info *Info) {
+	var last Attempt
+	for _, name := range info.Names {
+		if attempt, ok := t.Get(name); ok && attempt.Time.After(last.Time) {
+			last = attempt
+		}
+	}
+
+	if last.Time.IsZero() {
+		return
+	}
+
+	info.LastRenewal = &last.Time
+	info.LastError = last.Error
+}
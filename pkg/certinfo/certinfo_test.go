@@ -0,0 +1,141 @@
+package certinfo
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Dyastin-0/mrps/internal/testcert"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+// staple signs an OCSP response with status for cert
+func staple(t *testing.T, ca *testcert.CA, cert *tls.Certificate, status int) []byte {
+	t.Helper()
+
+	resp, err := ocsp.CreateResponse(ca.Cert, ca.Cert, ocsp.Response{
+		Status:       status,
+		SerialNumber: cert.Leaf.SerialNumber,
+		ThisUpdate:   time.Now(),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now(),
+	}, crypto.Signer(ca.Key))
+	assert.NoError(t, err)
+
+	return resp
+}
+
+func TestNew(t *testing.T) {
+	ca := testcert.NewCA(t)
+	notAfter := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+
+	t.Run("Names", func(t *testing.T) {
+		cert := ca.Issue(t, &x509.Certificate{
+			Subject:     pkix.Name{CommonName: "domain.com"},
+			DNSNames:    []string{"domain.com", "*.domain.com"},
+			IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+			NotAfter:    notAfter,
+		})
+
+		info, err := New(cert, "acme")
+		assert.NoError(t, err)
+
+		assert.Equal(t, []string{"domain.com", "*.domain.com", "10.0.0.1"}, info.Names)
+		assert.Equal(t, "CN=domain.com", info.Subject)
+		assert.Equal(t, "CN=mrps test ca", info.Issuer)
+		assert.True(t, notAfter.Equal(info.NotAfter))
+		assert.Equal(t, "acme", info.Source)
+		assert.Len(t, info.Fingerprint, 64)
+		assert.Equal(t, OCSPNone, info.OCSP)
+	})
+
+	t.Run("Common name only", func(t *testing.T) {
+		info, err := New(ca.Issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "internal"}}), "file")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"internal"}, info.Names)
+	})
+
+	t.Run("OCSP", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			status int
+			want   string
+		}{
+			{"Good", ocsp.Good, OCSPGood},
+			{"Revoked", ocsp.Revoked, OCSPRevoked},
+			{"Unknown", ocsp.Unknown, OCSPUnknown},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cert := ca.Issue(t, &x509.Certificate{DNSNames: []string{"domain.com"}})
+				cert.OCSPStaple = staple(t, ca, cert, tt.status)
+
+				info, err := New(cert, "acme")
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, info.OCSP)
+			})
+		}
+
+		cert := ca.Issue(t, &x509.Certificate{DNSNames: []string{"domain.com"}})
+		cert.OCSPStaple = []byte("garbage")
+
+		info, err := New(cert, "acme")
+		assert.NoError(t, err)
+		assert.Equal(t, OCSPUnknown, info.OCSP)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		_, err := New(&tls.Certificate{}, "acme")
+		assert.Error(t, err)
+
+		_, err = New(nil, "acme")
+		assert.Error(t, err)
+	})
+}
+
+func TestExpiring(t *testing.T) {
+	now := time.Now()
+	info := Info{NotAfter: now.Add(72 * time.Hour)}
+
+	assert.False(t, info.Expiring(now, 48*time.Hour))
+	assert.True(t, info.Expiring(now, 72*time.Hour))
+	assert.True(t, info.Expiring(now.Add(96*time.Hour), 0))
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker()
+
+	_, ok := tracker.Get("domain.com")
+	assert.False(t, ok)
+
+	tracker.Record("Domain.com", nil)
+
+	attempt, ok := tracker.Get("domain.com")
+	assert.True(t, ok)
+	assert.Empty(t, attempt.Error)
+
+	t.Run("Annotate", func(t *testing.T) {
+		info := Info{Names: []string{"domain.com", "www.domain.com"}}
+		tracker.Annotate(&info)
+		assert.NotNil(t, info.LastRenewal)
+		assert.Empty(t, info.LastError)
+
+		// the latest attempt among the names wins
+		tracker.Record("www.domain.com", errors.New("rate limited"))
+		tracker.Annotate(&info)
+		assert.Equal(t, "rate limited", info.LastError)
+
+		other := Info{Names: []string{"other.com"}}
+		tracker.Annotate(&other)
+		assert.Nil(t, other.LastRenewal)
+	})
+
+	assert.ElementsMatch(t, []string{"domain.com", "www.domain.com"}, tracker.Names())
+}
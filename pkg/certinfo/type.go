@@ -0,0 +1,56 @@
+package certinfo
+
+import (
+	"sync"
+	"time"
+)
+
+// OCSP statuses of a certificate, None when no response is stapled
+const (
+	OCSPGood    = "good"
+	OCSPRevoked = "revoked"
+	OCSPUnknown = "unknown"
+	OCSPNone    = "none"
+)
+
+// alert reasons
+const (
+	ReasonRenewalFailed = "renewal_failed"
+	ReasonExpiring      = "expiring"
+	ReasonRevoked       = "revoked"
+)
+
+// Info describes a certificate served by the proxy. LastRenewal and LastError
+// come from the last attempt to obtain or renew it, if there was one
+type Info struct {
+	Names       []string   `json:"names"`
+	Subject     string     `json:"subject"`
+	Issuer      string     `json:"issuer"`
+	NotBefore   time.Time  `json:"not_before"`
+	NotAfter    time.Time  `json:"not_after"`
+	Source      string     `json:"source"`
+	Fingerprint string     `json:"fingerprint"`
+	OCSP        string     `json:"ocsp"`
+	LastRenewal *time.Time `json:"last_renewal,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// Attempt is the outcome of obtaining or renewing the certificate of a name
+type Attempt struct {
+	Time  time.Time
+	Error string
+}
+
+// Alert is raised when a certificate needs attention
+type Alert struct {
+	Reason   string    `json:"reason"`
+	Names    []string  `json:"names"`
+	NotAfter time.Time `json:"not_after,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Tracker keeps the last attempt of each name
+type Tracker struct {
+	mu       sync.RWMutex
+	attempts map[string]Attempt
+}
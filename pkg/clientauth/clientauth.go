@@ -0,0 +1,174 @@
+package clientauth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var ErrNotAllowed = errors.New("client certificate not allowed")
+
+// New loads the CA and allow rules of config
+func New(config Config) (*Verifier, error) {
+	if config.CA == "" {
+		return nil, fmt.Errorf("client auth requires a ca")
+	}
+
+	data, err := os.ReadFile(config.CA)
+	if err != nil {
+		return nil, fmt.Errorf("client auth ca: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("client auth ca: no certificates found in %s", config.CA)
+	}
+
+	v := &Verifier{
+		pool:         pool,
+		subjects:     make(map[string]bool),
+		sans:         make(map[string]bool),
+		fingerprints: make(map[string]bool),
+	}
+
+	switch config.Mode {
+	case "", ModeRequire:
+		v.clientAuth = tls.RequireAndVerifyClientCert
+	case ModeOptional:
+		v.clientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("unsupported client auth mode: %s", config.Mode)
+	}
+
+	for _, subject := range config.Allow.Subjects {
+		v.subjects[subject] = true
+	}
+
+	for _, san := range config.Allow.SANs {
+		v.sans[san] = true
+	}
+
+	for _, fingerprint := range config.Allow.Fingerprints {
+		v.fingerprints[normalizeFingerprint(fingerprint)] = true
+	}
+
+	return v, nil
+}
+
+// Required reports whether clients without a certificate are refused
+func (v *Verifier) Required() bool {
+	return v.clientAuth == tls.RequireAndVerifyClientCert
+}
+
+// TLSConfig returns a copy of base asking clients for a certificate signed by the CA,
+// certificates outside the allow rules fail the handshake
+func (v *Verifier) TLSConfig(base *tls.Config) *tls.Config {
+	config := base.Clone()
+	config.ClientAuth = v.clientAuth
+	config.ClientCAs = v.pool
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		cert := Peer(&state)
+		if cert == nil {
+			return nil
+		}
+
+		if !v.Allowed(cert) {
+			return fmt.Errorf("%w: %s", ErrNotAllowed, cert.Subject)
+		}
+
+		return nil
+	}
+
+	return config
+}
+
+// Allowed checks cert against the allow rules
+func (v *Verifier) Allowed(cert *x509.Certificate) bool {
+	if len(v.subjects) == 0 && len(v.sans) == 0 && len(v.fingerprints) == 0 {
+		return true
+	}
+
+	if v.subjects[cert.Subject.String()] || v.fingerprints[Fingerprint(cert)] {
+		return true
+	}
+
+	for _, san := range SANs(cert) {
+		if v.sans[san] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Peer returns the verified client certificate of a connection, if any
+func Peer(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
+// SANs lists the DNS, email, IP and URI names of cert
+func SANs(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.IPAddresses)+len(cert.URIs))
+
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+
+	return sans
+}
+
+// Fingerprint is the lowercase hex SHA-256 of the DER encoded cert
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
+
+// DelHeaders removes the identity headers from h, whoever sent them
+func DelHeaders(h http.Header) {
+	h.Del(HeaderVerified)
+	h.Del(HeaderSubject)
+	h.Del(HeaderSAN)
+	h.Del(HeaderFingerprint)
+	h.Del(HeaderCert)
+}
+
+// SetHeaders replaces the identity headers in h with the ones of cert, a nil cert is forwarded as unverified
+func SetHeaders(h http.Header, cert *x509.Certificate) {
+	DelHeaders(h)
+
+	if cert == nil {
+		h.Set(HeaderVerified, "NONE")
+		return
+	}
+
+	h.Set(HeaderVerified, "SUCCESS")
+	h.Set(HeaderSubject, cert.Subject.String())
+	h.Set(HeaderFingerprint, Fingerprint(cert))
+	if sans := SANs(cert); len(sans) > 0 {
+		h.Set(HeaderSAN, strings.Join(sans, ","))
+	}
+
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	h.Set(HeaderCert, url.PathEscape(string(block)))
+}
@@ -0,0 +1,167 @@
+package clientauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Dyastin-0/mrps/internal/testcert"
+	"github.com/stretchr/testify/assert"
+)
+
+// issue signs a client certificate for cn with dns as its SAN
+func issue(t *testing.T, ca *testcert.CA, cn, dns string) tls.Certificate {
+	t.Helper()
+
+	return *ca.Issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: cn, Organization: []string{"Acme"}},
+		DNSNames:    []string{dns},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+func TestNew(t *testing.T) {
+	ca := testcert.NewCA(t)
+	caFile := testcert.WriteCert(t, t.TempDir(), "ca", ca.Cert)
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"Default mode", Config{CA: caFile}, false},
+		{"Optional", Config{CA: caFile, Mode: ModeOptional}, false},
+		{"Missing CA", Config{}, true},
+		{"Unreadable CA", Config{CA: "missing.pem"}, true},
+		{"Unknown mode", Config{CA: caFile, Mode: "sometimes"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	ca := testcert.NewCA(t)
+	caFile := testcert.WriteCert(t, t.TempDir(), "ca", ca.Cert)
+	cert := issue(t, ca, "api", "api.internal").Leaf
+
+	tests := []struct {
+		name  string
+		allow Allow
+		want  bool
+	}{
+		{"No rules", Allow{}, true},
+		{"Subject", Allow{Subjects: []string{"CN=api,O=Acme"}}, true},
+		{"SAN", Allow{SANs: []string{"api.internal"}}, true},
+		{"Fingerprint", Allow{Fingerprints: []string{Fingerprint(cert)}}, true},
+		{"Other subject", Allow{Subjects: []string{"CN=web,O=Acme"}}, false},
+		{"Other SAN", Allow{SANs: []string{"web.internal"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := New(Config{CA: caFile, Allow: tt.allow})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, v.Allowed(cert))
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	ca := testcert.NewCA(t)
+	caFile := testcert.WriteCert(t, t.TempDir(), "ca", ca.Cert)
+	allowed := issue(t, ca, "api", "api.internal")
+	denied := issue(t, ca, "web", "web.internal")
+	foreign := issue(t, testcert.NewCA(t), "api", "api.internal")
+
+	tests := []struct {
+		name    string
+		mode    string
+		certs   []tls.Certificate
+		wantErr bool
+	}{
+		{"Allowed", ModeRequire, []tls.Certificate{allowed}, false},
+		{"Not allowed", ModeRequire, []tls.Certificate{denied}, true},
+		{"Unknown CA", ModeRequire, []tls.Certificate{foreign}, true},
+		{"Missing", ModeRequire, nil, true},
+		{"Optional missing", ModeOptional, nil, false},
+		{"Optional not allowed", ModeOptional, []tls.Certificate{denied}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := New(Config{CA: caFile, Mode: tt.mode, Allow: Allow{SANs: []string{"api.internal"}}})
+			assert.NoError(t, err)
+
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			server.TLS = v.TLSConfig(&tls.Config{})
+			server.StartTLS()
+			defer server.Close()
+
+			client := server.Client()
+			client.Transport.(*http.Transport).TLSClientConfig.Certificates = tt.certs
+
+			resp, err := client.Get(server.URL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		})
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	cert := issue(t, testcert.NewCA(t), "api", "api.internal").Leaf
+
+	t.Run("Verified", func(t *testing.T) {
+		h := http.Header{}
+		h.Set(HeaderSubject, "CN=spoofed")
+
+		SetHeaders(h, cert)
+
+		assert.Equal(t, "SUCCESS", h.Get(HeaderVerified))
+		assert.Equal(t, "CN=api,O=Acme", h.Get(HeaderSubject))
+		assert.Equal(t, "api.internal", h.Get(HeaderSAN))
+		assert.Equal(t, Fingerprint(cert), h.Get(HeaderFingerprint))
+
+		escaped, err := url.PathUnescape(h.Get(HeaderCert))
+		assert.NoError(t, err)
+
+		block, _ := pem.Decode([]byte(escaped))
+		if assert.NotNil(t, block) {
+			assert.Equal(t, cert.Raw, block.Bytes)
+		}
+	})
+
+	t.Run("Unverified", func(t *testing.T) {
+		h := http.Header{}
+		h.Set(HeaderSubject, "CN=spoofed")
+		h.Set(HeaderCert, "spoofed")
+
+		SetHeaders(h, nil)
+
+		assert.Equal(t, "NONE", h.Get(HeaderVerified))
+		assert.Empty(t, h.Get(HeaderSubject))
+		assert.Empty(t, h.Get(HeaderCert))
+	})
+}
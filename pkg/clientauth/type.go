@@ -0,0 +1,48 @@
+package clientauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+const (
+	ModeRequire  = "require"
+	ModeOptional = "optional"
+)
+
+// headers carrying the verified identity to backends, clients cannot set them
+const (
+	HeaderVerified    = "X-Client-Cert-Verified"
+	HeaderSubject     = "X-Client-Cert-Subject"
+	HeaderSAN         = "X-Client-Cert-SAN"
+	HeaderFingerprint = "X-Client-Cert-Fingerprint"
+	HeaderCert        = "X-Client-Cert"
+)
+
+// Config verifies client certificates against the PEM bundle in CA, Mode is
+// ModeRequire (default) or ModeOptional which also accepts clients without one
+type Config struct {
+	CA    string `json:"ca,omitempty" yaml:"ca,omitempty"`
+	Mode  string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Allow Allow  `json:"allow,omitempty" yaml:"allow,omitempty"`
+}
+
+// Allow restricts the accepted certificates, a certificate matching any entry is allowed
+// and no entries allow every certificate signed by the CA. Subjects are in RFC 2253 form
+// such as "CN=api,O=Acme", SANs match DNS, email, IP and URI names and fingerprints are
+// SHA-256 in hex, with or without colons
+type Allow struct {
+	Subjects     []string `json:"subjects,omitempty" yaml:"subjects,omitempty"`
+	SANs         []string `json:"sans,omitempty" yaml:"sans,omitempty"`
+	Fingerprints []string `json:"fingerprints,omitempty" yaml:"fingerprints,omitempty"`
+}
+
+// Verifier is a loaded Config
+type Verifier struct {
+	pool       *x509.CertPool
+	clientAuth tls.ClientAuthType
+
+	subjects     map[string]bool
+	sans         map[string]bool
+	fingerprints map[string]bool
+}
@@ -0,0 +1,340 @@
+// Package compress implements gzip, brotli and zstd response compression
+// negotiated from the request's Accept-Encoding header.
+package compress
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const defaultMinSize = 1024
+
+var defaultAlgorithms = []string{Zstd, Brotli, Gzip}
+
+var defaultTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"application/manifest+json",
+	"application/ld+json",
+	"image/svg+xml",
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var pools = map[string]*sync.Pool{
+	Gzip: {New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}},
+	Brotli: {New: func() any {
+		// level 4 keeps brotli close to gzip's cost for dynamic content
+		return brotli.NewWriterLevel(io.Discard, 4)
+	}},
+	Zstd: {New: func() any {
+		w, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return w
+	}},
+}
+
+func New(config Config) (*Compressor, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	c := &Compressor{
+		algorithms: config.Algorithms,
+		minSize:    config.MinSize,
+		types:      config.Types,
+	}
+
+	if len(c.algorithms) == 0 {
+		c.algorithms = defaultAlgorithms
+	}
+	for _, algorithm := range c.algorithms {
+		if _, ok := pools[algorithm]; !ok {
+			return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
+		}
+	}
+
+	if c.minSize <= 0 {
+		c.minSize = defaultMinSize
+	}
+
+	if len(c.types) == 0 {
+		c.types = defaultTypes
+	}
+
+	return c, nil
+}
+
+// Serve serves next with a compressing writer when the client accepts one of the algorithms
+func (c *Compressor) Serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	encoding := c.negotiate(r.Header.Get("Accept-Encoding"))
+
+	// ranges refer to the identity body and upgrades hand the connection over
+	if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	rw := &responseWriter{
+		ResponseWriter: w,
+		c:              c,
+		encoding:       encoding,
+		status:         http.StatusOK,
+	}
+	defer rw.Close()
+
+	next.ServeHTTP(rw, r)
+}
+
+// negotiate picks the accepted algorithm with the highest quality, ties go to the configured order
+func (c *Compressor) negotiate(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		qualities[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, algorithm := range c.algorithms {
+		q, ok := qualities[algorithm]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+
+		if ok && q > bestQ {
+			best, bestQ = algorithm, q
+		}
+	}
+
+	return best
+}
+
+func (c *Compressor) allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	// streams must reach the client as they are written
+	if mediaType == "text/event-stream" {
+		return false
+	}
+
+	for _, t := range c.types {
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+			continue
+		}
+
+		if mediaType == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rw *responseWriter) eligible() bool {
+	h := rw.Header()
+
+	if rw.status < http.StatusOK || rw.status == http.StatusNoContent || rw.status == http.StatusNotModified {
+		return false
+	}
+
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	if strings.Contains(strings.ToLower(h.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+
+	return rw.c.allowed(h.Get("Content-Type"))
+}
+
+func (rw *responseWriter) WriteHeader(statusCode int) {
+	if rw.wroteHeader {
+		return
+	}
+
+	// informational responses go out as they are, the final header follows later
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		rw.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
+	rw.wroteHeader = true
+	rw.status = statusCode
+
+	if !rw.eligible() {
+		rw.passthrough = true
+		rw.commit()
+		return
+	}
+
+	addVary(rw.Header())
+
+	if length := rw.Header().Get("Content-Length"); length != "" {
+		if n, err := strconv.Atoi(length); err == nil && n < rw.c.minSize {
+			rw.passthrough = true
+			rw.commit()
+			return
+		}
+
+		rw.start()
+	}
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		if rw.Header().Get("Content-Type") == "" {
+			rw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	switch {
+	case rw.passthrough:
+		return rw.ResponseWriter.Write(p)
+
+	case rw.enc != nil:
+		return rw.enc.Write(p)
+	}
+
+	rw.buf = append(rw.buf, p...)
+	if len(rw.buf) >= rw.c.minSize {
+		rw.start()
+	}
+
+	return len(p), nil
+}
+
+// start commits the header with the negotiated encoding and flushes what was buffered
+func (rw *responseWriter) start() {
+	h := rw.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", rw.encoding)
+
+	// the compressed body no longer matches a strong validator
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+
+	rw.commit()
+
+	rw.enc = pools[rw.encoding].Get().(encoder)
+	rw.enc.Reset(rw.ResponseWriter)
+
+	if len(rw.buf) > 0 {
+		rw.enc.Write(rw.buf)
+		rw.buf = nil
+	}
+}
+
+func (rw *responseWriter) commit() {
+	if rw.committed {
+		return
+	}
+
+	rw.committed = true
+	rw.ResponseWriter.WriteHeader(rw.status)
+}
+
+func (rw *responseWriter) Close() error {
+	if rw.enc != nil {
+		err := rw.enc.Close()
+		rw.enc.Reset(io.Discard)
+		pools[rw.encoding].Put(rw.enc)
+		rw.enc = nil
+		return err
+	}
+
+	if !rw.wroteHeader {
+		return nil
+	}
+
+	// the body ended below the minimum size, send it as is
+	rw.passthrough = true
+	rw.commit()
+
+	if len(rw.buf) > 0 {
+		_, err := rw.ResponseWriter.Write(rw.buf)
+		rw.buf = nil
+		return err
+	}
+
+	return nil
+}
+
+func (rw *responseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	// a flush means the handler is streaming, stop waiting for the minimum size
+	if !rw.passthrough && rw.enc == nil {
+		rw.start()
+	}
+
+	if rw.enc != nil {
+		rw.enc.Flush()
+	}
+
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func addVary(h http.Header) {
+	for _, value := range h.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, "Accept-Encoding") {
+				return
+			}
+		}
+	}
+
+	h.Add("Vary", "Accept-Encoding")
+}
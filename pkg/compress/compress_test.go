@@ -0,0 +1,261 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+var body = strings.Repeat(`{"id":1,"name":"mrps","tags":["proxy","balancer"]},`, 200)
+
+func decode(t testing.TB, encoding string, data []byte) string {
+	t.Helper()
+
+	var r io.Reader
+	switch encoding {
+	case Gzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		assert.NoError(t, err)
+		r = gr
+	case Brotli:
+		r = brotli.NewReader(bytes.NewReader(data))
+	case Zstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data))
+		assert.NoError(t, err)
+		defer zr.Close()
+		r = zr
+	default:
+		return string(data)
+	}
+
+	decoded, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	return string(decoded)
+}
+
+func serve(c *Compressor, req *http.Request, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	c.Serve(rec, req, handler)
+	return rec
+}
+
+func TestNegotiate(t *testing.T) {
+	c, err := New(Config{Enabled: true})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"Empty", "", ""},
+		{"Gzip only", "gzip", Gzip},
+		{"Configured order breaks ties", "gzip, br, zstd", Zstd},
+		{"Highest quality wins", "gzip;q=1.0, br;q=0.8, zstd;q=0.5", Gzip},
+		{"Zero quality is refused", "br;q=0, gzip;q=0", ""},
+		{"Wildcard", "*", Zstd},
+		{"Unsupported", "deflate, identity", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, c.negotiate(tt.header))
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New(Config{Enabled: true, Algorithms: []string{"deflate"}})
+	assert.Error(t, err)
+
+	c, err := New(Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+}
+
+func TestCompress(t *testing.T) {
+	c, err := New(Config{Enabled: true, MinSize: 256})
+	assert.NoError(t, err)
+
+	for _, encoding := range []string{Gzip, Brotli, Zstd} {
+		t.Run(encoding, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", encoding)
+
+			rec := serve(c, req, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("ETag", `"v1"`)
+				io.WriteString(w, body)
+			})
+
+			assert.Equal(t, encoding, rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+			assert.Equal(t, `W/"v1"`, rec.Header().Get("ETag"))
+			assert.Empty(t, rec.Header().Get("Content-Length"))
+			assert.Less(t, rec.Body.Len(), len(body))
+			assert.Equal(t, body, decode(t, encoding, rec.Body.Bytes()))
+		})
+	}
+}
+
+func TestSkip(t *testing.T) {
+	c, err := New(Config{Enabled: true, MinSize: 256, Types: []string{"text/*", "application/json"}})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		request func(r *http.Request)
+		handler http.HandlerFunc
+	}{
+		{
+			"Below minimum size",
+			nil,
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, "short")
+			},
+		},
+		{
+			"Known length below minimum size",
+			nil,
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Length", "5")
+				io.WriteString(w, "short")
+			},
+		},
+		{
+			"Type not allowed",
+			nil,
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				io.WriteString(w, body)
+			},
+		},
+		{
+			"Already encoded",
+			nil,
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Content-Encoding", "identity")
+				io.WriteString(w, body)
+			},
+		},
+		{
+			"Event stream",
+			nil,
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, body)
+			},
+		},
+		{
+			"No transform",
+			nil,
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Cache-Control", "no-transform")
+				io.WriteString(w, body)
+			},
+		},
+		{
+			"Range request",
+			func(r *http.Request) { r.Header.Set("Range", "bytes=0-10") },
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, body)
+			},
+		},
+		{
+			"WebSocket upgrade",
+			func(r *http.Request) { r.Header.Set("Upgrade", "websocket") },
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				io.WriteString(w, body)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			if tt.request != nil {
+				tt.request(req)
+			}
+
+			expected := httptest.NewRecorder()
+			tt.handler(expected, req)
+
+			rec := serve(c, req, tt.handler)
+
+			assert.NotEqual(t, Gzip, rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, expected.Body.String(), rec.Body.String())
+		})
+	}
+}
+
+func TestFlush(t *testing.T) {
+	c, err := New(Config{Enabled: true})
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	rec := serve(c, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "first")
+		w.(http.Flusher).Flush()
+
+		// the first chunk reaches the client before the handler returns
+		assert.True(t, recorder(w).Flushed)
+		io.WriteString(w, "second")
+	})
+
+	assert.Equal(t, Gzip, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "firstsecond", decode(t, Gzip, rec.Body.Bytes()))
+}
+
+func recorder(w http.ResponseWriter) *httptest.ResponseRecorder {
+	return w.(interface{ Unwrap() http.ResponseWriter }).Unwrap().(*httptest.ResponseRecorder)
+}
+
+func BenchmarkCompress(b *testing.B) {
+	data := []byte(strings.Repeat(body, 4))
+
+	for _, encoding := range []string{Gzip, Brotli, Zstd} {
+		b.Run(encoding, func(b *testing.B) {
+			c, err := New(Config{Enabled: true, Algorithms: []string{encoding}})
+			assert.NoError(b, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", encoding)
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(data)
+			})
+
+			var compressed int
+
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				rec := serve(c, req, handler)
+				compressed = rec.Body.Len()
+			}
+
+			b.ReportMetric(float64(len(data))/float64(compressed), "ratio")
+		})
+	}
+}
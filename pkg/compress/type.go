@@ -0,0 +1,36 @@
+package compress
+
+import "net/http"
+
+const (
+	Gzip   = "gzip"
+	Brotli = "br"
+	Zstd   = "zstd"
+)
+
+type Config struct {
+	Enabled    bool     `yaml:"enabled"`
+	Algorithms []string `yaml:"algorithms,omitempty"`
+	MinSize    int      `yaml:"min_size,omitempty"`
+	Types      []string `yaml:"types,omitempty"`
+}
+
+type Compressor struct {
+	algorithms []string
+	minSize    int
+	types      []string
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	c        *Compressor
+	encoding string
+
+	status      int
+	wroteHeader bool
+	committed   bool
+	passthrough bool
+
+	buf []byte
+	enc encoder
+}
@@ -0,0 +1,82 @@
+// Package connlimit caps concurrent connections in total and per client
+package connlimit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrMax          = errors.New("too many connections")
+	ErrMaxPerClient = errors.New("too many connections from client")
+)
+
+// New returns a limiter for c, nil when c sets no cap
+func New(c Config) (*Limiter, error) {
+	if c.Max < 0 || c.MaxPerClient < 0 {
+		return nil, fmt.Errorf("connection caps must not be negative")
+	}
+
+	if c.Max == 0 && c.MaxPerClient == 0 {
+		return nil, nil
+	}
+
+	return &Limiter{config: c, clients: make(map[string]int)}, nil
+}
+
+// Acquire takes a slot for client, release gives it back once the connection is closed
+func (l *Limiter) Acquire(client string) (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.Max > 0 && l.total >= l.config.Max {
+		return nil, ErrMax
+	}
+	if l.config.MaxPerClient > 0 && l.clients[client] >= l.config.MaxPerClient {
+		return nil, ErrMaxPerClient
+	}
+
+	l.total++
+	l.clients[client]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { l.release(client) })
+	}, nil
+}
+
+func (l *Limiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total--
+	if l.clients[client]--; l.clients[client] <= 0 {
+		delete(l.clients, client)
+	}
+}
+
+// Config returns the caps of l, zero when l is nil
+func (l *Limiter) Config() Config {
+	if l == nil {
+		return Config{}
+	}
+
+	return l.config
+}
+
+// Active returns the number of open connections
+func (l *Limiter) Active() int {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.total
+}
@@ -0,0 +1,70 @@
+package connlimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	l, err := New(Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, l)
+
+	_, err = New(Config{Max: -1})
+	assert.Error(t, err)
+
+	l, err = New(Config{Max: 1})
+	assert.NoError(t, err)
+	assert.NotNil(t, l)
+	assert.Equal(t, Config{Max: 1}, l.Config())
+}
+
+func TestAcquire(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		var l *Limiter
+
+		release, err := l.Acquire("10.0.0.1")
+		assert.NoError(t, err)
+		release()
+		assert.Equal(t, 0, l.Active())
+	})
+
+	t.Run("Max", func(t *testing.T) {
+		l, _ := New(Config{Max: 2})
+
+		r1, err := l.Acquire("10.0.0.1")
+		assert.NoError(t, err)
+		_, err = l.Acquire("10.0.0.2")
+		assert.NoError(t, err)
+
+		_, err = l.Acquire("10.0.0.3")
+		assert.ErrorIs(t, err, ErrMax)
+		assert.Equal(t, 2, l.Active())
+
+		// releasing twice only frees one slot
+		r1()
+		r1()
+		assert.Equal(t, 1, l.Active())
+
+		_, err = l.Acquire("10.0.0.3")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Per client", func(t *testing.T) {
+		l, _ := New(Config{MaxPerClient: 1})
+
+		release, err := l.Acquire("10.0.0.1")
+		assert.NoError(t, err)
+
+		_, err = l.Acquire("10.0.0.1")
+		assert.ErrorIs(t, err, ErrMaxPerClient)
+
+		_, err = l.Acquire("10.0.0.2")
+		assert.NoError(t, err)
+
+		release()
+		_, err = l.Acquire("10.0.0.1")
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,17 @@
+package connlimit
+
+import "sync"
+
+// Config caps concurrent connections, zero values disable a cap
+type Config struct {
+	Max          int `json:"max,omitempty" yaml:"max,omitempty"`
+	MaxPerClient int `json:"max_per_client,omitempty" yaml:"max_per_client,omitempty"`
+}
+
+// Limiter counts the open connections in total and by client
+type Limiter struct {
+	config  Config
+	mu      sync.Mutex
+	total   int
+	clients map[string]int
+}
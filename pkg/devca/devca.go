@@ -0,0 +1,246 @@
+// Package devca implements a local certificate authority for development and tests
+package devca
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+)
+
+// DefaultDir is where the CA is kept when no directory is configured
+func DefaultDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+
+	return filepath.Join(dir, "mrps", "ca")
+}
+
+// New generates a CA that only lives in memory
+func New() (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "mrps local CA", Organization: []string{"mrps"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(RootLifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{
+		root:    root,
+		rootPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		key:     key,
+	}, nil
+}
+
+// Load reads the CA kept in dir, generating and saving one when the directory has none
+func Load(dir string) (*CA, error) {
+	rootPEM, err := os.ReadFile(filepath.Join(dir, RootFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		ca, err := New()
+		if err != nil {
+			return nil, err
+		}
+		return ca, ca.save(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := os.ReadFile(filepath.Join(dir, KeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := tls.X509KeyPair(rootPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if !root.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", filepath.Join(dir, RootFile))
+	}
+
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("root key can't sign")
+	}
+
+	return &CA{root: root, rootPEM: rootPEM, key: key}, nil
+}
+
+func (ca *CA) save(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(ca.key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, KeyFile), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, RootFile), ca.rootPEM, 0o644)
+}
+
+// Root returns the root certificate
+func (ca *CA) Root() *x509.Certificate {
+	return ca.root
+}
+
+// RootPEM returns the root certificate to install in trust stores
+func (ca *CA) RootPEM() []byte {
+	return ca.rootPEM
+}
+
+// Pool returns a pool trusting only the root
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.root)
+	return pool
+}
+
+// Sign issues a leaf for the names and key of csr
+func (ca *CA) Sign(csr *x509.CertificateRequest) ([]byte, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, err
+	}
+
+	names := csr.DNSNames
+	if len(names) == 0 && len(csr.IPAddresses) == 0 && csr.Subject.CommonName != "" {
+		names = []string{csr.Subject.CommonName}
+	}
+
+	return ca.sign(csr.PublicKey, names, csr.IPAddresses)
+}
+
+func (ca *CA) sign(pub crypto.PublicKey, names []string, ips []net.IP) ([]byte, error) {
+	if len(names) == 0 && len(ips) == 0 {
+		return nil, errors.New("no names to certify")
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	cn := ""
+	if len(names) > 0 {
+		cn = names[0]
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     names,
+		IPAddresses:  ips,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(LeafLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	return x509.CreateCertificate(rand.Reader, template, ca.root, pub, ca.key)
+}
+
+// Leaf issues a certificate with a fresh key for names, IPs included
+func (ca *CA) Leaf(names ...string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var dnsNames []string
+	var ips []net.IP
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+
+	der, err := ca.sign(&key.PublicKey, dnsNames, ips)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der, ca.root.Raw}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// Issue lets certmagic obtain certificates from the CA
+func (ca *CA) Issue(ctx context.Context, csr *x509.CertificateRequest) (*certmagic.IssuedCertificate, error) {
+	der, err := ca.Sign(csr)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	chain = append(chain, ca.rootPEM...)
+
+	return &certmagic.IssuedCertificate{Certificate: chain}, nil
+}
+
+// IssuerKey changes with the root so leaves of a replaced CA aren't reused
+func (ca *CA) IssuerKey() string {
+	sum := sha256.Sum256(ca.root.Raw)
+	return "local-" + hex.EncodeToString(sum[:8])
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
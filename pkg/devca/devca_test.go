@@ -0,0 +1,116 @@
+package devca
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ca")
+
+	ca, err := Load(dir)
+	assert.NoError(t, err)
+	assert.True(t, ca.Root().IsCA)
+	assert.FileExists(t, filepath.Join(dir, RootFile))
+	assert.FileExists(t, filepath.Join(dir, KeyFile))
+
+	t.Run("Reload keeps the root", func(t *testing.T) {
+		again, err := Load(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, ca.RootPEM(), again.RootPEM())
+		assert.Equal(t, ca.IssuerKey(), again.IssuerKey())
+	})
+
+	t.Run("Not a CA", func(t *testing.T) {
+		leafDir := t.TempDir()
+		leaf, err := ca.Leaf("domain.com")
+		assert.NoError(t, err)
+
+		keyDER, err := x509.MarshalPKCS8PrivateKey(leaf.PrivateKey)
+		assert.NoError(t, err)
+
+		assert.NoError(t, os.WriteFile(filepath.Join(leafDir, RootFile), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Certificate[0]}), 0o600))
+		assert.NoError(t, os.WriteFile(filepath.Join(leafDir, KeyFile), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+		_, err = Load(leafDir)
+		assert.Error(t, err)
+	})
+
+	t.Run("Missing key", func(t *testing.T) {
+		keyless := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(keyless, RootFile), ca.RootPEM(), 0o600))
+
+		_, err := Load(keyless)
+		assert.Error(t, err)
+	})
+}
+
+func TestLeaf(t *testing.T) {
+	ca, err := New()
+	assert.NoError(t, err)
+
+	leaf, err := ca.Leaf("app.localhost", "*.tcp.localhost", "127.0.0.1")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"app.localhost", "*.tcp.localhost"}, leaf.Leaf.DNSNames)
+	assert.Len(t, leaf.Leaf.IPAddresses, 1)
+	assert.WithinDuration(t, time.Now().Add(LeafLifetime), leaf.Leaf.NotAfter, time.Minute)
+
+	for _, name := range []string{"app.localhost", "db.tcp.localhost", "127.0.0.1"} {
+		_, err := leaf.Leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: ca.Pool()})
+		assert.NoError(t, err, name)
+	}
+
+	_, err = leaf.Leaf.Verify(x509.VerifyOptions{DNSName: "other.localhost", Roots: ca.Pool()})
+	assert.Error(t, err)
+
+	_, err = ca.Leaf()
+	assert.Error(t, err)
+}
+
+func TestIssue(t *testing.T) {
+	ca, err := New()
+	assert.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "app.localhost"},
+		DNSNames: []string{"app.localhost"},
+	}, key)
+	assert.NoError(t, err)
+
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	assert.NoError(t, err)
+
+	issued, err := ca.Issue(context.Background(), csr)
+	assert.NoError(t, err)
+
+	// the chain holds the leaf and the root
+	block, rest := pem.Decode(issued.Certificate)
+	if assert.NotNil(t, block) {
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		assert.NoError(t, err)
+		assert.Equal(t, &key.PublicKey, leaf.PublicKey)
+
+		_, err = leaf.Verify(x509.VerifyOptions{DNSName: "app.localhost", Roots: ca.Pool()})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, ca.RootPEM(), rest)
+
+	other, err := New()
+	assert.NoError(t, err)
+	assert.NotEqual(t, ca.IssuerKey(), other.IssuerKey())
+}
@@ -0,0 +1,27 @@
+package devca
+
+import (
+	"crypto"
+	"crypto/x509"
+	"time"
+)
+
+// files kept in the CA directory
+const (
+	RootFile = "root.crt"
+	KeyFile  = "root.key"
+)
+
+// lifetimes of the generated certificates
+const (
+	RootLifetime = 10 * 365 * 24 * time.Hour
+	LeafLifetime = 7 * 24 * time.Hour
+)
+
+// CA is a local certificate authority for machines without access to a public one,
+// its leaves are only trusted where the root has been installed
+type CA struct {
+	root    *x509.Certificate
+	rootPEM []byte
+	key     crypto.Signer
+}
@@ -0,0 +1,212 @@
+// Package errorpage renders error responses from configurable templates or files,
+// picking the JSON or HTML variant based on the request's Accept header.
+package errorpage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+type contextKey struct{}
+
+var funcs = texttemplate.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func New(config Config) (*Pages, error) {
+	if len(config) == 0 {
+		return nil, nil
+	}
+
+	pages := &Pages{pages: make(map[int]*page, len(config))}
+
+	for status, cfg := range config {
+		if status < 400 || status > 599 {
+			return nil, fmt.Errorf("invalid error page status: %d", status)
+		}
+
+		p, err := compile(status, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		pages.pages[status] = p
+	}
+
+	return pages, nil
+}
+
+func compile(status int, cfg Page) (*page, error) {
+	p := &page{}
+	name := strconv.Itoa(status)
+
+	var err error
+
+	if cfg.HTML != "" {
+		p.html, err = htmltemplate.New(name).Parse(cfg.HTML)
+		if err != nil {
+			return nil, fmt.Errorf("invalid html template for %d: %v", status, err)
+		}
+	}
+
+	if cfg.HTMLFile != "" {
+		p.htmlFile, err = os.ReadFile(cfg.HTMLFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid html file for %d: %v", status, err)
+		}
+	}
+
+	if cfg.JSON != "" {
+		p.json, err = texttemplate.New(name).Funcs(funcs).Parse(cfg.JSON)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json template for %d: %v", status, err)
+		}
+	}
+
+	if cfg.JSONFile != "" {
+		p.jsonFile, err = os.ReadFile(cfg.JSONFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid json file for %d: %v", status, err)
+		}
+	}
+
+	return p, nil
+}
+
+// WithPages returns a copy of ctx carrying pages, earlier pages take precedence
+func WithPages(ctx context.Context, pages ...*Pages) context.Context {
+	return context.WithValue(ctx, contextKey{}, pages)
+}
+
+func fromContext(ctx context.Context) []*Pages {
+	pages, _ := ctx.Value(contextKey{}).([]*Pages)
+	return pages
+}
+
+// Write replies to r with the error page configured for status,
+// it falls back to a plain text or JSON body when none is configured
+func Write(w http.ResponseWriter, r *http.Request, status int, message string) {
+	data := Data{
+		Status:     status,
+		StatusText: http.StatusText(status),
+		Message:    message,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		RetryAfter: w.Header().Get("Retry-After"),
+	}
+
+	asJSON := WantsJSON(r)
+
+	for _, pages := range fromContext(r.Context()) {
+		if pages.render(w, status, asJSON, data) {
+			return
+		}
+	}
+
+	if asJSON {
+		body, _ := json.Marshal(data)
+		write(w, status, "application/json", append(body, '\n'))
+		return
+	}
+
+	write(w, status, "text/plain; charset=utf-8", []byte(message+"\n"))
+}
+
+func (p *Pages) render(w http.ResponseWriter, status int, asJSON bool, data Data) bool {
+	if p == nil {
+		return false
+	}
+
+	page, ok := p.pages[status]
+	if !ok {
+		return false
+	}
+
+	var buf bytes.Buffer
+
+	if asJSON {
+		switch {
+		case page.json != nil:
+			if err := page.json.Execute(&buf, data); err != nil {
+				return false
+			}
+			write(w, status, "application/json", buf.Bytes())
+			return true
+
+		case page.jsonFile != nil:
+			write(w, status, "application/json", page.jsonFile)
+			return true
+		}
+
+		return false
+	}
+
+	switch {
+	case page.html != nil:
+		if err := page.html.Execute(&buf, data); err != nil {
+			return false
+		}
+		write(w, status, "text/html; charset=utf-8", buf.Bytes())
+		return true
+
+	case page.htmlFile != nil:
+		write(w, status, "text/html; charset=utf-8", page.htmlFile)
+		return true
+	}
+
+	return false
+}
+
+func write(w http.ResponseWriter, status int, contentType string, body []byte) {
+	h := w.Header()
+
+	h.Del("Content-Length")
+	h.Set("Content-Type", contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Cache-Control", "no-store")
+
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// WantsJSON reports whether the client prefers a JSON response over HTML
+func WantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+
+	jsonQ, htmlQ := -1.0, -1.0
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		switch {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			jsonQ = max(jsonQ, q)
+		case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+
+	return jsonQ > 0 && jsonQ > htmlQ
+}
@@ -0,0 +1,122 @@
+package errorpage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequest(accept string, pages ...*Pages) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Host = "domain.com"
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	return req.WithContext(WithPages(req.Context(), pages...))
+}
+
+func TestWrite(t *testing.T) {
+	htmlFile := filepath.Join(t.TempDir(), "502.html")
+	if err := os.WriteFile(htmlFile, []byte("<h1>{{ static }}</h1>"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	domain, err := New(Config{
+		404: {
+			HTML: "<h1>{{.Host}}{{.Path}} {{.Message}}</h1>",
+			JSON: `{"code":{{.Status}},"message":{{json .Message}}}`,
+		},
+		502: {HTMLFile: htmlFile},
+	})
+	assert.NoError(t, err)
+
+	global, err := New(Config{
+		404: {HTML: "global"},
+		429: {HTML: "<p>retry after {{.RetryAfter}}</p>"},
+	})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		accept       string
+		status       int
+		retryAfter   string
+		expectedType string
+		expectedBody string
+	}{
+		{"HTML template", "text/html", 404, "", "text/html; charset=utf-8", "<h1>domain.com/missing &lt;b&gt;gone&lt;/b&gt;</h1>"},
+		{"JSON template", "application/json", 404, "", "application/json", `{"code":404,"message":"\u003cb\u003egone\u003c/b\u003e"}`},
+		{"JSON preferred by quality", "text/html;q=0.5, application/json", 404, "", "application/json", `{"code":404,"message":"\u003cb\u003egone\u003c/b\u003e"}`},
+		{"Static file is not templated", "", 502, "", "text/html; charset=utf-8", "<h1>{{ static }}</h1>"},
+		{"Falls back to global", "*/*", 429, "5", "text/html; charset=utf-8", "<p>retry after 5</p>"},
+		{"Default JSON", "application/json", 503, "", "application/json", `{"status":503,"error":"Service Unavailable","message":"\u003cb\u003egone\u003c/b\u003e"}` + "\n"},
+		{"Default text", "", 504, "", "text/plain; charset=utf-8", "<b>gone</b>\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if tt.retryAfter != "" {
+				rec.Header().Set("Retry-After", tt.retryAfter)
+			}
+
+			Write(rec, newRequest(tt.accept, domain, global), tt.status, "<b>gone</b>")
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.expectedType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, tt.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestWriteWithoutPages(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	Write(rec, req, http.StatusTooManyRequests, "too many requests")
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "too many requests\n", rec.Body.String())
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New(Config{200: {HTML: "ok"}})
+	assert.Error(t, err)
+
+	_, err = New(Config{404: {HTML: "{{.Missing"}})
+	assert.Error(t, err)
+
+	_, err = New(Config{404: {HTMLFile: filepath.Join(t.TempDir(), "missing.html")}})
+	assert.Error(t, err)
+
+	pages, err := New(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, pages)
+}
+
+func TestWantsJSON(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", true},
+		{"application/problem+json", true},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", false},
+		{"application/json;q=0.4, text/html;q=0.9", false},
+		{"application/json;q=0", false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept", tt.accept)
+
+		assert.Equal(t, tt.expected, WantsJSON(req), tt.accept)
+	}
+}
@@ -0,0 +1,39 @@
+package errorpage
+
+import (
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Config maps a status code to the page rendered for it
+type Config map[int]Page
+
+// Page holds the HTML and JSON variants of an error response,
+// inline values are templates while files are served as is
+type Page struct {
+	HTML     string `yaml:"html,omitempty"`
+	HTMLFile string `yaml:"html_file,omitempty"`
+	JSON     string `yaml:"json,omitempty"`
+	JSONFile string `yaml:"json_file,omitempty"`
+}
+
+// Data is passed to the page templates
+type Data struct {
+	Status     int    `json:"status"`
+	StatusText string `json:"error"`
+	Message    string `json:"message,omitempty"`
+	Host       string `json:"-"`
+	Path       string `json:"-"`
+	RetryAfter string `json:"retry_after,omitempty"`
+}
+
+type Pages struct {
+	pages map[int]*page
+}
+
+type page struct {
+	html     *htmltemplate.Template
+	htmlFile []byte
+	json     *texttemplate.Template
+	jsonFile []byte
+}
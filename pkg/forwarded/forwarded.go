@@ -0,0 +1,267 @@
+// Package forwarded resolves the real client IP behind trusted proxies and writes
+// the X-Forwarded-* and RFC 7239 Forwarded headers sent to backends.
+package forwarded
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+var forwardingHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"X-Forwarded-Port",
+	"X-Real-Ip",
+}
+
+func New(config Config) (*Forwarded, error) {
+	f := &Forwarded{
+		trusted: make([]*net.IPNet, 0, len(config.TrustedProxies)),
+		style:   config.Style,
+	}
+
+	switch f.style {
+	case "":
+		f.style = XForwardedStyle
+	case XForwardedStyle, ForwardedStyle, BothStyle, NoneStyle:
+	default:
+		return nil, fmt.Errorf("invalid forwarded style: %s", config.Style)
+	}
+
+	for _, cidr := range config.TrustedProxies {
+		network, err := ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", cidr)
+		}
+		f.trusted = append(f.trusted, network)
+	}
+
+	return f, nil
+}
+
+// ParseCIDR parses a CIDR, a bare IP is treated as a single host network
+func ParseCIDR(cidr string) (*net.IPNet, error) {
+	if !strings.Contains(cidr, "/") {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip: %s", cidr)
+		}
+
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(cidr)
+	return network, err
+}
+
+func (f *Forwarded) Trusted(ip string) bool {
+	if f == nil {
+		return false
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range f.trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve returns the client IP of r, forwarding headers are only
+// honored when the peer is a trusted proxy
+func (f *Forwarded) Resolve(r *http.Request) string {
+	peer := remoteIP(r.RemoteAddr)
+	if !f.Trusted(peer) {
+		return peer
+	}
+
+	chain := forwardedFor(r.Header)
+	if len(chain) == 0 {
+		return peer
+	}
+
+	// walk from the closest hop, the first untrusted address is the client
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !f.Trusted(chain[i]) {
+			return chain[i]
+		}
+	}
+
+	return chain[0]
+}
+
+// Apply sets the forwarding headers on an outgoing proxy request,
+// X-Forwarded-For is left for httputil.ReverseProxy to append the peer to
+func (f *Forwarded) Apply(req *http.Request) {
+	style := XForwardedStyle
+	if f != nil {
+		style = f.style
+	}
+
+	peer := remoteIP(req.RemoteAddr)
+	trusted := f.Trusted(peer)
+
+	client, ok := req.Context().Value(contextKey{}).(string)
+	if !ok || client == "" {
+		client = f.Resolve(req)
+	}
+
+	prior := make(http.Header, len(forwardingHeaders))
+	for _, name := range forwardingHeaders {
+		if trusted {
+			if values := req.Header.Values(name); len(values) > 0 {
+				prior[name] = values
+			}
+		}
+		req.Header.Del(name)
+	}
+
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+
+	host := req.Host
+	port := localPort(req.Context())
+
+	if style == XForwardedStyle || style == BothStyle {
+		if xff := prior.Values("X-Forwarded-For"); len(xff) > 0 {
+			req.Header["X-Forwarded-For"] = xff
+		}
+
+		req.Header.Set("X-Forwarded-Proto", first(prior.Get("X-Forwarded-Proto"), proto))
+		req.Header.Set("X-Forwarded-Host", first(prior.Get("X-Forwarded-Host"), host))
+		if port != "" || prior.Get("X-Forwarded-Port") != "" {
+			req.Header.Set("X-Forwarded-Port", first(prior.Get("X-Forwarded-Port"), port))
+		}
+		req.Header.Set("X-Real-Ip", client)
+	} else {
+		// a nil value stops httputil.ReverseProxy from adding X-Forwarded-For
+		req.Header["X-Forwarded-For"] = nil
+	}
+
+	if style == ForwardedStyle || style == BothStyle {
+		element := "for=" + quote(peer) + ";host=" + quote(host) + ";proto=" + proto
+
+		if existing := prior.Values("Forwarded"); len(existing) > 0 {
+			element = strings.Join(existing, ", ") + ", " + element
+		}
+
+		req.Header.Set("Forwarded", element)
+	}
+}
+
+// WithClientIP returns a copy of ctx carrying the resolved client IP
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// ClientIP returns the client IP resolved earlier in the chain,
+// or the peer address when it was never resolved
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(contextKey{}).(string); ok && ip != "" {
+		return ip
+	}
+
+	return remoteIP(r.RemoteAddr)
+}
+
+func forwardedFor(h http.Header) []string {
+	chain := []string{}
+
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(value, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				chain = append(chain, ip)
+			}
+		}
+	}
+
+	if len(chain) > 0 {
+		return chain
+	}
+
+	for _, value := range h.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+
+				val = strings.Trim(val, `"`)
+				if host, _, err := net.SplitHostPort(val); err == nil {
+					val = host
+				}
+				chain = append(chain, strings.Trim(val, "[]"))
+			}
+		}
+	}
+
+	return chain
+}
+
+func remoteIP(addr string) string {
+	ip, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return ip
+}
+
+func localPort(ctx context.Context) string {
+	addr, ok := ctx.Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return ""
+	}
+
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+
+	return port
+}
+
+// quote formats a Forwarded value, IPv6 addresses and values with reserved characters need quoting
+func quote(value string) string {
+	if ip := net.ParseIP(value); ip != nil && ip.To4() == nil {
+		return `"[` + value + `]"`
+	}
+
+	if strings.ContainsAny(value, `:;,"= `) {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+
+	return value
+}
+
+func first(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,147 @@
+package forwarded
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	f, err := New(Config{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"}})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		forwarded  string
+		expected   string
+	}{
+		{"Untrusted peer ignores headers", "203.0.113.7:5555", "1.1.1.1", "", "203.0.113.7"},
+		{"Trusted peer without headers", "10.0.0.2:5555", "", "", "10.0.0.2"},
+		{"Trusted peer with client", "10.0.0.2:5555", "198.51.100.4", "", "198.51.100.4"},
+		{"Skips trusted hops", "10.0.0.2:5555", "6.6.6.6, 198.51.100.4, 192.168.1.1, 10.1.1.1", "", "198.51.100.4"},
+		{"All hops trusted", "10.0.0.2:5555", "10.9.9.9, 10.1.1.1", "", "10.9.9.9"},
+		{"Falls back to Forwarded", "10.0.0.2:5555", "", `for="[2001:db8::1]:4711";proto=https, for=10.1.1.1`, "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.forwarded != "" {
+				req.Header.Set("Forwarded", tt.forwarded)
+			}
+
+			assert.Equal(t, tt.expected, f.Resolve(req))
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New(Config{TrustedProxies: []string{"10.0.0.0/33"}})
+	assert.Error(t, err)
+
+	_, err = New(Config{Style: "x-real"})
+	assert.Error(t, err)
+}
+
+func proxyHeaders(t *testing.T, f *Forwarded, req *http.Request) http.Header {
+	t.Helper()
+
+	var received http.Header
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer backend.Close()
+
+	target, _ := url.Parse(backend.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		f.Apply(r)
+	}
+
+	proxy.ServeHTTP(httptest.NewRecorder(), req)
+	return received
+}
+
+func TestApply(t *testing.T) {
+	trusted, err := New(Config{TrustedProxies: []string{"10.0.0.0/8"}, Style: BothStyle})
+	assert.NoError(t, err)
+
+	t.Run("Untrusted peer replaces the chain", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "https://domain.com/", nil)
+		req.RemoteAddr = "203.0.113.7:5555"
+		req.TLS = &tls.ConnectionState{}
+		req.Header.Set("X-Forwarded-For", "6.6.6.6")
+		req.Header.Set("X-Forwarded-Proto", "http")
+		req.Header.Set("Forwarded", "for=6.6.6.6")
+
+		h := proxyHeaders(t, trusted, req)
+
+		assert.Equal(t, "203.0.113.7", h.Get("X-Forwarded-For"))
+		assert.Equal(t, "203.0.113.7", h.Get("X-Real-Ip"))
+		assert.Equal(t, "https", h.Get("X-Forwarded-Proto"))
+		assert.Equal(t, "domain.com", h.Get("X-Forwarded-Host"))
+		assert.Equal(t, "for=203.0.113.7;host=domain.com;proto=https", h.Get("Forwarded"))
+	})
+
+	t.Run("Trusted peer appends to the chain", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://domain.com/", nil)
+		req.RemoteAddr = "10.0.0.2:5555"
+		req.Header.Set("X-Forwarded-For", "198.51.100.4")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("Forwarded", "for=198.51.100.4;proto=https")
+
+		h := proxyHeaders(t, trusted, req)
+
+		assert.Equal(t, "198.51.100.4, 10.0.0.2", h.Get("X-Forwarded-For"))
+		assert.Equal(t, "198.51.100.4", h.Get("X-Real-Ip"))
+		assert.Equal(t, "https", h.Get("X-Forwarded-Proto"))
+		assert.Equal(t, "for=198.51.100.4;proto=https, for=10.0.0.2;host=domain.com;proto=http", h.Get("Forwarded"))
+	})
+
+	t.Run("IPv6 peers are quoted", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "http://domain.com/", nil)
+		req.RemoteAddr = "[2001:db8::1]:5555"
+
+		h := proxyHeaders(t, trusted, req)
+
+		assert.Equal(t, `for="[2001:db8::1]";host=domain.com;proto=http`, h.Get("Forwarded"))
+	})
+
+	t.Run("None style strips everything", func(t *testing.T) {
+		none, err := New(Config{Style: NoneStyle})
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "http://domain.com/", nil)
+		req.RemoteAddr = "203.0.113.7:5555"
+		req.Header.Set("X-Forwarded-For", "6.6.6.6")
+
+		h := proxyHeaders(t, none, req)
+
+		assert.Empty(t, h.Values("X-Forwarded-For"))
+		assert.Empty(t, h.Get("X-Real-Ip"))
+		assert.Empty(t, h.Get("Forwarded"))
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.2:5555"
+
+	assert.Equal(t, "10.0.0.2", ClientIP(req))
+
+	req = req.WithContext(WithClientIP(req.Context(), "198.51.100.4"))
+	assert.Equal(t, "198.51.100.4", ClientIP(req))
+}
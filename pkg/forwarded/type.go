@@ -0,0 +1,20 @@
+package forwarded
+
+import "net"
+
+const (
+	XForwardedStyle = "x-forwarded"
+	ForwardedStyle  = "forwarded"
+	BothStyle       = "both"
+	NoneStyle       = "none"
+)
+
+type Config struct {
+	TrustedProxies []string `yaml:"trusted_proxies,omitempty"`
+	Style          string   `yaml:"style,omitempty"`
+}
+
+type Forwarded struct {
+	trusted []*net.IPNet
+	style   string
+}
@@ -0,0 +1,406 @@
+// Package grpc implements the parts of the gRPC protocol a proxy needs: reading call statuses
+// from headers and trailers, holding back retryable failures, replaying request bodies and health checks.
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	ContentType   = "application/grpc"
+	StatusHeader  = "Grpc-Status"
+	MessageHeader = "Grpc-Message"
+
+	// bodies larger than this are streamed without the possibility of a retry
+	replayLimit = 64 << 10
+)
+
+var codeNames = [...]string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+// http status equivalents, used for metrics, logs and retry decisions
+var httpStatuses = [...]int{
+	http.StatusOK,
+	499,
+	http.StatusInternalServerError,
+	http.StatusBadRequest,
+	http.StatusGatewayTimeout,
+	http.StatusNotFound,
+	http.StatusConflict,
+	http.StatusForbidden,
+	http.StatusTooManyRequests,
+	http.StatusBadRequest,
+	http.StatusConflict,
+	http.StatusBadRequest,
+	http.StatusNotImplemented,
+	http.StatusInternalServerError,
+	http.StatusServiceUnavailable,
+	http.StatusInternalServerError,
+	http.StatusUnauthorized,
+}
+
+var errReplaced = errors.New("grpc: request body was replayed")
+
+func (c Code) String() string {
+	if c < 0 || int(c) >= len(codeNames) {
+		return "CODE(" + strconv.Itoa(int(c)) + ")"
+	}
+
+	return codeNames[c]
+}
+
+// HTTPStatus maps c to the closest HTTP status
+func (c Code) HTTPStatus() int {
+	if c < 0 || int(c) >= len(httpStatuses) {
+		return http.StatusInternalServerError
+	}
+
+	return httpStatuses[c]
+}
+
+// IsGRPC reports whether r is a gRPC call
+func IsGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), ContentType)
+}
+
+// Status returns the call status from a response header, it is found in the
+// header itself for trailers-only responses and among the trailers otherwise
+func Status(h http.Header) (Code, bool) {
+	value := h.Get(StatusHeader)
+	if value == "" {
+		value = h.Get(http.TrailerPrefix + StatusHeader)
+	}
+
+	if value == "" {
+		return 0, false
+	}
+
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return Unknown, true
+	}
+
+	return Code(code), true
+}
+
+// WriteError replies with a trailers-only response carrying code
+func WriteError(w http.ResponseWriter, code Code, message string) {
+	h := w.Header()
+	h.Set("Content-Type", ContentType)
+	h.Set(StatusHeader, strconv.Itoa(int(code)))
+	h.Set(MessageHeader, message)
+	w.WriteHeader(http.StatusOK)
+}
+
+func NewWriter(w http.ResponseWriter, hold bool) *Writer {
+	return &Writer{
+		ResponseWriter: w,
+		header:         http.Header{},
+		hold:           hold,
+	}
+}
+
+func (gw *Writer) Header() http.Header {
+	if gw.committed {
+		return gw.ResponseWriter.Header()
+	}
+
+	return gw.header
+}
+
+func (gw *Writer) WriteHeader(statusCode int) {
+	if gw.committed || gw.held {
+		return
+	}
+
+	if code, ok := Status(gw.header); gw.hold && ok && code == Unavailable {
+		gw.held = true
+		gw.status = statusCode
+		return
+	}
+
+	gw.commit(statusCode)
+}
+
+func (gw *Writer) commit(statusCode int) {
+	h := gw.ResponseWriter.Header()
+	for name, values := range gw.header {
+		h[name] = values
+	}
+
+	gw.committed = true
+	gw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (gw *Writer) Write(p []byte) (int, error) {
+	if gw.held {
+		gw.Release()
+	}
+
+	if !gw.committed {
+		gw.WriteHeader(http.StatusOK)
+	}
+
+	return gw.ResponseWriter.Write(p)
+}
+
+func (gw *Writer) Flush() {
+	if gw.held {
+		return
+	}
+
+	if !gw.committed {
+		gw.WriteHeader(http.StatusOK)
+	}
+
+	http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+func (gw *Writer) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// Held reports whether a retryable response was held back
+func (gw *Writer) Held() bool {
+	return gw.held
+}
+
+// Release sends a held response to the client
+func (gw *Writer) Release() {
+	if !gw.held {
+		return
+	}
+
+	gw.held = false
+	gw.commit(gw.status)
+}
+
+// Code returns the status of the call written so far
+func (gw *Writer) Code() (Code, bool) {
+	return Status(gw.Header())
+}
+
+func NewReplay(src io.ReadCloser) *Replay {
+	return &Replay{src: src, limit: replayLimit}
+}
+
+// ReplayOf returns the Replay body was obtained from
+func ReplayOf(body io.ReadCloser) (*Replay, bool) {
+	rr, ok := body.(*replayReader)
+	if !ok {
+		return nil, false
+	}
+
+	return rr.replay, true
+}
+
+// Body returns a reader starting at the beginning of the body, readers returned
+// earlier stop working. It returns false once more than the limit has been read.
+func (rp *Replay) Body() (io.ReadCloser, bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.full {
+		return nil, false
+	}
+
+	rp.current = &replayReader{replay: rp}
+	return rp.current, true
+}
+
+func (rr *replayReader) Read(p []byte) (int, error) {
+	rp := rr.replay
+
+	rp.mu.Lock()
+	if rp.current != rr {
+		rp.mu.Unlock()
+		return 0, errReplaced
+	}
+
+	if !rp.full && rr.pos < len(rp.buf) {
+		n := copy(p, rp.buf[rr.pos:])
+		rr.pos += n
+		rp.mu.Unlock()
+		return n, nil
+	}
+
+	if rp.err != nil {
+		rp.mu.Unlock()
+		return 0, rp.err
+	}
+	rp.mu.Unlock()
+
+	// the source can block for streaming calls, it is read outside of mu
+	rp.readMu.Lock()
+	defer rp.readMu.Unlock()
+
+	n, err := rp.src.Read(p)
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if err != nil {
+		rp.err = err
+	}
+
+	if !rp.full {
+		if len(rp.buf)+n > rp.limit {
+			rp.full = true
+			rp.buf = nil
+		} else {
+			rp.buf = append(rp.buf, p[:n]...)
+		}
+	}
+
+	// a retry started while the source was being read, the data stays buffered for it
+	if rp.current != rr {
+		return 0, errReplaced
+	}
+
+	rr.pos += n
+	return n, err
+}
+
+// Close detaches the reader, the source itself is closed by the server
+func (rr *replayReader) Close() error {
+	rp := rr.replay
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.current == rr {
+		rp.current = nil
+	}
+
+	return nil
+}
+
+// Check queries the standard gRPC health service of target, service may be empty for the whole server
+func Check(ctx context.Context, transport http.RoundTripper, target, service string) error {
+	// HealthCheckRequest{service = 1}
+	message := append([]byte{0x0a}, binary.AppendUvarint(nil, uint64(len(service)))...)
+	message = append(message, service...)
+
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	frame = append(frame, message...)
+
+	url := strings.TrimSuffix(target, "/") + "/grpc.health.v1.Health/Check"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(frame))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("Te", "trailers")
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+
+	code, ok := Status(resp.Trailer)
+	if !ok {
+		code, ok = Status(resp.Header)
+	}
+	if !ok {
+		return fmt.Errorf("health check returned no status")
+	}
+	if code != OK {
+		return fmt.Errorf("health check returned %s", code)
+	}
+
+	status, err := servingStatus(data)
+	if err != nil {
+		return err
+	}
+
+	// HealthCheckResponse.ServingStatus SERVING
+	if status != 1 {
+		return fmt.Errorf("health check returned serving status %d", status)
+	}
+
+	return nil
+}
+
+// servingStatus decodes HealthCheckResponse{status = 1} from a length-prefixed message
+func servingStatus(data []byte) (uint64, error) {
+	if len(data) < 5 || data[0] != 0 {
+		return 0, fmt.Errorf("invalid health check response")
+	}
+
+	size := binary.BigEndian.Uint32(data[1:5])
+	if int(size) > len(data)-5 {
+		return 0, fmt.Errorf("invalid health check response")
+	}
+	message := data[5 : 5+size]
+
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return 0, fmt.Errorf("invalid health check response")
+		}
+		message = message[n:]
+
+		field, wire := tag>>3, tag&7
+		switch wire {
+		case 0:
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return 0, fmt.Errorf("invalid health check response")
+			}
+			message = message[n:]
+
+			if field == 1 {
+				return value, nil
+			}
+
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < length {
+				return 0, fmt.Errorf("invalid health check response")
+			}
+			message = message[n+int(length):]
+
+		default:
+			return 0, fmt.Errorf("invalid health check response")
+		}
+	}
+
+	// proto3 omits the default value, UNKNOWN
+	return 0, nil
+}
@@ -0,0 +1,181 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected Code
+		ok       bool
+	}{
+		{"Missing", http.Header{}, 0, false},
+		{"Trailers-only", http.Header{"Grpc-Status": {"14"}}, Unavailable, true},
+		{"Undeclared trailer", http.Header{http.TrailerPrefix + "Grpc-Status": {"5"}}, NotFound, true},
+		{"Invalid", http.Header{"Grpc-Status": {"x"}}, Unknown, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, ok := Status(tt.header)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, code)
+		})
+	}
+
+	assert.Equal(t, "UNAVAILABLE", Unavailable.String())
+	assert.Equal(t, http.StatusServiceUnavailable, Unavailable.HTTPStatus())
+	assert.Equal(t, http.StatusGatewayTimeout, DeadlineExceeded.HTTPStatus())
+	assert.Equal(t, http.StatusInternalServerError, Code(42).HTTPStatus())
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("Holds unavailable", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		gw := NewWriter(rec, true)
+
+		WriteError(gw, Unavailable, "down")
+
+		assert.True(t, gw.Held())
+		assert.Empty(t, rec.Header().Get(StatusHeader))
+
+		gw.Release()
+
+		assert.False(t, gw.Held())
+		assert.Equal(t, "14", rec.Header().Get(StatusHeader))
+		assert.Equal(t, "down", rec.Header().Get(MessageHeader))
+	})
+
+	t.Run("Passes other statuses", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		gw := NewWriter(rec, true)
+
+		WriteError(gw, NotFound, "missing")
+
+		assert.False(t, gw.Held())
+		assert.Equal(t, "5", rec.Header().Get(StatusHeader))
+	})
+
+	t.Run("Without hold", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		gw := NewWriter(rec, false)
+
+		WriteError(gw, Unavailable, "down")
+
+		assert.False(t, gw.Held())
+		assert.Equal(t, "14", rec.Header().Get(StatusHeader))
+	})
+
+	t.Run("Trailers reach the client", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		gw := NewWriter(rec, true)
+
+		gw.Header().Set("Content-Type", ContentType)
+		gw.Header().Set("Trailer", StatusHeader)
+		gw.WriteHeader(http.StatusOK)
+		gw.Write([]byte("message"))
+		gw.Header().Set(StatusHeader, "0")
+
+		resp := rec.Result()
+		io.ReadAll(resp.Body)
+
+		assert.Equal(t, "0", resp.Trailer.Get(StatusHeader))
+		code, ok := gw.Code()
+		assert.True(t, ok)
+		assert.Equal(t, OK, code)
+	})
+}
+
+func TestReplay(t *testing.T) {
+	replay := NewReplay(io.NopCloser(strings.NewReader("hello world")))
+
+	first, ok := replay.Body()
+	assert.True(t, ok)
+
+	buf := make([]byte, 5)
+	n, err := first.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	first.Close()
+
+	second, ok := replay.Body()
+	assert.True(t, ok)
+
+	data, err := io.ReadAll(second)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	_, err = first.Read(buf)
+	assert.ErrorIs(t, err, errReplaced)
+
+	r, ok := ReplayOf(second)
+	assert.True(t, ok)
+	assert.Same(t, replay, r)
+
+	t.Run("Over the limit", func(t *testing.T) {
+		replay := NewReplay(io.NopCloser(strings.NewReader(strings.Repeat("x", replayLimit+1))))
+
+		body, _ := replay.Body()
+		data, err := io.ReadAll(body)
+		assert.NoError(t, err)
+		assert.Len(t, data, replayLimit+1)
+
+		_, ok := replay.Body()
+		assert.False(t, ok)
+	})
+}
+
+func healthServer(t *testing.T, serving byte) *httptest.Server {
+	t.Helper()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/grpc.health.v1.Health/Check" {
+			WriteError(w, Unimplemented, "unknown method")
+			return
+		}
+
+		io.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("Trailer", StatusHeader)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte{0, 0, 0, 0, 2, 0x08, serving})
+		w.Header().Set(StatusHeader, "0")
+	})
+
+	server := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestCheck(t *testing.T) {
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.NoError(t, Check(ctx, transport, healthServer(t, 1).URL, ""))
+	assert.Error(t, Check(ctx, transport, healthServer(t, 2).URL, ""))
+	assert.Error(t, Check(ctx, transport, "http://127.0.0.1:1", ""))
+}
@@ -0,0 +1,59 @@
+package grpc
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Code is a gRPC status code, https://grpc.github.io/grpc/core/md_doc_statuscodes.html
+type Code int
+
+const (
+	OK Code = iota
+	Canceled
+	Unknown
+	InvalidArgument
+	DeadlineExceeded
+	NotFound
+	AlreadyExists
+	PermissionDenied
+	ResourceExhausted
+	FailedPrecondition
+	Aborted
+	OutOfRange
+	Unimplemented
+	Internal
+	Unavailable
+	DataLoss
+	Unauthenticated
+)
+
+// Writer holds back trailers-only responses with a retryable status,
+// so the call can be retried on another backend before the client sees anything
+type Writer struct {
+	http.ResponseWriter
+	header http.Header
+
+	hold      bool
+	held      bool
+	committed bool
+	status    int
+}
+
+// Replay records the start of a request body so it can be sent again on retry
+type Replay struct {
+	mu      sync.Mutex
+	readMu  sync.Mutex
+	src     io.ReadCloser
+	buf     []byte
+	limit   int
+	full    bool
+	err     error
+	current *replayReader
+}
+
+type replayReader struct {
+	replay *Replay
+	pos    int
+}
@@ -0,0 +1,154 @@
+// Package headers applies set, add, remove and rename rules to HTTP headers,
+// values can reference request placeholders such as {client_ip} or {request_id}.
+package headers
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"strings"
+
+	"github.com/Dyastin-0/mrps/pkg/forwarded"
+	"github.com/google/uuid"
+)
+
+const RequestIDHeader = "X-Request-Id"
+
+type contextKey struct{}
+
+// Vars resolves placeholders for a single request, the request ID is generated once and reused
+type Vars struct {
+	r         *http.Request
+	route     string
+	requestID string
+}
+
+func NewVars(r *http.Request, route string) *Vars {
+	return &Vars{r: r, route: route}
+}
+
+func WithVars(ctx context.Context, vars *Vars) context.Context {
+	return context.WithValue(ctx, contextKey{}, vars)
+}
+
+func FromContext(ctx context.Context) *Vars {
+	vars, _ := ctx.Value(contextKey{}).(*Vars)
+	return vars
+}
+
+func (v *Vars) Get(name string) (string, bool) {
+	r := v.r
+
+	switch name {
+	case "client_ip":
+		return forwarded.ClientIP(r), true
+	case "remote_addr":
+		return r.RemoteAddr, true
+	case "request_id":
+		return v.RequestID(), true
+	case "route":
+		return v.route, true
+	case "host":
+		return r.Host, true
+	case "method":
+		return r.Method, true
+	case "path":
+		return r.URL.Path, true
+	case "scheme":
+		if r.TLS != nil {
+			return "https", true
+		}
+		return "http", true
+	case "tls_version":
+		if r.TLS == nil {
+			return "", true
+		}
+		return tls.VersionName(r.TLS.Version), true
+	}
+
+	return "", false
+}
+
+// RequestID returns the incoming X-Request-Id or a generated one
+func (v *Vars) RequestID() string {
+	if v.requestID != "" {
+		return v.requestID
+	}
+
+	v.requestID = v.r.Header.Get(RequestIDHeader)
+	if v.requestID == "" {
+		v.requestID = uuid.NewString()
+	}
+
+	return v.requestID
+}
+
+// Replace expands {name} placeholders in value, unknown placeholders are kept as is
+func (v *Vars) Replace(value string) string {
+	if v == nil || !strings.Contains(value, "{") {
+		return value
+	}
+
+	var b strings.Builder
+
+	for {
+		start := strings.IndexByte(value, '{')
+		if start < 0 {
+			break
+		}
+
+		end := strings.IndexByte(value[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+
+		b.WriteString(value[:start])
+
+		if resolved, ok := v.Get(value[start+1 : end]); ok {
+			b.WriteString(resolved)
+		} else {
+			b.WriteString(value[start : end+1])
+		}
+
+		value = value[end+1:]
+	}
+
+	b.WriteString(value)
+	return b.String()
+}
+
+// Apply runs the rules against h in order: rename, remove, set, add
+func (rules Rules) Apply(h http.Header, vars *Vars) {
+	for from, to := range rules.Rename {
+		values := h.Values(from)
+		if len(values) == 0 {
+			continue
+		}
+
+		h.Del(from)
+		for _, value := range values {
+			h.Add(to, value)
+		}
+	}
+
+	for _, name := range rules.Remove {
+		h.Del(name)
+	}
+
+	for name, value := range rules.Set {
+		h.Set(name, vars.Replace(value))
+	}
+
+	for name, value := range rules.Add {
+		h.Add(name, vars.Replace(value))
+	}
+}
+
+func (rules Rules) Empty() bool {
+	return len(rules.Rename) == 0 && len(rules.Remove) == 0 && len(rules.Set) == 0 && len(rules.Add) == 0
+}
+
+func (c Config) Empty() bool {
+	return c.Request.Empty() && c.Response.Empty()
+}
@@ -0,0 +1,72 @@
+package headers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplace(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://domain.com/api/users", nil)
+	req.RemoteAddr = "203.0.113.7:5555"
+	req.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+	req.Header.Set(RequestIDHeader, "abc-123")
+
+	vars := NewVars(req, "/api")
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"static", "static"},
+		{"{client_ip}", "203.0.113.7"},
+		{"{remote_addr}", "203.0.113.7:5555"},
+		{"id={request_id}", "id=abc-123"},
+		{"{method} {host}{path} via {route}", "GET domain.com/api/users via /api"},
+		{"{scheme}/{tls_version}", "https/TLS 1.3"},
+		{"{unknown} {client_ip", "{unknown} {client_ip"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, vars.Replace(tt.value), tt.value)
+	}
+}
+
+func TestRequestIDIsGeneratedOnce(t *testing.T) {
+	vars := NewVars(httptest.NewRequest(http.MethodGet, "/", nil), "/")
+
+	id := vars.Replace("{request_id}")
+	assert.NotEmpty(t, id)
+	assert.Equal(t, id, vars.Replace("{request_id}"))
+}
+
+func TestApply(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	h := http.Header{}
+	h.Set("Server", "nginx")
+	h.Set("X-Powered-By", "php")
+	h.Add("X-Old", "a")
+	h.Add("X-Old", "b")
+	h.Set("X-Replaced", "before")
+
+	rules := Rules{
+		Rename: map[string]string{"X-Old": "X-New"},
+		Remove: []string{"Server", "x-powered-by"},
+		Set:    map[string]string{"X-Replaced": "after", "X-Client-Ip": "{client_ip}"},
+		Add:    map[string]string{"X-New": "c"},
+	}
+
+	rules.Apply(h, NewVars(req, "/"))
+
+	assert.Empty(t, h.Get("Server"))
+	assert.Empty(t, h.Get("X-Powered-By"))
+	assert.Empty(t, h.Values("X-Old"))
+	assert.Equal(t, []string{"a", "b", "c"}, h.Values("X-New"))
+	assert.Equal(t, "after", h.Get("X-Replaced"))
+	assert.Equal(t, "10.0.0.1", h.Get("X-Client-Ip"))
+}
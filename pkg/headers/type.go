@@ -0,0 +1,13 @@
+package headers
+
+type Rules struct {
+	Rename map[string]string `yaml:"rename,omitempty"`
+	Remove []string          `yaml:"remove,omitempty"`
+	Set    map[string]string `yaml:"set,omitempty"`
+	Add    map[string]string `yaml:"add,omitempty"`
+}
+
+type Config struct {
+	Request  Rules `yaml:"request,omitempty"`
+	Response Rules `yaml:"response,omitempty"`
+}
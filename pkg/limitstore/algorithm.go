@@ -0,0 +1,199 @@
+package limitstore
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Validate checks the algorithm and the bounds of l
+func (l Limit) Validate() error {
+	switch l.Algorithm {
+	case "", TokenBucket, SlidingWindowLog, SlidingWindowCounter, GCRA:
+	default:
+		return fmt.Errorf("unknown algorithm: %s", l.Algorithm)
+	}
+
+	if l.Rate < 0 || l.Burst < 0 || l.Cooldown < 0 {
+		return fmt.Errorf("rate, burst and cooldown must not be negative")
+	}
+
+	return nil
+}
+
+// take runs the algorithm of l on the state of e, the state is reset when the
+// algorithm changed since it was created
+func take(e *Entry, l Limit, now time.Time) Result {
+	switch l.Algorithm {
+	case SlidingWindowLog:
+		return slidingWindowLog(e, l, now)
+	case SlidingWindowCounter:
+		return slidingWindowCounter(e, l, now)
+	case GCRA:
+		return genericCellRate(e, l, now)
+	}
+
+	return tokenBucket(e, l, now)
+}
+
+func tokenBucket(e *Entry, l Limit, now time.Time) Result {
+	limiter, _ := e.State.(*rate.Limiter)
+	if limiter == nil {
+		limiter = rate.NewLimiter(l.Rate, l.Burst)
+		e.State = limiter
+	}
+
+	// the config may have been reloaded since the limiter was created
+	if limiter.Limit() != l.Rate {
+		limiter.SetLimitAt(now, l.Rate)
+	}
+	if limiter.Burst() != l.Burst {
+		limiter.SetBurstAt(now, l.Burst)
+	}
+
+	res := Result{Allowed: limiter.AllowN(now, 1), Limit: l.Burst}
+
+	tokens := limiter.TokensAt(now)
+	res.Remaining = max(int(tokens), 0)
+	res.Reset = seconds((float64(l.Burst) - tokens) / float64(l.Rate))
+	if !res.Allowed {
+		res.RetryAfter = seconds((1 - tokens) / float64(l.Rate))
+	}
+
+	return res
+}
+
+// slidingWindowLog keeps the time of every request allowed in the window, at most Burst of them
+func slidingWindowLog(e *Entry, l Limit, now time.Time) Result {
+	log, _ := e.State.(*windowLog)
+	if log == nil {
+		log = &windowLog{}
+		e.State = log
+	}
+
+	window := l.window()
+
+	i := 0
+	for i < len(log.times) && now.Sub(log.times[i]) >= window {
+		i++
+	}
+	log.times = log.times[i:]
+
+	res := Result{Limit: l.Burst}
+
+	if len(log.times) < l.Burst {
+		log.times = append(log.times, now)
+		res.Allowed = true
+	} else {
+		res.RetryAfter = log.times[0].Add(window).Sub(now)
+	}
+
+	res.Remaining = max(l.Burst-len(log.times), 0)
+	if len(log.times) > 0 {
+		res.Reset = log.times[len(log.times)-1].Add(window).Sub(now)
+	}
+
+	return res
+}
+
+// slidingWindowCounter estimates the requests of the last window from the counts of the
+// current and the previous fixed windows, weighting the previous one by its overlap
+func slidingWindowCounter(e *Entry, l Limit, now time.Time) Result {
+	c, _ := e.State.(*windowCounter)
+	if c == nil {
+		c = &windowCounter{start: now}
+		e.State = c
+	}
+
+	window := l.window()
+
+	if elapsed := now.Sub(c.start); elapsed >= window {
+		n := elapsed / window
+		if n == 1 {
+			c.prev = c.curr
+		} else {
+			c.prev = 0
+		}
+		c.curr = 0
+		c.start = c.start.Add(n * window)
+	}
+
+	elapsed := now.Sub(c.start)
+	weight := float64(window-elapsed) / float64(window)
+	estimate := float64(c.prev)*weight + float64(c.curr)
+
+	res := Result{Limit: l.Burst}
+
+	if estimate+1 <= float64(l.Burst) {
+		c.curr++
+		estimate++
+		res.Allowed = true
+	} else if c.prev > 0 && c.curr+1 <= l.Burst {
+		// the previous window weighs less as time passes
+		overlap := float64(l.Burst-c.curr-1) / float64(c.prev)
+		res.RetryAfter = time.Duration((1-overlap)*float64(window)) - elapsed
+	} else {
+		// the current window becomes the previous one, wait for it to weigh little enough
+		overlap := math.Min(float64(l.Burst-1)/float64(c.curr), 1)
+		res.RetryAfter = window - elapsed + time.Duration((1-overlap)*float64(window))
+	}
+
+	res.Remaining = max(int(float64(l.Burst)-estimate), 0)
+	res.Reset = window - elapsed
+	if c.curr > 0 {
+		res.Reset += window
+	}
+
+	return res
+}
+
+// genericCellRate tracks the theoretical arrival time of the next request, requests
+// arriving more than Burst emission intervals early are refused
+func genericCellRate(e *Entry, l Limit, now time.Time) Result {
+	g, _ := e.State.(*gcra)
+	if g == nil {
+		g = &gcra{}
+		e.State = g
+	}
+
+	interval := seconds(1 / float64(l.Rate))
+	tolerance := interval * time.Duration(l.Burst)
+
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+
+	next := tat.Add(interval)
+	allowAt := next.Add(-tolerance)
+
+	res := Result{Limit: l.Burst}
+
+	if now.Before(allowAt) {
+		res.RetryAfter = allowAt.Sub(now)
+		res.Reset = tat.Sub(now)
+		return res
+	}
+
+	g.tat = next
+	res.Allowed = true
+	res.Remaining = int(now.Sub(allowAt) / interval)
+	res.Reset = next.Sub(now)
+
+	return res
+}
+
+// window is the time the sliding windows span, Burst requests at Rate
+func (l Limit) window() time.Duration {
+	return seconds(float64(l.Burst) / float64(l.Rate))
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 || math.IsNaN(s) {
+		return 0
+	}
+
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
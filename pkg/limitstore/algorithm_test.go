@@ -0,0 +1,116 @@
+package limitstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   Limit
+		wantErr bool
+	}{
+		{"Default", Limit{Rate: 1, Burst: 1}, false},
+		{"GCRA", Limit{Algorithm: GCRA, Rate: 1, Burst: 1}, false},
+		{"Unknown algorithm", Limit{Algorithm: "leaky"}, true},
+		{"Negative burst", Limit{Burst: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantErr, tt.limit.Validate() != nil)
+		})
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	type step struct {
+		after     time.Duration
+		allowed   bool
+		remaining int
+		retry     time.Duration
+	}
+
+	// 3 requests at once and 1 per second, the windows span 3 seconds
+	tests := []struct {
+		algorithm string
+		steps     []step
+	}{
+		{TokenBucket, []step{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, time.Second},
+			{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+			{500 * time.Millisecond, true, 0, 0},
+			{3 * time.Second, true, 2, 0},
+		}},
+		{SlidingWindowLog, []step{
+			{0, true, 2, 0},
+			{time.Second, true, 1, 0},
+			{time.Second, true, 0, 0},
+			{0, false, 0, time.Second},
+			{time.Second, true, 0, 0},
+			{0, false, 0, time.Second},
+		}},
+		{SlidingWindowCounter, []step{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, 4 * time.Second},
+			// a third of the previous window overlaps the last 3 seconds
+			{4 * time.Second, true, 0, 0},
+			{0, false, 0, time.Second},
+			{time.Second, true, 0, 0},
+		}},
+		{GCRA, []step{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, time.Second},
+			{time.Second, true, 0, 0},
+			{3 * time.Second, true, 2, 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			s, now := newStore(t, Config{})
+			l := Limit{Algorithm: tt.algorithm, Rate: 1, Burst: 3}
+
+			for i, step := range tt.steps {
+				*now = now.Add(step.after)
+
+				res := s.Take("client", l)
+				assert.Equal(t, step.allowed, res.Allowed, "step %d allowed", i)
+				assert.Equal(t, step.remaining, res.Remaining, "step %d remaining", i)
+				assert.Equal(t, step.retry, res.RetryAfter, "step %d retry", i)
+				assert.Equal(t, 3, res.Limit)
+			}
+		})
+	}
+
+	t.Run("Cooldown", func(t *testing.T) {
+		s, now := newStore(t, Config{})
+		l := Limit{Algorithm: GCRA, Rate: 1, Burst: 1, Cooldown: time.Minute}
+
+		assert.True(t, s.Take("client", l).Allowed)
+
+		res := s.Take("client", l)
+		assert.False(t, res.Allowed)
+		assert.Equal(t, time.Minute, res.RetryAfter)
+
+		*now = now.Add(30 * time.Second)
+		assert.Equal(t, 30*time.Second, s.Take("client", l).RetryAfter)
+	})
+
+	t.Run("Changed algorithm", func(t *testing.T) {
+		s, _ := newStore(t, Config{})
+
+		assert.True(t, s.Take("client", Limit{Rate: 1, Burst: 1}).Allowed)
+		assert.True(t, s.Take("client", Limit{Algorithm: SlidingWindowLog, Rate: 1, Burst: 1}).Allowed)
+	})
+}
@@ -0,0 +1,137 @@
+// Package limitstore is a sharded, bounded store for the per-client state of rate limiters
+package limitstore
+
+import (
+	"container/list"
+	"fmt"
+	"time"
+
+	"github.com/Dyastin-0/mrps/pkg/hash"
+)
+
+func New(c Config) (*Store, error) {
+	if c.MaxClients < 0 || c.TTL < 0 || c.Shards < 0 {
+		return nil, fmt.Errorf("max_clients, ttl and shards must not be negative")
+	}
+
+	if c.MaxClients == 0 {
+		c.MaxClients = DefaultMaxClients
+	}
+	if c.TTL == 0 {
+		c.TTL = DefaultTTL
+	}
+	if c.Shards == 0 {
+		c.Shards = DefaultShards
+	}
+	if c.Shards > c.MaxClients {
+		c.Shards = c.MaxClients
+	}
+
+	s := &Store{
+		shards:   make([]*shard, c.Shards),
+		capacity: (c.MaxClients + c.Shards - 1) / c.Shards,
+		ttl:      time.Duration(c.TTL) * time.Millisecond,
+		now:      time.Now,
+	}
+
+	for i := range s.shards {
+		s.shards[i] = &shard{
+			entries: make(map[string]*list.Element),
+			lru:     list.New(),
+		}
+	}
+
+	return s, nil
+}
+
+// Do runs fn on the entry of key under the lock of its shard, creating it when missing.
+// LastReq is updated once fn returns
+func (s *Store) Do(key string, fn func(e *Entry, now time.Time)) {
+	sh := s.shards[hash.FNV(key)%uint32(len(s.shards))]
+	now := s.now()
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	sh.expire(now, s.ttl)
+
+	var e *Entry
+	if elem, ok := sh.entries[key]; ok {
+		e = elem.Value.(*Entry)
+		sh.lru.MoveToFront(elem)
+	} else {
+		for sh.lru.Len() >= s.capacity {
+			sh.remove(sh.lru.Back())
+		}
+		e = &Entry{Key: key}
+		sh.entries[key] = sh.lru.PushFront(e)
+	}
+
+	fn(e, now)
+	e.LastReq = now
+}
+
+// Take counts a request of key against l
+func (s *Store) Take(key string, l Limit) (res Result) {
+	s.Do(key, func(e *Entry, now time.Time) {
+		if now.Before(e.Cooldown) {
+			wait := e.Cooldown.Sub(now)
+			res = Result{Limit: l.Burst, Reset: wait, RetryAfter: wait}
+			return
+		}
+
+		res = take(e, l, now)
+
+		if !res.Allowed && l.Cooldown > 0 {
+			e.Cooldown = now.Add(l.Cooldown)
+			res.RetryAfter = max(res.RetryAfter, l.Cooldown)
+			res.Reset = max(res.Reset, l.Cooldown)
+		}
+	})
+
+	return res
+}
+
+// Sweep evicts the entries not seen for the TTL
+func (s *Store) Sweep() {
+	now := s.now()
+
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		sh.expire(now, s.ttl)
+		sh.mu.Unlock()
+	}
+}
+
+// Len returns the number of tracked clients
+func (s *Store) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	n := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		n += sh.lru.Len()
+		sh.mu.Unlock()
+	}
+
+	return n
+}
+
+// expire drops expired entries from the back of the list, it stops at the first live one
+// so an entry still cooling down shields older ones until the next sweep past its cooldown
+func (sh *shard) expire(now time.Time, ttl time.Duration) {
+	for elem := sh.lru.Back(); elem != nil; elem = sh.lru.Back() {
+		e := elem.Value.(*Entry)
+		if now.Sub(e.LastReq) < ttl || now.Before(e.Cooldown) {
+			return
+		}
+		sh.remove(elem)
+	}
+}
+
+func (sh *shard) remove(elem *list.Element) {
+	delete(sh.entries, elem.Value.(*Entry).Key)
+	sh.lru.Remove(elem)
+}
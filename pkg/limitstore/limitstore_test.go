@@ -0,0 +1,157 @@
+package limitstore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func newStore(t *testing.T, c Config) (*Store, *time.Time) {
+	t.Helper()
+
+	s, err := New(c)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	return s, &now
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"Defaults", Config{}, false},
+		{"Custom", Config{MaxClients: 10, TTL: 1000, Shards: 2}, false},
+		{"Negative max clients", Config{MaxClients: -1}, true},
+		{"Negative ttl", Config{TTL: -1}, true},
+		{"Negative shards", Config{Shards: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.config)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	s, now := newStore(t, Config{})
+
+	assert.True(t, ok(allow(s, "client", 1, 2, time.Minute)))
+	assert.True(t, ok(allow(s, "client", 1, 2, time.Minute)))
+
+	retry, allowed := allow(s, "client", 1, 2, time.Minute)
+	assert.False(t, allowed)
+	assert.Equal(t, now.Add(time.Minute), retry)
+
+	t.Run("Separate clients", func(t *testing.T) {
+		assert.True(t, ok(allow(s, "other", 1, 2, time.Minute)))
+	})
+
+	t.Run("Cooldown", func(t *testing.T) {
+		*now = now.Add(30 * time.Second)
+		assert.False(t, ok(allow(s, "client", 1, 2, time.Minute)))
+
+		*now = now.Add(31 * time.Second)
+		assert.True(t, ok(allow(s, "client", 1, 2, time.Minute)))
+	})
+
+	t.Run("Reloaded limit", func(t *testing.T) {
+		assert.True(t, ok(allow(s, "reloaded", 1, 1, 0)))
+		assert.False(t, ok(allow(s, "reloaded", 100, 1, 0)))
+
+		// a token every second would still be refused
+		*now = now.Add(20 * time.Millisecond)
+		assert.True(t, ok(allow(s, "reloaded", 100, 1, 0)))
+	})
+}
+
+func TestEviction(t *testing.T) {
+	t.Run("TTL", func(t *testing.T) {
+		s, now := newStore(t, Config{TTL: 1000})
+
+		allow(s, "a", 1, 1, time.Millisecond)
+		allow(s, "b", 1, 1, time.Millisecond)
+		assert.Equal(t, 2, s.Len())
+
+		*now = now.Add(500 * time.Millisecond)
+		allow(s, "b", 1, 1, time.Millisecond)
+
+		*now = now.Add(600 * time.Millisecond)
+		s.Sweep()
+		assert.Equal(t, 1, s.Len())
+
+		*now = now.Add(time.Second)
+		s.Sweep()
+		assert.Equal(t, 0, s.Len())
+	})
+
+	t.Run("Kept while cooling down", func(t *testing.T) {
+		s, now := newStore(t, Config{TTL: 1000})
+
+		allow(s, "a", 1, 1, time.Minute)
+		allow(s, "a", 1, 1, time.Minute)
+
+		*now = now.Add(2 * time.Second)
+		s.Sweep()
+		assert.Equal(t, 1, s.Len())
+		assert.False(t, ok(allow(s, "a", 1, 1, time.Minute)))
+	})
+
+	t.Run("Max clients", func(t *testing.T) {
+		s, now := newStore(t, Config{MaxClients: 2, Shards: 1})
+
+		allow(s, "a", 1, 1, time.Minute)
+		*now = now.Add(time.Millisecond)
+		allow(s, "b", 1, 1, time.Minute)
+		*now = now.Add(time.Millisecond)
+		allow(s, "a", 1, 1, time.Minute)
+		*now = now.Add(time.Millisecond)
+		allow(s, "c", 1, 1, time.Minute)
+
+		assert.Equal(t, 2, s.Len())
+
+		// b was the least recently seen, it starts over with a full bucket
+		assert.True(t, ok(allow(s, "b", 1, 1, time.Minute)))
+	})
+}
+
+func TestConcurrent(t *testing.T) {
+	s, err := New(Config{MaxClients: 64, Shards: 4})
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				allow(s, fmt.Sprintf("client-%d", (i*j)%100), 10, 5, time.Millisecond)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, s.Len(), 64)
+}
+
+// allow takes from a token bucket of burst refilled at r, refused clients cool down for cooldown
+func allow(s *Store, key string, r rate.Limit, burst int, cooldown time.Duration) (time.Time, bool) {
+	res := s.Take(key, Limit{Rate: r, Burst: burst, Cooldown: cooldown})
+	return s.now().Add(res.RetryAfter), res.Allowed
+}
+
+func ok(_ time.Time, ok bool) bool {
+	return ok
+}
@@ -0,0 +1,89 @@
+package limitstore
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	DefaultMaxClients = 100000
+	DefaultTTL        = 600000
+	DefaultShards     = 32
+)
+
+// algorithms, the windows of the sliding ones last Burst / Rate seconds
+const (
+	TokenBucket          = "token_bucket"
+	SlidingWindowLog     = "sliding_window_log"
+	SlidingWindowCounter = "sliding_window_counter"
+	GCRA                 = "gcra"
+)
+
+// Config bounds the store, TTL is in milliseconds, zero values use the defaults
+type Config struct {
+	MaxClients int   `yaml:"max_clients,omitempty"`
+	TTL        int64 `yaml:"ttl,omitempty"`
+	Shards     int   `yaml:"shards,omitempty"`
+}
+
+// Entry is the state of a client, it is only accessed under the lock of its shard
+type Entry struct {
+	Key      string
+	State    any
+	LastReq  time.Time
+	Cooldown time.Time
+}
+
+// Store keeps client entries in shards, each one evicts its least recently seen
+// entries when full and those not seen for TTL
+type Store struct {
+	shards   []*shard
+	capacity int
+	ttl      time.Duration
+
+	now func() time.Time
+}
+
+type shard struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+// Limit allows Burst requests at once and Rate per second on average, clients refused
+// wait for Cooldown on top of what the algorithm asks when it is set
+type Limit struct {
+	Algorithm string
+	Rate      rate.Limit
+	Burst     int
+	Cooldown  time.Duration
+}
+
+// Result describes the quota of a client after a request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Reset is the time until the quota is full again
+	Reset time.Duration
+
+	// RetryAfter is the time until a refused client is allowed again
+	RetryAfter time.Duration
+}
+
+type windowLog struct {
+	times []time.Time
+}
+
+type windowCounter struct {
+	start      time.Time
+	prev, curr int
+}
+
+type gcra struct {
+	tat time.Time
+}
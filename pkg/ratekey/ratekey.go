@@ -0,0 +1,200 @@
+// Package ratekey evaluates rate limit key expressions such as "{client_ip}",
+// "{header.X-Api-Key}" or "{jwt.sub}:{path}" against requests
+package ratekey
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Dyastin-0/mrps/pkg/forwarded"
+)
+
+// Parse compiles expr, an empty expression is Default
+func Parse(expr string) (Key, error) {
+	if expr == "" {
+		expr = Default
+	}
+
+	k := Key{expr: expr}
+
+	for rest := expr; rest != ""; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			k.parts = append(k.parts, part{kind: literal, value: rest})
+			break
+		}
+		if start > 0 {
+			k.parts = append(k.parts, part{kind: literal, value: rest[:start]})
+		}
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return Key{}, fmt.Errorf("unclosed placeholder in key: %s", expr)
+		}
+		end += start
+
+		p, err := parsePlaceholder(rest[start+1 : end])
+		if err != nil {
+			return Key{}, fmt.Errorf("%v in key: %s", err, expr)
+		}
+		k.parts = append(k.parts, p)
+
+		rest = rest[end+1:]
+	}
+
+	return k, nil
+}
+
+// ValidateMissing checks an on_missing setting, empty is MissingIP
+func ValidateMissing(onMissing string) error {
+	switch onMissing {
+	case "", MissingIP, MissingSkip, MissingRefuse:
+		return nil
+	}
+
+	return fmt.Errorf("unknown on_missing: %s", onMissing)
+}
+
+func parsePlaceholder(name string) (part, error) {
+	kind, value, _ := strings.Cut(name, ".")
+
+	switch kind {
+	case clientIP, host, method, path:
+		if value != "" {
+			return part{}, fmt.Errorf("{%s} takes no name", kind)
+		}
+	case header, cookie, query, jwt:
+		if value == "" {
+			return part{}, fmt.Errorf("{%s} needs a name", kind)
+		}
+		if kind == header {
+			value = http.CanonicalHeaderKey(value)
+		}
+	default:
+		return part{}, fmt.Errorf("unknown placeholder {%s}", name)
+	}
+
+	return part{kind: kind, value: value}, nil
+}
+
+func (k Key) String() string {
+	if k.expr == "" {
+		return Default
+	}
+
+	return k.expr
+}
+
+// EvalClientIP returns the key of a connection from ip, ok is false when k depends on
+// more than the client IP. Such keys only apply to HTTP requests
+func (k Key) EvalClientIP(ip string) (key string, ok bool) {
+	var b strings.Builder
+
+	for _, p := range k.parts {
+		switch p.kind {
+		case literal:
+			b.WriteString(p.value)
+		case clientIP:
+			b.WriteString(ip)
+		default:
+			return "", false
+		}
+	}
+
+	if len(k.parts) == 0 {
+		return ip, true
+	}
+
+	return b.String(), true
+}
+
+// Eval returns the key of r, ok is false when a value it references is missing
+func (k Key) Eval(r *http.Request) (key string, ok bool) {
+	if len(k.parts) == 0 {
+		return forwarded.ClientIP(r), true
+	}
+
+	var b strings.Builder
+
+	for _, p := range k.parts {
+		value, ok := p.eval(r)
+		if !ok {
+			return "", false
+		}
+		b.WriteString(value)
+	}
+
+	return b.String(), true
+}
+
+func (p part) eval(r *http.Request) (string, bool) {
+	switch p.kind {
+	case literal:
+		return p.value, true
+	case clientIP:
+		return forwarded.ClientIP(r), true
+	case host:
+		return r.Host, true
+	case method:
+		return r.Method, true
+	case path:
+		return r.URL.Path, true
+	case header:
+		value := r.Header.Get(p.value)
+		return value, value != ""
+	case cookie:
+		c, err := r.Cookie(p.value)
+		if err != nil || c.Value == "" {
+			return "", false
+		}
+		return c.Value, true
+	case query:
+		value := r.URL.Query().Get(p.value)
+		return value, value != ""
+	case jwt:
+		return claim(r, p.value)
+	}
+
+	return "", false
+}
+
+// claim reads a claim of the bearer token, the signature is not verified so the
+// claim only partitions counters and must not be trusted for anything else
+func claim(r *http.Request, name string) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+
+	segments := strings.Split(strings.TrimSpace(token), ".")
+	if len(segments) != 3 {
+		return "", false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[1], "="))
+	if err != nil {
+		return "", false
+	}
+
+	var claims map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return "", false
+	}
+
+	switch value := claims[name].(type) {
+	case string:
+		return value, value != ""
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return fmt.Sprint(value), true
+	}
+
+	return "", false
+}
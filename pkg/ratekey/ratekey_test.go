@@ -0,0 +1,121 @@
+package ratekey
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func token(payload string) string {
+	return "Bearer e30." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{"Empty", "", false},
+		{"Client IP", "{client_ip}", false},
+		{"Combined", "api:{header.x-api-key}:{path}", false},
+		{"JWT claim", "{jwt.sub}", false},
+		{"Literal", "everyone", false},
+		{"Unknown placeholder", "{user}", true},
+		{"Missing name", "{header}", true},
+		{"Unexpected name", "{path.x}", true},
+		{"Unclosed", "{client_ip", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/api/items?tenant=acme", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Api-Key", "secret")
+	r.Header.Set("Authorization", token(`{"sub":"user-1","org":42}`))
+	r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+	tests := []struct {
+		name   string
+		expr   string
+		want   string
+		wantOK bool
+	}{
+		{"Default", "", "10.0.0.1", true},
+		{"Header", "{header.x-api-key}", "secret", true},
+		{"Cookie", "{cookie.session}", "abc", true},
+		{"Query", "{query.tenant}", "acme", true},
+		{"JWT string claim", "{jwt.sub}", "user-1", true},
+		{"JWT number claim", "{jwt.org}", "42", true},
+		{"Combined", "{client_ip}|{method}|{host}{path}", "10.0.0.1|GET|example.com/api/items", true},
+		{"Missing header", "{header.x-other}", "", false},
+		{"Missing cookie", "{cookie.other}", "", false},
+		{"Missing claim", "{jwt.email}", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := Parse(tt.expr)
+			assert.NoError(t, err)
+
+			got, ok := k.Eval(r)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("Zero key", func(t *testing.T) {
+		got, ok := Key{}.Eval(r)
+		assert.True(t, ok)
+		assert.Equal(t, "10.0.0.1", got)
+	})
+
+	t.Run("Malformed token", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer not-a-jwt")
+
+		k, _ := Parse("{jwt.sub}")
+		_, ok := k.Eval(r)
+		assert.False(t, ok)
+	})
+}
+
+func TestEvalClientIP(t *testing.T) {
+	tests := []struct {
+		expr   string
+		want   string
+		wantOK bool
+	}{
+		{"", "10.0.0.1", true},
+		{"tcp:{client_ip}", "tcp:10.0.0.1", true},
+		{"{client_ip}:{path}", "", false},
+		{"{header.x-api-key}", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			k, err := Parse(tt.expr)
+			assert.NoError(t, err)
+
+			got, ok := k.EvalClientIP("10.0.0.1")
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateMissing(t *testing.T) {
+	assert.NoError(t, ValidateMissing(""))
+	assert.NoError(t, ValidateMissing(MissingRefuse))
+	assert.Error(t, ValidateMissing("allow"))
+}
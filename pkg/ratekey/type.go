@@ -0,0 +1,38 @@
+package ratekey
+
+// Default keys limits by client IP
+const Default = "{client_ip}"
+
+// what a limit does with requests missing a value its key references
+const (
+	// MissingIP counts them by client IP, in buckets apart from the keyed ones
+	MissingIP = "ip"
+	// MissingSkip lets them through the limit
+	MissingSkip = "skip"
+	// MissingRefuse refuses them
+	MissingRefuse = "refuse"
+)
+
+// placeholder kinds, those taking a name are written {kind.name}
+const (
+	literal  = ""
+	clientIP = "client_ip"
+	host     = "host"
+	method   = "method"
+	path     = "path"
+	header   = "header"
+	cookie   = "cookie"
+	query    = "query"
+	jwt      = "jwt"
+)
+
+// Key is a parsed key expression, the zero value keys by client IP
+type Key struct {
+	expr  string
+	parts []part
+}
+
+type part struct {
+	kind  string
+	value string
+}
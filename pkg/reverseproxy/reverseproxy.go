@@ -1,51 +1,104 @@
 package reverseproxy
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"time"
 
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
+	"github.com/Dyastin-0/mrps/pkg/grpc"
+	"github.com/Dyastin-0/mrps/pkg/headers"
 	"github.com/Dyastin-0/mrps/pkg/rewriter"
+	"github.com/Dyastin-0/mrps/pkg/timeout"
 	"github.com/rs/zerolog/log"
 )
 
-func New(target string, rr rewriter.RewriteRule) http.Handler {
-	targetURL, err := url.Parse(target)
+func New(upstream Upstream, config Config) http.Handler {
+	return NewWithTransport(upstream, config, NewTransport(upstream, config))
+}
+
+// NewWithTransport is New with a transport shared with other users of the upstream, such as health checks
+func NewWithTransport(upstream Upstream, config Config, transport http.RoundTripper) http.Handler {
+	targetURL, err := url.Parse(upstream.URL)
 	if err != nil {
 		log.Fatal().Err(err).Msg("proxy")
 	}
 
-	transport := &http.Transport{
-		MaxIdleConns:        10,
-		MaxIdleConnsPerHost: 5,
-		IdleConnTimeout:     30 * time.Second,
-		DisableKeepAlives:   false,
-	}
-
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
 	proxy.Transport = transport
+	proxy.FlushInterval = config.FlushInterval
 	proxy.Director = func(req *http.Request) {
 		req.URL.Scheme = targetURL.Scheme
 		req.URL.Host = targetURL.Host
 
-		rw := rewriter.New(rr)
+		rw := rewriter.New(config.RewriteRule)
 
 		rewrittenPath := rw.RewritePath(req.URL.Path)
 
 		req.URL.Path = rewrittenPath
 
-		if req.Header.Get("Upgrade") != "" {
-			req.Header.Set("Connection", "Upgrade")
-			req.Header.Set("Upgrade", "websocket")
-		} else {
-			req.Header.Set("Connection", "keep-alive")
-		}
+		config.Forwarded.Apply(req)
+
+		config.Headers.Request.Apply(req.Header, headers.FromContext(req.Context()))
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		config.Headers.Response.Apply(resp.Header, headers.FromContext(resp.Request.Context()))
+		return nil
+	}
+	proxy.ErrorHandler = errorHandler
+
+	if config.Headers.Empty() {
+		return proxy
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := headers.NewVars(r, config.Route)
+		proxy.ServeHTTP(w, r.WithContext(headers.WithVars(r.Context(), vars)))
+	})
+}
+
+func errorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	log.Error().Err(err).Str("host", r.Host).Str("path", r.URL.Path).Msg("proxy")
+
+	if grpc.IsGRPC(r) {
+		grpcError(w, err)
+		return
+	}
+
+	if errors.Is(err, context.Canceled) {
+		// the client went away, there is no one to reply to
+		w.WriteHeader(499)
+		return
+	}
 
-		req.Header.Set("X-Forwarded-For", req.RemoteAddr)
-		req.Header.Set("X-Forwarded-Host", req.Host)
-		req.Header.Set("X-Real-Ip", req.RemoteAddr)
+	if timeout.ClientTimedOut(r.Context()) {
+		w.Header().Set("Connection", "close")
+		errorpage.Write(w, r, http.StatusRequestTimeout, "request timed out")
+		return
 	}
 
-	return proxy
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		errorpage.Write(w, r, http.StatusGatewayTimeout, "upstream timed out")
+		return
+	}
+
+	errorpage.Write(w, r, http.StatusBadGateway, "upstream unavailable")
+}
+
+// grpcError replies in the gRPC protocol, clients don't understand error pages
+func grpcError(w http.ResponseWriter, err error) {
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		grpc.WriteError(w, grpc.Canceled, "client canceled")
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		grpc.WriteError(w, grpc.DeadlineExceeded, "upstream timed out")
+	default:
+		grpc.WriteError(w, grpc.Unavailable, "upstream unavailable")
+	}
 }
@@ -2,79 +2,91 @@ package reverseproxy
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var ErrIdle = errors.New("tcp connection idle")
+
 type TCPProxy struct {
 	Addr string
-	// optional for tls
-	WithTLS bool
+	// optional for tls, the SNI of the client is used when TLSConfig has no server name
+	WithTLS   bool
+	TLSConfig *tls.Config
+
+	// zero disables each timeout, idle counts traffic in both directions
+	ConnectTimeout time.Duration
+	IdleTimeout    time.Duration
+	MaxLifetime    time.Duration
 }
 
 func (t *TCPProxy) ForwardTLS(dst net.Conn, sni string) error {
-	if sni == "" {
-		return fmt.Errorf("tls missing sni")
+	config := &tls.Config{}
+	if t.TLSConfig != nil {
+		config = t.TLSConfig.Clone()
 	}
 
-	tlsconfig := &tls.Config{
-		ServerName: sni,
+	if config.ServerName == "" {
+		config.ServerName = sni
 	}
 
-	src, err := tls.Dial("tcp", t.Addr, tlsconfig)
-	if err != nil {
+	if config.ServerName == "" {
 		dst.Close()
-		return fmt.Errorf("failed to dial tls: %v", err)
+		return fmt.Errorf("tls missing sni")
 	}
 
-	errch := make(chan error, 2)
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	go func() {
-		errch <- t.stream(src, dst)
-		wg.Done()
-	}()
-
-	go func() {
-		errch <- t.stream(dst, src)
-		wg.Done()
-	}()
-
-	go func() {
-		wg.Wait()
-		close(errch)
-	}()
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: t.ConnectTimeout},
+		Config:    config,
+	}
 
-	for err := range errch {
-		if err != nil {
-			return err
-		}
+	src, err := dialer.Dial("tcp", t.Addr)
+	if err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to dial tls: %v", err)
 	}
 
-	return nil
+	return t.pipe(src, dst)
 }
 
 func (t *TCPProxy) Forward(dst net.Conn) error {
-	src, err := net.Dial("tcp", t.Addr)
+	src, err := net.DialTimeout("tcp", t.Addr, t.ConnectTimeout)
 	if err != nil {
 		dst.Close()
 		return err
 	}
 
+	return t.pipe(src, dst)
+}
+
+func (t *TCPProxy) pipe(src, dst net.Conn) error {
+	if t.MaxLifetime > 0 {
+		timer := time.AfterFunc(t.MaxLifetime, func() {
+			src.Close()
+			dst.Close()
+		})
+		defer timer.Stop()
+	}
+
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+
 	errch := make(chan error, 2)
 	var wg sync.WaitGroup
 	wg.Add(2)
 
 	go func() {
-		errch <- t.stream(src, dst)
+		errch <- t.stream(src, dst, &lastActive)
 		wg.Done()
 	}()
 
 	go func() {
-		errch <- t.stream(dst, src)
+		errch <- t.stream(dst, src, &lastActive)
 		wg.Done()
 	}()
 
@@ -92,13 +104,44 @@ func (t *TCPProxy) Forward(dst net.Conn) error {
 	return nil
 }
 
-func (t *TCPProxy) stream(src, dst net.Conn) error {
+func (t *TCPProxy) stream(src, dst net.Conn, lastActive *atomic.Int64) error {
 	defer dst.Close()
 
-	_, err := io.Copy(dst, src)
-	if err != nil {
+	if t.IdleTimeout <= 0 {
+		_, err := io.Copy(dst, src)
 		return err
 	}
 
-	return nil
+	buf := make([]byte, 32<<10)
+
+	for {
+		src.SetReadDeadline(time.Now().Add(t.IdleTimeout))
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			lastActive.Store(time.Now().UnixNano())
+
+			if _, err := dst.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// the other direction may still be busy
+			if time.Since(time.Unix(0, lastActive.Load())) < t.IdleTimeout {
+				continue
+			}
+
+			return ErrIdle
+		}
+
+		if err != nil {
+			return err
+		}
+	}
 }
@@ -0,0 +1,171 @@
+package reverseproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func echoListener(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func forward(proxy *TCPProxy) (net.Conn, <-chan error) {
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		done <- proxy.Forward(server)
+	}()
+
+	return client, done
+}
+
+func TestTCPProxyTimeouts(t *testing.T) {
+	addr := echoListener(t)
+
+	t.Run("Idle", func(t *testing.T) {
+		client, done := forward(&TCPProxy{Addr: addr, IdleTimeout: 100 * time.Millisecond})
+		defer client.Close()
+
+		buf := make([]byte, 4)
+		for i := 0; i < 3; i++ {
+			time.Sleep(50 * time.Millisecond)
+
+			client.Write([]byte("ping"))
+			_, err := io.ReadFull(client, buf)
+			assert.NoError(t, err)
+		}
+
+		select {
+		case err := <-done:
+			assert.ErrorIs(t, err, ErrIdle)
+		case <-time.After(time.Second):
+			t.Fatal("idle connection was not closed")
+		}
+	})
+
+	t.Run("Lifetime", func(t *testing.T) {
+		client, done := forward(&TCPProxy{Addr: addr, MaxLifetime: 100 * time.Millisecond})
+		defer client.Close()
+
+		start := time.Now()
+
+		select {
+		case <-done:
+			assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+		case <-time.After(time.Second):
+			t.Fatal("connection outlived its lifetime")
+		}
+	})
+
+}
+
+// tlsEchoListener echoes back the common name of the client certificate
+func tlsEchoListener(t *testing.T, cert tls.Certificate, clientCAs *x509.CertPool) string {
+	t.Helper()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				tlsConn := conn.(*tls.Conn)
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				tlsConn.Write([]byte(tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName))
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestTCPProxyTLS(t *testing.T) {
+	serverCert, serverKey := certificate(t, "backend.internal")
+	clientCert, clientKey := certificate(t, "mrps")
+
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	assert.NoError(t, err)
+
+	clientTLS, err := (&TLSConfig{CA: clientCert}).Build()
+	assert.NoError(t, err)
+
+	addr := tlsEchoListener(t, cert, clientTLS.RootCAs)
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		sni     string
+		wantErr bool
+	}{
+		{"Client SNI", TLSConfig{CA: serverCert, Cert: clientCert, Key: clientKey}, "backend.internal", false},
+		{"Server name override", TLSConfig{CA: serverCert, Cert: clientCert, Key: clientKey, ServerName: "backend.internal"}, "domain.com", false},
+		{"Unknown CA", TLSConfig{Cert: clientCert, Key: clientKey}, "backend.internal", true},
+		{"Missing sni", TLSConfig{CA: serverCert, Cert: clientCert, Key: clientKey}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := tt.config.Build()
+			assert.NoError(t, err)
+
+			proxy := &TCPProxy{Addr: addr, WithTLS: true, TLSConfig: tlsConfig}
+
+			client, server := net.Pipe()
+			defer client.Close()
+
+			done := make(chan error, 1)
+			go func() {
+				done <- proxy.ForwardTLS(server, tt.sni)
+			}()
+
+			if tt.wantErr {
+				assert.Error(t, <-done)
+				return
+			}
+
+			buf := make([]byte, 4)
+			_, err = io.ReadFull(client, buf)
+			assert.NoError(t, err)
+			assert.Equal(t, "mrps", string(buf))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package reverseproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/Dyastin-0/mrps/pkg/tlspolicy"
+)
+
+// Build loads the files of c into a tls.Config
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.MinVersion != "" {
+		version, err := tlspolicy.ParseVersion(c.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		config.MinVersion = version
+	}
+
+	ciphers, err := tlspolicy.ParseCiphers(c.Ciphers)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphers) > 0 {
+		config.CipherSuites = ciphers
+	}
+
+	if c.CA != "" {
+		data, err := os.ReadFile(c.CA)
+		if err != nil {
+			return nil, fmt.Errorf("tls ca: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("tls ca: no certificates found in %s", c.CA)
+		}
+		config.RootCAs = pool
+	}
+
+	if (c.Cert == "") != (c.Key == "") {
+		return nil, fmt.Errorf("tls cert and key must be set together")
+	}
+
+	if c.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("tls client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
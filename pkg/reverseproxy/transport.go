@@ -0,0 +1,189 @@
+package reverseproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"time"
+
+	"github.com/Dyastin-0/mrps/pkg/timeout"
+	"golang.org/x/net/http2"
+)
+
+// Validate checks that the protocol can be used with the URL's scheme
+func (u Upstream) Validate(grpc bool) error {
+	target, err := url.Parse(u.URL)
+	if err != nil {
+		return err
+	}
+
+	switch protocol(u, grpc) {
+	case "", HTTP1:
+	case H2:
+		if target.Scheme != "https" {
+			return fmt.Errorf("%s requires an https url: %s", H2, u.URL)
+		}
+	case H2C:
+		if target.Scheme != "http" {
+			return fmt.Errorf("%s requires an http url: %s", H2C, u.URL)
+		}
+	default:
+		return fmt.Errorf("unsupported upstream protocol: %s", u.Protocol)
+	}
+
+	if grpc && protocol(u, grpc) == HTTP1 {
+		return fmt.Errorf("grpc requires %s or %s: %s", H2, H2C, u.URL)
+	}
+
+	return nil
+}
+
+// protocol resolves the default, gRPC always needs HTTP/2
+func protocol(u Upstream, grpc bool) string {
+	if u.Protocol != "" || !grpc {
+		return u.Protocol
+	}
+
+	if target, err := url.Parse(u.URL); err == nil && target.Scheme == "https" {
+		return H2
+	}
+
+	return H2C
+}
+
+const (
+	defaultMaxIdle        = 10
+	defaultMaxIdlePerHost = 5
+	defaultIdleTimeout    = 30 * time.Second
+)
+
+// NewTransport returns the round tripper for u
+func NewTransport(u Upstream, config Config) *Transport {
+	t := &Transport{}
+	t.next = timeout.Transport(t.newTransport(u, config), config.FirstByteTimeout)
+	return t
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.requests.Add(1)
+			if info.Reused {
+				t.reused.Add(1)
+			}
+		},
+	}
+
+	return t.next.RoundTrip(r.WithContext(httptrace.WithClientTrace(r.Context(), trace)))
+}
+
+// Stats returns the connection counters of t
+func (t *Transport) Stats() PoolStats {
+	return PoolStats{
+		Open:     t.open.Load(),
+		Requests: t.requests.Load(),
+		Reused:   t.reused.Load(),
+	}
+}
+
+// Add sums the counters of other into s
+func (s *PoolStats) Add(other PoolStats) {
+	s.Open += other.Open
+	s.Requests += other.Requests
+	s.Reused += other.Reused
+}
+
+func (t *Transport) newTransport(u Upstream, config Config) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   config.ConnectTimeout,
+		KeepAlive: time.Duration(u.Pool.KeepAlive) * time.Millisecond,
+	}
+
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		t.open.Add(1)
+		return &countedConn{Conn: conn, transport: t}, nil
+	}
+
+	idleTimeout := defaultIdleTimeout
+	if u.Pool.IdleTimeout > 0 {
+		idleTimeout = time.Duration(u.Pool.IdleTimeout) * time.Millisecond
+	}
+
+	switch protocol(u, config.GRPC) {
+	case H2:
+		return &http2.Transport{
+			TLSClientConfig: u.TLS,
+			IdleConnTimeout: idleTimeout,
+			ReadIdleTimeout: 30 * time.Second,
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				conn, err := dial(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+
+				tlsConn := tls.Client(conn, cfg)
+				if err := tlsConn.HandshakeContext(ctx); err != nil {
+					tlsConn.Close()
+					return nil, err
+				}
+
+				return tlsConn, nil
+			},
+		}
+
+	case H2C:
+		return &http2.Transport{
+			AllowHTTP:       true,
+			IdleConnTimeout: idleTimeout,
+			ReadIdleTimeout: 30 * time.Second,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dial(ctx, network, addr)
+			},
+		}
+	}
+
+	transport := &http.Transport{
+		DialContext:         dial,
+		TLSClientConfig:     u.TLS,
+		TLSHandshakeTimeout: config.ConnectTimeout,
+		MaxIdleConns:        defaultMaxIdle,
+		MaxIdleConnsPerHost: defaultMaxIdlePerHost,
+		MaxConnsPerHost:     u.Pool.MaxPerHost,
+		IdleConnTimeout:     idleTimeout,
+		DisableKeepAlives:   u.Pool.DisableKeepAlives,
+		// a custom dialer turns the automatic HTTP/2 upgrade off unless forced
+		ForceAttemptHTTP2: u.Protocol != HTTP1,
+	}
+
+	if u.Pool.MaxIdle > 0 {
+		transport.MaxIdleConns = u.Pool.MaxIdle
+	}
+
+	if u.Pool.MaxIdlePerHost > 0 {
+		transport.MaxIdleConnsPerHost = u.Pool.MaxIdlePerHost
+	}
+
+	if u.Protocol == HTTP1 {
+		// a non-nil empty map disables the automatic HTTP/2 upgrade
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return transport
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.transport.open.Add(-1)
+	})
+
+	return c.Conn.Close()
+}
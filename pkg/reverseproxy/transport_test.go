@@ -0,0 +1,131 @@
+package reverseproxy
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Dyastin-0/mrps/internal/testcert"
+	"github.com/stretchr/testify/assert"
+)
+
+// certificate writes a self-signed certificate for name and its key, it is its own CA
+func certificate(t *testing.T, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	return testcert.Write(t, t.TempDir(), name, testcert.SelfSigned(t, name))
+}
+
+func get(t *testing.T, transport http.RoundTripper, url string) (*http.Response, error) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(t, err)
+
+	resp, err := transport.RoundTrip(req)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	return resp, err
+}
+
+func TestTransportPool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	t.Run("Reuse", func(t *testing.T) {
+		transport := NewTransport(Upstream{URL: server.URL}, Config{})
+
+		for range 3 {
+			_, err := get(t, transport, server.URL)
+			assert.NoError(t, err)
+		}
+
+		stats := transport.Stats()
+		assert.Equal(t, int64(1), stats.Open)
+		assert.Equal(t, int64(3), stats.Requests)
+		assert.Equal(t, int64(2), stats.Reused)
+	})
+
+	t.Run("DisableKeepAlives", func(t *testing.T) {
+		transport := NewTransport(Upstream{URL: server.URL, Pool: PoolConfig{DisableKeepAlives: true}}, Config{})
+
+		for range 3 {
+			_, err := get(t, transport, server.URL)
+			assert.NoError(t, err)
+		}
+
+		stats := transport.Stats()
+		assert.Equal(t, int64(3), stats.Requests)
+		assert.Equal(t, int64(0), stats.Reused)
+		assert.Eventually(t, func() bool { return transport.Stats().Open == 0 }, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestTransportTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	ca := testcert.WriteCert(t, t.TempDir(), "ca", server.Certificate())
+	cert, key := certificate(t, "mrps")
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		wantErr bool
+	}{
+		{"CA and client certificate", TLSConfig{CA: ca, Cert: cert, Key: key}, false},
+		{"Skip verify", TLSConfig{InsecureSkipVerify: true, Cert: cert, Key: key}, false},
+		{"Unknown CA", TLSConfig{Cert: cert, Key: key}, true},
+		{"Missing client certificate", TLSConfig{CA: ca}, true},
+		{"Server name mismatch", TLSConfig{CA: ca, Cert: cert, Key: key, ServerName: "mrps.local"}, true},
+		{"Min version", TLSConfig{CA: ca, Cert: cert, Key: key, MinVersion: "1.3"}, false},
+		{"Ciphers", TLSConfig{CA: ca, Cert: cert, Key: key, MinVersion: "1.2", Ciphers: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := tt.config.Build()
+			assert.NoError(t, err)
+
+			transport := NewTransport(Upstream{URL: server.URL, TLS: tlsConfig}, Config{})
+
+			resp, err := get(t, transport, server.URL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+
+	invalid := []struct {
+		name   string
+		config TLSConfig
+	}{
+		{"Cert without key", TLSConfig{Cert: cert}},
+		{"Unknown version", TLSConfig{MinVersion: "1.4"}},
+		{"Unknown cipher", TLSConfig{Ciphers: []string{"TLS_NULL"}}},
+		{"Missing CA file", TLSConfig{CA: "missing.pem"}},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.config.Build()
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package reverseproxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Dyastin-0/mrps/pkg/forwarded"
+	"github.com/Dyastin-0/mrps/pkg/headers"
+	"github.com/Dyastin-0/mrps/pkg/rewriter"
+)
+
+const (
+	HTTP1 = "http1"
+	H2    = "h2"
+	H2C   = "h2c"
+)
+
+// Upstream describes a single destination, Protocol is one of HTTP1, H2 or H2C,
+// empty negotiates HTTP/2 over TLS and uses HTTP/1.1 otherwise
+type Upstream struct {
+	URL      string
+	Protocol string
+	Pool     PoolConfig
+	TLS      *tls.Config
+}
+
+// PoolConfig tunes the connections kept to an upstream, durations are in milliseconds.
+// The connection limits only apply to HTTP/1, HTTP/2 multiplexes requests on one connection.
+type PoolConfig struct {
+	MaxIdle           int   `json:"max_idle,omitempty" yaml:"max_idle,omitempty"`
+	MaxIdlePerHost    int   `json:"max_idle_per_host,omitempty" yaml:"max_idle_per_host,omitempty"`
+	MaxPerHost        int   `json:"max_per_host,omitempty" yaml:"max_per_host,omitempty"`
+	IdleTimeout       int64 `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`
+	KeepAlive         int64 `json:"keepalive,omitempty" yaml:"keepalive,omitempty"`
+	DisableKeepAlives bool  `json:"disable_keepalives,omitempty" yaml:"disable_keepalives,omitempty"`
+}
+
+// TLSConfig holds the settings used to connect to an https upstream, files are PEM encoded
+type TLSConfig struct {
+	CA                 string `json:"ca,omitempty" yaml:"ca,omitempty"`
+	Cert               string `json:"cert,omitempty" yaml:"cert,omitempty"`
+	Key                string `json:"key,omitempty" yaml:"key,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+	ServerName         string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+
+	// MinVersion is one of 1.0, 1.1, 1.2 or 1.3, Ciphers are Go cipher suite names and only apply below 1.3
+	MinVersion string   `json:"min_version,omitempty" yaml:"min_version,omitempty"`
+	Ciphers    []string `json:"ciphers,omitempty" yaml:"ciphers,omitempty"`
+}
+
+// Transport is the round tripper of an upstream, it counts the connections of its pool
+type Transport struct {
+	next http.RoundTripper
+
+	open     atomic.Int64
+	requests atomic.Int64
+	reused   atomic.Int64
+}
+
+// PoolStats is a snapshot of the counters of a Transport, Requests counts the
+// connections handed to requests and Reused those that came from the pool
+type PoolStats struct {
+	Open     int64 `json:"open"`
+	Requests int64 `json:"requests"`
+	Reused   int64 `json:"reused"`
+}
+
+// countedConn decrements the open connections of its transport once closed
+type countedConn struct {
+	net.Conn
+	transport *Transport
+	closeOnce sync.Once
+}
+
+// Config holds the per-route settings shared by every destination of a route
+type Config struct {
+	Route       string
+	RewriteRule rewriter.RewriteRule
+	Headers     headers.Config
+	Forwarded   *forwarded.Forwarded
+	GRPC        bool
+
+	// FlushInterval is how often buffered response data is sent to the client,
+	// negative flushes after every write and zero only flushes streamed responses immediately
+	FlushInterval time.Duration
+
+	// ConnectTimeout bounds dialing and the TLS handshake, FirstByteTimeout the wait for response headers
+	ConnectTimeout   time.Duration
+	FirstByteTimeout time.Duration
+}
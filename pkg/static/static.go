@@ -0,0 +1,271 @@
+// Package static serves files from a local directory, it supports conditional
+// and range requests, precompressed variants and an optional SPA fallback.
+package static
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
+)
+
+var defaultIndex = []string{"index.html"}
+
+// encodings are tried in order, the first one accepted by the client and present on disk wins
+var encodings = []struct {
+	name, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func New(config Config) (*Static, error) {
+	if config.Root == "" {
+		return nil, errors.New("static root is required")
+	}
+
+	info, err := os.Stat(config.Root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid static root: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("static root is not a directory: %s", config.Root)
+	}
+
+	if len(config.Index) == 0 {
+		config.Index = defaultIndex
+	}
+
+	return &Static{
+		fs:     http.Dir(config.Root),
+		config: config,
+	}, nil
+}
+
+func (s *Static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+
+	f, info, err := s.open(name)
+	if err != nil {
+		// only fall back for extensionless paths, a missing asset should stay a 404
+		if s.config.SPA && path.Ext(name) == "" && s.serveIndex(w, r, "/") {
+			return
+		}
+
+		errorpage.Write(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	if !info.IsDir() {
+		defer f.Close()
+		s.serveFile(w, r, name, f, info)
+		return
+	}
+	f.Close()
+
+	if r.URL.Path != "" && !strings.HasSuffix(r.URL.Path, "/") {
+		redirect(w, r, path.Base(r.URL.Path)+"/")
+		return
+	}
+
+	if s.serveIndex(w, r, name) {
+		return
+	}
+
+	if s.config.Browse {
+		s.list(w, r, name)
+		return
+	}
+
+	if s.config.SPA && s.serveIndex(w, r, "/") {
+		return
+	}
+
+	errorpage.Write(w, r, http.StatusNotFound, "not found")
+}
+
+// serveIndex serves the first index file found in dir, it reports whether one was served
+func (s *Static) serveIndex(w http.ResponseWriter, r *http.Request, dir string) bool {
+	for _, index := range s.config.Index {
+		name := path.Join(dir, index)
+
+		f, info, err := s.open(name)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			f.Close()
+			continue
+		}
+
+		defer f.Close()
+		s.serveFile(w, r, name, f, info)
+		return true
+	}
+
+	return false
+}
+
+func (s *Static) serveFile(w http.ResponseWriter, r *http.Request, name string, f http.File, info fs.FileInfo) {
+	header := w.Header()
+
+	if s.config.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+
+		if cf, cinfo, encoding := s.openEncoded(r, name); cf != nil {
+			defer cf.Close()
+
+			header.Set("Content-Encoding", encoding)
+			header.Set("Content-Type", contentType(name))
+			header.Set("ETag", etag(cinfo, encoding))
+
+			http.ServeContent(w, r, name, cinfo.ModTime(), cf)
+			return
+		}
+	}
+
+	header.Set("ETag", etag(info, ""))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+func (s *Static) openEncoded(r *http.Request, name string) (http.File, fs.FileInfo, string) {
+	accept := r.Header.Get("Accept-Encoding")
+	if accept == "" {
+		return nil, nil, ""
+	}
+
+	for _, enc := range encodings {
+		if !AcceptsEncoding(accept, enc.name) {
+			continue
+		}
+
+		f, info, err := s.open(name + enc.ext)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			f.Close()
+			continue
+		}
+
+		return f, info, enc.name
+	}
+
+	return nil, nil, ""
+}
+
+func (s *Static) open(name string) (http.File, fs.FileInfo, error) {
+	f, err := s.fs.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, info, nil
+}
+
+func (s *Static) list(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := s.fs.Open(name)
+	if err != nil {
+		errorpage.Write(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	defer f.Close()
+
+	entries, err := f.Readdir(-1)
+	if err != nil {
+		http.Error(w, "error reading directory", http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	fmt.Fprintf(w, "<!doctype html>\n<title>%s</title>\n<pre>\n", html.EscapeString(name))
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+
+		link := url.URL{Path: entryName}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", link.String(), html.EscapeString(entryName))
+	}
+	fmt.Fprint(w, "</pre>\n")
+}
+
+// AcceptsEncoding reports whether the Accept-Encoding header value accepts enc with a non-zero quality
+func AcceptsEncoding(header, enc string) bool {
+	wildcard := false
+
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		switch coding {
+		case enc:
+			return q > 0
+		case "*":
+			wildcard = q > 0
+		}
+	}
+
+	return wildcard
+}
+
+func etag(info fs.FileInfo, encoding string) string {
+	tag := strconv.FormatInt(info.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(info.Size(), 36)
+	if encoding != "" {
+		tag += "-" + encoding
+	}
+
+	return `"` + tag + `"`
+}
+
+func contentType(name string) string {
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		return ctype
+	}
+
+	return "application/octet-stream"
+}
+
+func redirect(w http.ResponseWriter, r *http.Request, target string) {
+	if q := r.URL.RawQuery; q != "" {
+		target += "?" + q
+	}
+
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
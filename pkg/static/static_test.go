@@ -0,0 +1,191 @@
+package static
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRoot(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	files := map[string]string{
+		"index.html":        "<h1>home</h1>",
+		"app.js":            "console.log('app')",
+		"app.js.gz":         "gzipped",
+		"app.js.br":         "brotli",
+		"docs/readme.txt":   "readme",
+		"assets/logo.svg":   "<svg></svg>",
+		"nested/index.html": "<h1>nested</h1>",
+		"nested/other.html": "<h1>other</h1>",
+		"assets/style.css":  "body{}",
+	}
+
+	for name, content := range files {
+		full := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	return root
+}
+
+func serve(h http.Handler, method, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStatic(t *testing.T) {
+	root := setupRoot(t)
+
+	s, err := New(Config{Root: root})
+	assert.NoError(t, err)
+
+	t.Run("Serves file with validators", func(t *testing.T) {
+		rec := serve(s, http.MethodGet, "/app.js", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "console.log('app')", rec.Body.String())
+		assert.NotEmpty(t, rec.Header().Get("ETag"))
+		assert.NotEmpty(t, rec.Header().Get("Last-Modified"))
+		assert.Contains(t, rec.Header().Get("Content-Type"), "javascript")
+	})
+
+	t.Run("Honors If-None-Match", func(t *testing.T) {
+		etag := serve(s, http.MethodGet, "/app.js", nil).Header().Get("ETag")
+		rec := serve(s, http.MethodGet, "/app.js", map[string]string{"If-None-Match": etag})
+
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.String())
+	})
+
+	t.Run("Serves ranges", func(t *testing.T) {
+		rec := serve(s, http.MethodGet, "/app.js", map[string]string{"Range": "bytes=0-6"})
+
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, "console", rec.Body.String())
+	})
+
+	t.Run("Serves directory index", func(t *testing.T) {
+		rec := serve(s, http.MethodGet, "/nested/", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "<h1>nested</h1>", rec.Body.String())
+	})
+
+	t.Run("Redirects directory without trailing slash", func(t *testing.T) {
+		rec := serve(s, http.MethodGet, "/nested", nil)
+
+		assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+		assert.Equal(t, "nested/", rec.Header().Get("Location"))
+	})
+
+	t.Run("Does not list directories by default", func(t *testing.T) {
+		rec := serve(s, http.MethodGet, "/docs/", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Ignores precompressed variants when disabled", func(t *testing.T) {
+		rec := serve(s, http.MethodGet, "/app.js", map[string]string{"Accept-Encoding": "gzip, br"})
+
+		assert.Empty(t, rec.Header().Get("Content-Encoding"))
+		assert.Equal(t, "console.log('app')", rec.Body.String())
+	})
+
+	t.Run("Rejects writes", func(t *testing.T) {
+		rec := serve(s, http.MethodPost, "/app.js", nil)
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+
+	t.Run("Missing file is not found", func(t *testing.T) {
+		rec := serve(s, http.MethodGet, "/dashboard", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	s, err := New(Config{Root: setupRoot(t), Precompressed: true})
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		expectedEncoding string
+		expectedBody     string
+	}{
+		{"Prefers brotli", "gzip, br", "br", "brotli"},
+		{"Falls back to gzip", "gzip", "gzip", "gzipped"},
+		{"Respects zero quality", "br;q=0, gzip", "gzip", "gzipped"},
+		{"Serves identity", "", "", "console.log('app')"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(s, http.MethodGet, "/app.js", map[string]string{"Accept-Encoding": tt.acceptEncoding})
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.expectedEncoding, rec.Header().Get("Content-Encoding"))
+			assert.Equal(t, tt.expectedBody, rec.Body.String())
+			assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+			assert.Contains(t, rec.Header().Get("Content-Type"), "javascript")
+		})
+	}
+}
+
+func TestStaticSPA(t *testing.T) {
+	s, err := New(Config{Root: setupRoot(t), SPA: true})
+	assert.NoError(t, err)
+
+	t.Run("Falls back to index", func(t *testing.T) {
+		rec := serve(s, http.MethodGet, "/dashboard/settings", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "<h1>home</h1>", rec.Body.String())
+	})
+
+	t.Run("Missing assets stay not found", func(t *testing.T) {
+		rec := serve(s, http.MethodGet, "/assets/missing.js", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("Existing files are served", func(t *testing.T) {
+		rec := serve(s, http.MethodGet, "/assets/style.css", nil)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "body{}", rec.Body.String())
+	})
+}
+
+func TestStaticBrowse(t *testing.T) {
+	s, err := New(Config{Root: setupRoot(t), Browse: true, Index: []string{"default.html"}})
+	assert.NoError(t, err)
+
+	rec := serve(s, http.MethodGet, "/nested/", nil)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<a href="index.html">index.html</a>`)
+	assert.Contains(t, rec.Body.String(), `<a href="other.html">other.html</a>`)
+}
+
+func TestNewInvalidRoot(t *testing.T) {
+	_, err := New(Config{})
+	assert.Error(t, err)
+
+	_, err = New(Config{Root: filepath.Join(t.TempDir(), "missing")})
+	assert.Error(t, err)
+}
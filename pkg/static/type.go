@@ -0,0 +1,16 @@
+package static
+
+import "net/http"
+
+type Config struct {
+	Root          string   `yaml:"root"`
+	Index         []string `yaml:"index,omitempty"`
+	Browse        bool     `yaml:"browse,omitempty"`
+	SPA           bool     `yaml:"spa,omitempty"`
+	Precompressed bool     `yaml:"precompressed,omitempty"`
+}
+
+type Static struct {
+	fs     http.FileSystem
+	config Config
+}
@@ -0,0 +1,154 @@
+// Package timeout applies the timeouts of a request's hop between the client,
+// the proxy and the upstream, and tells client timeouts apart from upstream ones.
+package timeout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+type contextKey struct{}
+
+// ErrFirstByte is returned when the upstream sends no response headers in time, it wraps context.DeadlineExceeded
+var ErrFirstByte = fmt.Errorf("upstream sent no response in time: %w", context.DeadlineExceeded)
+
+// Merge fills the unset fields of c from parent
+func (c Config) Merge(parent Config) Config {
+	inherit := func(value, fallback int64) int64 {
+		if value == 0 {
+			return fallback
+		}
+		return value
+	}
+
+	return Config{
+		Read:        inherit(c.Read, parent.Read),
+		Write:       inherit(c.Write, parent.Write),
+		Idle:        inherit(c.Idle, parent.Idle),
+		Connect:     inherit(c.Connect, parent.Connect),
+		FirstByte:   inherit(c.FirstByte, parent.FirstByte),
+		Request:     inherit(c.Request, parent.Request),
+		TCPIdle:     inherit(c.TCPIdle, parent.TCPIdle),
+		TCPLifetime: inherit(c.TCPLifetime, parent.TCPLifetime),
+	}
+}
+
+// Duration converts a setting, disabled and unset timeouts are zero
+func Duration(ms int64) time.Duration {
+	if ms <= 0 {
+		return 0
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
+
+// Apply sets the client deadlines of c on the connection of r and bounds the whole request.
+// The returned request must be used from then on, and cancel called once it is served.
+// Upgrades are left unbounded, the connection outlives the request once hijacked and the
+// upgraded protocol applies its own timeouts
+func (c Config) Apply(w http.ResponseWriter, r *http.Request) (*http.Request, context.CancelFunc) {
+	rc := http.NewResponseController(w)
+	now := time.Now()
+
+	if IsUpgrade(r) {
+		c.Read, c.Write, c.Request = 0, 0, 0
+	}
+
+	// always set, deadlines outlive the request on keep-alive connections and hijacks.
+	// errors mean the connection does not support deadlines, HTTP/3 does not
+	rc.SetReadDeadline(deadline(now, c.Read))
+	rc.SetWriteDeadline(deadline(now, c.Write))
+
+	s := &state{}
+	ctx := context.WithValue(r.Context(), contextKey{}, s)
+
+	cancel := context.CancelFunc(func() {})
+	if c.Request > 0 {
+		ctx, cancel = context.WithTimeout(ctx, Duration(c.Request))
+	}
+
+	r = r.WithContext(ctx)
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &body{ReadCloser: r.Body, state: s}
+	}
+
+	return r, cancel
+}
+
+// IsUpgrade reports whether r asks to switch protocols, such as a WebSocket handshake
+func IsUpgrade(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" && httpguts.HeaderValuesContainsToken(r.Header["Connection"], "upgrade")
+}
+
+// deadline returns the zero time, no deadline, for unset and disabled timeouts
+func deadline(now time.Time, ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+
+	return now.Add(Duration(ms))
+}
+
+// ClientTimedOut reports whether reading the body of the request of ctx from the client timed out
+func ClientTimedOut(ctx context.Context) bool {
+	s, ok := ctx.Value(contextKey{}).(*state)
+	return ok && s.clientTimedOut.Load()
+}
+
+func (b *body) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		b.state.clientTimedOut.Store(true)
+	}
+
+	return n, err
+}
+
+// Transport bounds the time next takes to return response headers, the body is not limited
+func Transport(next http.RoundTripper, timeout time.Duration) http.RoundTripper {
+	if timeout <= 0 {
+		return next
+	}
+
+	return &firstByte{next: next, timeout: timeout}
+}
+
+func (f *firstByte) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(f.timeout, func() { cancel(ErrFirstByte) })
+
+	resp, err := f.next.RoundTrip(req.WithContext(ctx))
+	timer.Stop()
+
+	if err != nil {
+		if errors.Is(context.Cause(ctx), ErrFirstByte) {
+			err = ErrFirstByte
+		}
+
+		cancel(nil)
+		return nil, err
+	}
+
+	// the body of an upgrade is the connection itself, it must stay an io.ReadWriteCloser
+	// and its context ends with the request
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return resp, nil
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: func() { cancel(nil) }}
+	return resp, nil
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
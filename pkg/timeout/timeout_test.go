@@ -0,0 +1,117 @@
+package timeout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	global := Config{Read: 1000, Write: 2000, Connect: 3000}
+	domain := Config{Write: -1, FirstByte: 4000}
+	route := Config{Read: 500}
+
+	merged := route.Merge(domain.Merge(global))
+
+	assert.Equal(t, Config{Read: 500, Write: -1, Connect: 3000, FirstByte: 4000}, merged)
+	assert.Equal(t, 500*time.Millisecond, Duration(merged.Read))
+	assert.Zero(t, Duration(merged.Write))
+	assert.Zero(t, Duration(merged.Request))
+}
+
+func TestApply(t *testing.T) {
+	t.Run("Request", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		r, cancel := Config{Request: 50}.Apply(httptest.NewRecorder(), r)
+		defer cancel()
+
+		deadline, ok := r.Context().Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(50*time.Millisecond), deadline, 20*time.Millisecond)
+		assert.False(t, ClientTimedOut(r.Context()))
+	})
+
+	t.Run("Upgrade", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Connection", "keep-alive, Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+
+		r, cancel := Config{Request: 50}.Apply(httptest.NewRecorder(), r)
+		defer cancel()
+
+		_, ok := r.Context().Deadline()
+		assert.False(t, ok)
+	})
+
+	t.Run("Client read", func(t *testing.T) {
+		result := make(chan bool, 1)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, cancel := Config{Read: 50}.Apply(w, r)
+			defer cancel()
+
+			_, err := io.ReadAll(r.Body)
+			result <- err != nil && ClientTimedOut(r.Context())
+		}))
+		defer server.Close()
+
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		// announces more than it sends
+		fmt.Fprint(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nab")
+
+		select {
+		case timedOut := <-result:
+			assert.True(t, timedOut)
+		case <-time.After(time.Second):
+			t.Fatal("body read did not time out")
+		}
+	})
+}
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		// the body may take longer than the timeout
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	}))
+	defer server.Close()
+
+	transport := Transport(http.DefaultTransport, 50*time.Millisecond)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/slow", nil)
+	_, err := transport.RoundTrip(req)
+	assert.ErrorIs(t, err, ErrFirstByte)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/fast", nil)
+	resp, err := transport.RoundTrip(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "done", string(body))
+
+	assert.Same(t, http.DefaultTransport, Transport(http.DefaultTransport, 0))
+}
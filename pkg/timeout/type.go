@@ -0,0 +1,39 @@
+package timeout
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds timeouts in milliseconds, zero inherits the enclosing level and negative disables the timeout
+type Config struct {
+	Read        int64 `json:"read,omitempty" yaml:"read,omitempty"`
+	Write       int64 `json:"write,omitempty" yaml:"write,omitempty"`
+	Idle        int64 `json:"idle,omitempty" yaml:"idle,omitempty"`
+	Connect     int64 `json:"connect,omitempty" yaml:"connect,omitempty"`
+	FirstByte   int64 `json:"first_byte,omitempty" yaml:"first_byte,omitempty"`
+	Request     int64 `json:"request,omitempty" yaml:"request,omitempty"`
+	TCPIdle     int64 `json:"tcp_idle,omitempty" yaml:"tcp_idle,omitempty"`
+	TCPLifetime int64 `json:"tcp_max_lifetime,omitempty" yaml:"tcp_max_lifetime,omitempty"`
+}
+
+type state struct {
+	clientTimedOut atomic.Bool
+}
+
+type body struct {
+	io.ReadCloser
+	state *state
+}
+
+type firstByte struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
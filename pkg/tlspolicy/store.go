@@ -0,0 +1,146 @@
+package tlspolicy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NewStore loads the certificates of dir, every name.crt or name.pem needs a name.key next to it.
+// The store is returned along errors of single certificates, those are skipped
+func NewStore(dir string) (*Store, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	s := &Store{
+		dir:   dir,
+		files: make(map[string]*tls.Certificate),
+		names: make(map[string]*tls.Certificate),
+	}
+
+	return s, s.Load()
+}
+
+// Load rescans the directory, files that fail to load keep their previous certificate
+func (s *Store) Load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	previous := s.files
+	s.mu.RUnlock()
+
+	files := make(map[string]*tls.Certificate)
+	var errs []error
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".crt" && ext != ".pem") {
+			continue
+		}
+
+		certFile := filepath.Join(s.dir, entry.Name())
+		keyFile := strings.TrimSuffix(certFile, ext) + ".key"
+
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", certFile, err))
+
+			if old, ok := previous[certFile]; ok {
+				files[certFile] = old
+			}
+			continue
+		}
+
+		files[certFile] = &cert
+	}
+
+	// sorted so overlapping certificates resolve the same way on every load
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	byName := make(map[string]*tls.Certificate)
+	for _, path := range paths {
+		for _, name := range names(files[path]) {
+			byName[normalize(name)] = files[path]
+		}
+	}
+
+	s.mu.Lock()
+	s.files = files
+	s.names = byName
+	s.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// Get returns the certificate covering name, exact names win over wildcards
+func (s *Store) Get(name string) *tls.Certificate {
+	name = normalize(name)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if cert, ok := s.names[name]; ok {
+		return cert
+	}
+
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return s.names["*"+name[i:]]
+	}
+
+	return nil
+}
+
+// Names returns the names covered by the store
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.names))
+	for name := range s.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Certificates returns the loaded certificates ordered by file
+func (s *Store) Certificates() []*tls.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	paths := make([]string, 0, len(s.files))
+	for path := range s.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	certs := make([]*tls.Certificate, 0, len(paths))
+	for _, path := range paths {
+		certs = append(certs, s.files[path])
+	}
+
+	return certs
+}
+
+// Dir returns the directory of the store
+func (s *Store) Dir() string {
+	return s.dir
+}
@@ -0,0 +1,149 @@
+package tlspolicy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// acmeTLS1 is the ALPN protocol of tls-alpn-01 challenges, it survives ALPN overrides
+const acmeTLS1 = "acme-tls/1"
+
+var versions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion converts 1.0, 1.1, 1.2 or 1.3 to its tls constant
+func ParseVersion(version string) (uint16, error) {
+	v, ok := versions[version]
+	if !ok {
+		return 0, fmt.Errorf("unsupported tls version: %s", version)
+	}
+
+	return v, nil
+}
+
+// ParseCiphers converts Go cipher suite names to their IDs
+func ParseCiphers(names []string) ([]uint16, error) {
+	suites := append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(suites, func(suite *tls.CipherSuite) bool { return suite.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unsupported cipher suite: %s", name)
+		}
+		ids = append(ids, suites[i].ID)
+	}
+
+	return ids, nil
+}
+
+// New loads the certificate of config and checks its settings
+func New(config Config) (*Policy, error) {
+	p := &Policy{alpn: config.ALPN}
+
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, fmt.Errorf("cert_file and key_file must be set together")
+	}
+
+	if config.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("certificate: %v", err)
+		}
+		p.cert = &cert
+	}
+
+	if config.MinVersion != "" {
+		version, err := ParseVersion(config.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		p.minVersion = version
+	}
+
+	ciphers, err := ParseCiphers(config.Ciphers)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphers) > 0 {
+		p.ciphers = ciphers
+	}
+
+	if config.HSTS != nil {
+		if config.HSTS.MaxAge < 0 {
+			return nil, fmt.Errorf("hsts max_age cannot be negative")
+		}
+
+		p.hsts = "max-age=" + strconv.FormatInt(config.HSTS.MaxAge, 10)
+		if config.HSTS.IncludeSubdomains {
+			p.hsts += "; includeSubDomains"
+		}
+		if config.HSTS.Preload {
+			p.hsts += "; preload"
+		}
+	}
+
+	return p, nil
+}
+
+// Certificate returns the certificate of the policy, nil when it relies on managed ones
+func (p *Policy) Certificate() *tls.Certificate {
+	return p.cert
+}
+
+// HSTS returns the Strict-Transport-Security value, empty when disabled
+func (p *Policy) HSTS() string {
+	return p.hsts
+}
+
+// Apply sets the version, ciphers and ALPN protocols of the policy on config
+func (p *Policy) Apply(config *tls.Config) {
+	if p.minVersion != 0 {
+		config.MinVersion = p.minVersion
+	}
+
+	if len(p.ciphers) > 0 {
+		config.CipherSuites = p.ciphers
+	}
+
+	if len(p.alpn) > 0 {
+		protos := slices.Clone(p.alpn)
+		if slices.Contains(config.NextProtos, acmeTLS1) && !slices.Contains(protos, acmeTLS1) {
+			protos = append(protos, acmeTLS1)
+		}
+		config.NextProtos = protos
+	}
+}
+
+// IsChallenge reports whether hello is a tls-alpn-01 challenge, those need the managed certificate
+func IsChallenge(hello *tls.ClientHelloInfo) bool {
+	return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acmeTLS1
+}
+
+// names lists the host names a certificate is valid for
+func names(cert *tls.Certificate) []string {
+	if cert.Leaf == nil {
+		return nil
+	}
+
+	if len(cert.Leaf.DNSNames) > 0 {
+		return cert.Leaf.DNSNames
+	}
+
+	if cert.Leaf.Subject.CommonName != "" {
+		return []string{cert.Leaf.Subject.CommonName}
+	}
+
+	return nil
+}
+
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
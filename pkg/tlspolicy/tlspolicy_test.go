@@ -0,0 +1,150 @@
+package tlspolicy
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Dyastin-0/mrps/internal/testcert"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCert writes a self-signed certificate for names as dir/file.crt and dir/file.key
+func writeCert(t *testing.T, dir, file string, names ...string) (certFile, keyFile string) {
+	t.Helper()
+
+	return testcert.Write(t, dir, file, testcert.SelfSigned(t, names...))
+}
+
+func TestNew(t *testing.T) {
+	certFile, keyFile := writeCert(t, t.TempDir(), "internal", "internal.corp")
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"Empty", Config{}, false},
+		{"Certificate", Config{CertFile: certFile, KeyFile: keyFile}, false},
+		{"Cert without key", Config{CertFile: certFile}, true},
+		{"Missing files", Config{CertFile: "missing.crt", KeyFile: "missing.key"}, true},
+		{"Unknown version", Config{MinVersion: "1.4"}, true},
+		{"Unknown cipher", Config{Ciphers: []string{"TLS_NULL"}}, true},
+		{"Negative HSTS", Config{HSTS: &HSTS{MaxAge: -1}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	t.Run("Apply", func(t *testing.T) {
+		p, err := New(Config{
+			MinVersion: "1.2",
+			Ciphers:    []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+			ALPN:       []string{"postgresql"},
+		})
+		assert.NoError(t, err)
+
+		config := &tls.Config{NextProtos: []string{"h2", "http/1.1", acmeTLS1}}
+		p.Apply(config)
+
+		assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+		assert.Equal(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, config.CipherSuites)
+		assert.Equal(t, []string{"postgresql", acmeTLS1}, config.NextProtos)
+	})
+
+	t.Run("Apply keeps unset fields", func(t *testing.T) {
+		p, err := New(Config{})
+		assert.NoError(t, err)
+
+		config := &tls.Config{MinVersion: tls.VersionTLS13, NextProtos: []string{"h2"}}
+		p.Apply(config)
+
+		assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+		assert.Equal(t, []string{"h2"}, config.NextProtos)
+		assert.Nil(t, p.Certificate())
+	})
+
+	t.Run("HSTS", func(t *testing.T) {
+		p, err := New(Config{HSTS: &HSTS{MaxAge: 31536000, IncludeSubdomains: true, Preload: true}})
+		assert.NoError(t, err)
+		assert.Equal(t, "max-age=31536000; includeSubDomains; preload", p.HSTS())
+
+		p, err = New(Config{})
+		assert.NoError(t, err)
+		assert.Empty(t, p.HSTS())
+	})
+
+	t.Run("Challenge", func(t *testing.T) {
+		assert.True(t, IsChallenge(&tls.ClientHelloInfo{SupportedProtos: []string{acmeTLS1}}))
+		assert.False(t, IsChallenge(&tls.ClientHelloInfo{SupportedProtos: []string{"h2", "http/1.1"}}))
+	})
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	writeCert(t, dir, "internal", "internal.corp", "api.internal.corp")
+	writeCert(t, dir, "wildcard", "*.apps.corp")
+
+	// keys and unrelated files are skipped
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("certs"), 0o600))
+
+	store, err := NewStore(dir)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"*.apps.corp", "api.internal.corp", "internal.corp"}, store.Names())
+	assert.Len(t, store.Certificates(), 2)
+
+	t.Run("Exact", func(t *testing.T) {
+		assert.NotNil(t, store.Get("internal.corp"))
+		assert.NotNil(t, store.Get("API.internal.corp."))
+	})
+
+	t.Run("Wildcard", func(t *testing.T) {
+		assert.NotNil(t, store.Get("billing.apps.corp"))
+		assert.Nil(t, store.Get("apps.corp"))
+		assert.Nil(t, store.Get("a.billing.apps.corp"))
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		assert.Nil(t, store.Get("domain.com"))
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		previous := store.Get("internal.corp")
+
+		writeCert(t, dir, "new", "new.corp")
+
+		// a half written pair keeps serving the old certificate
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "internal.key"), []byte("partial"), 0o600))
+
+		assert.Error(t, store.Load())
+		assert.NotNil(t, store.Get("new.corp"))
+		assert.Same(t, previous, store.Get("internal.corp"))
+
+		writeCert(t, dir, "internal", "internal.corp")
+		assert.NoError(t, store.Load())
+		assert.NotSame(t, previous, store.Get("internal.corp"))
+		assert.Nil(t, store.Get("api.internal.corp"))
+
+		assert.NoError(t, os.Remove(filepath.Join(dir, "new.crt")))
+		assert.NoError(t, store.Load())
+		assert.Nil(t, store.Get("new.corp"))
+	})
+
+	t.Run("Missing dir", func(t *testing.T) {
+		store, err := NewStore(filepath.Join(dir, "missing"))
+		assert.Error(t, err)
+		assert.Nil(t, store)
+	})
+}
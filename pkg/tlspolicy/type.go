@@ -0,0 +1,43 @@
+package tlspolicy
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+// Config is the TLS policy of a domain. CertFile and KeyFile serve a certificate
+// of its own instead of an ACME one, MinVersion is one of 1.0, 1.1, 1.2 or 1.3,
+// Ciphers are Go cipher suite names and only apply below 1.3
+type Config struct {
+	CertFile   string   `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile    string   `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	MinVersion string   `json:"min_version,omitempty" yaml:"min_version,omitempty"`
+	Ciphers    []string `json:"ciphers,omitempty" yaml:"ciphers,omitempty"`
+	ALPN       []string `json:"alpn,omitempty" yaml:"alpn,omitempty"`
+	HSTS       *HSTS    `json:"hsts,omitempty" yaml:"hsts,omitempty"`
+}
+
+// HSTS is sent as Strict-Transport-Security, MaxAge is in seconds
+type HSTS struct {
+	MaxAge            int64 `json:"max_age" yaml:"max_age"`
+	IncludeSubdomains bool  `json:"include_subdomains,omitempty" yaml:"include_subdomains,omitempty"`
+	Preload           bool  `json:"preload,omitempty" yaml:"preload,omitempty"`
+}
+
+// Policy is a loaded Config
+type Policy struct {
+	cert       *tls.Certificate
+	minVersion uint16
+	ciphers    []uint16
+	alpn       []string
+	hsts       string
+}
+
+// Store serves the certificates found in a directory by the names they cover
+type Store struct {
+	dir string
+
+	mu    sync.RWMutex
+	files map[string]*tls.Certificate
+	names map[string]*tls.Certificate
+}
@@ -45,3 +45,45 @@ func Watch(ctx context.Context, filename string, callback func()) {
 		}
 	}
 }
+
+// WatchDir calls callback whenever a file in dir is created, written, removed or renamed
+func WatchDir(ctx context.Context, dir string, callback func()) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create directory watcher")
+		return
+	}
+	defer watcher.Close()
+
+	err = watcher.Add(dir)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to watch directory")
+		return
+	}
+
+	log.Info().Str("status", "running").Str("target", dir).Msg("watcher")
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			if event.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Remove|fsnotify.Rename) != 0 {
+				log.Info().Str("event", event.Op.String()).Str("target", event.Name).Msg("watcher")
+				callback()
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error().Err(err).Msg("watcher")
+
+		case <-ctx.Done():
+			log.Info().Str("status", "stopping").Msg("watcher")
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package wsproxy
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config limits the WebSocket connections upgraded through a route, zero values disable a limit
+type Config struct {
+	MaxConnections int      `json:"max_connections,omitempty" yaml:"max_connections,omitempty"`
+	IdleTimeout    int64    `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`
+	MaxLifetime    int64    `json:"max_lifetime,omitempty" yaml:"max_lifetime,omitempty"`
+	MaxFrameSize   int64    `json:"max_frame_size,omitempty" yaml:"max_frame_size,omitempty"`
+	AllowedOrigins []string `json:"allowed_origins,omitempty" yaml:"allowed_origins,omitempty"`
+}
+
+// Proxy enforces a Config on upgrade requests and keeps counters for the connections it let through
+type Proxy struct {
+	maxConnections int64
+	idleTimeout    time.Duration
+	maxLifetime    time.Duration
+	maxFrameSize   uint64
+	origins        map[string]bool
+	anyOrigin      bool
+
+	active          atomic.Int64
+	total           atomic.Int64
+	rejectedOrigin  atomic.Int64
+	rejectedLimit   atomic.Int64
+	closedIdle      atomic.Int64
+	closedLifetime  atomic.Int64
+	closedFrameSize atomic.Int64
+	messagesIn      atomic.Int64
+	messagesOut     atomic.Int64
+	bytesIn         atomic.Int64
+	bytesOut        atomic.Int64
+}
+
+// Stats is a snapshot of the counters of one or more proxies,
+// In is traffic from clients to backends and Out the other way around
+type Stats struct {
+	Active          int64 `json:"active"`
+	Total           int64 `json:"total"`
+	RejectedOrigin  int64 `json:"rejected_origin"`
+	RejectedLimit   int64 `json:"rejected_limit"`
+	ClosedIdle      int64 `json:"closed_idle"`
+	ClosedLifetime  int64 `json:"closed_lifetime"`
+	ClosedFrameSize int64 `json:"closed_frame_size"`
+	MessagesIn      int64 `json:"messages_in"`
+	MessagesOut     int64 `json:"messages_out"`
+	BytesIn         int64 `json:"bytes_in"`
+	BytesOut        int64 `json:"bytes_out"`
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	proxy *Proxy
+}
+
+// conn watches the frames going through a hijacked client connection
+type conn struct {
+	net.Conn
+	proxy *Proxy
+
+	in  frames
+	out frames
+
+	writeMu    sync.Mutex
+	closeOnce  sync.Once
+	lastActive atomic.Int64
+	idle       *time.Timer
+	lifetime   *time.Timer
+}
+
+// frames follows frame boundaries in one direction of a connection
+type frames struct {
+	header    [14]byte
+	read      int
+	remaining uint64
+}
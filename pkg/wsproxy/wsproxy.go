@@ -0,0 +1,335 @@
+// Package wsproxy applies origin checks, connection limits, timeouts and frame size limits
+// to WebSocket connections proxied by httputil.ReverseProxy, and counts their traffic.
+package wsproxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Dyastin-0/mrps/pkg/errorpage"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	closeGoingAway = 1001
+	closeTooLarge  = 1009
+)
+
+var errFrameTooLarge = errors.New("websocket frame exceeds the size limit")
+
+func New(config Config) (*Proxy, error) {
+	if config.MaxConnections < 0 || config.IdleTimeout < 0 || config.MaxLifetime < 0 || config.MaxFrameSize < 0 {
+		return nil, fmt.Errorf("websocket limits cannot be negative")
+	}
+
+	p := &Proxy{
+		maxConnections: int64(config.MaxConnections),
+		idleTimeout:    time.Duration(config.IdleTimeout) * time.Millisecond,
+		maxLifetime:    time.Duration(config.MaxLifetime) * time.Millisecond,
+		maxFrameSize:   uint64(config.MaxFrameSize),
+		origins:        make(map[string]bool),
+	}
+
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			p.anyOrigin = true
+		}
+		p.origins[strings.ToLower(origin)] = true
+	}
+
+	return p, nil
+}
+
+// IsWebSocket reports whether r asks to upgrade to the WebSocket protocol
+func IsWebSocket(r *http.Request) bool {
+	return httpguts.HeaderValuesContainsToken(r.Header["Connection"], "upgrade") &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// Serve passes an upgrade request to next once the origin and connection limit allow it,
+// the connection next hijacks is watched until it closes
+func (p *Proxy) Serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if !p.allowOrigin(r.Header.Get("Origin")) {
+		p.rejectedOrigin.Add(1)
+		errorpage.Write(w, r, http.StatusForbidden, "origin not allowed")
+		return
+	}
+
+	if !p.acquire() {
+		p.rejectedLimit.Add(1)
+		errorpage.Write(w, r, http.StatusServiceUnavailable, "too many websocket connections")
+		return
+	}
+	defer p.active.Add(-1)
+
+	next.ServeHTTP(&responseWriter{ResponseWriter: w, proxy: p}, r)
+}
+
+// allowOrigin accepts requests without an Origin, they do not come from browsers
+func (p *Proxy) allowOrigin(origin string) bool {
+	if origin == "" || p.anyOrigin || len(p.origins) == 0 {
+		return true
+	}
+
+	return p.origins[strings.ToLower(origin)]
+}
+
+// acquire counts a connection being upgraded or open against the limit
+func (p *Proxy) acquire() bool {
+	for {
+		active := p.active.Load()
+		if p.maxConnections > 0 && active >= p.maxConnections {
+			return false
+		}
+
+		if p.active.CompareAndSwap(active, active+1) {
+			return true
+		}
+	}
+}
+
+func (p *Proxy) Stats() Stats {
+	return Stats{
+		Active:          p.active.Load(),
+		Total:           p.total.Load(),
+		RejectedOrigin:  p.rejectedOrigin.Load(),
+		RejectedLimit:   p.rejectedLimit.Load(),
+		ClosedIdle:      p.closedIdle.Load(),
+		ClosedLifetime:  p.closedLifetime.Load(),
+		ClosedFrameSize: p.closedFrameSize.Load(),
+		MessagesIn:      p.messagesIn.Load(),
+		MessagesOut:     p.messagesOut.Load(),
+		BytesIn:         p.bytesIn.Load(),
+		BytesOut:        p.bytesOut.Load(),
+	}
+}
+
+// Add sums the counters of other into s
+func (s *Stats) Add(other Stats) {
+	s.Active += other.Active
+	s.Total += other.Total
+	s.RejectedOrigin += other.RejectedOrigin
+	s.RejectedLimit += other.RejectedLimit
+	s.ClosedIdle += other.ClosedIdle
+	s.ClosedLifetime += other.ClosedLifetime
+	s.ClosedFrameSize += other.ClosedFrameSize
+	s.MessagesIn += other.MessagesIn
+	s.MessagesOut += other.MessagesOut
+	s.BytesIn += other.BytesIn
+	s.BytesOut += other.BytesOut
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, brw, err := http.NewResponseController(rw.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rw.proxy.watch(c), brw, nil
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (p *Proxy) watch(c net.Conn) *conn {
+	p.total.Add(1)
+
+	wc := &conn{Conn: c, proxy: p}
+	wc.touch()
+
+	// armed after the assignment, checkIdle resets the timer
+	if p.idleTimeout > 0 {
+		wc.idle = time.AfterFunc(math.MaxInt64, wc.checkIdle)
+		wc.idle.Reset(p.idleTimeout)
+	}
+
+	if p.maxLifetime > 0 {
+		wc.lifetime = time.AfterFunc(p.maxLifetime, func() {
+			p.closedLifetime.Add(1)
+			wc.closeWith(closeGoingAway, "max lifetime reached")
+		})
+	}
+
+	return wc
+}
+
+func (c *conn) touch() {
+	c.lastActive.Store(time.Now().UnixNano())
+}
+
+func (c *conn) checkIdle() {
+	idle := time.Since(time.Unix(0, c.lastActive.Load()))
+	if idle < c.proxy.idleTimeout {
+		c.idle.Reset(c.proxy.idleTimeout - idle)
+		return
+	}
+
+	c.proxy.closedIdle.Add(1)
+	c.closeWith(closeGoingAway, "idle timeout")
+}
+
+// Read carries client frames to the backend
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n == 0 {
+		return n, err
+	}
+
+	c.touch()
+	c.proxy.bytesIn.Add(int64(n))
+
+	messages, ok := c.in.feed(p[:n], c.proxy.maxFrameSize)
+	c.proxy.messagesIn.Add(messages)
+
+	if !ok {
+		c.proxy.closedFrameSize.Add(1)
+		c.closeWith(closeTooLarge, "frame too large")
+		return 0, errFrameTooLarge
+	}
+
+	return n, err
+}
+
+// Write carries backend frames to the client
+func (c *conn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+
+	sent := c.out
+	messages, ok := c.out.feed(p, c.proxy.maxFrameSize)
+	if !ok {
+		// nothing of p is written, the close frame goes after what was
+		c.out = sent
+		c.writeMu.Unlock()
+
+		c.proxy.closedFrameSize.Add(1)
+		c.closeWith(closeTooLarge, "frame too large")
+		return 0, errFrameTooLarge
+	}
+
+	n, err := c.Conn.Write(p)
+	c.writeMu.Unlock()
+
+	c.touch()
+	c.proxy.bytesOut.Add(int64(n))
+	c.proxy.messagesOut.Add(messages)
+
+	return n, err
+}
+
+// closeWith tells the client why the proxy ends the connection, when it can do so
+// without cutting a frame short, and closes it
+func (c *conn) closeWith(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.writeMu.Lock()
+		if c.out.boundary() {
+			c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+			c.Conn.Write(closeFrame(code, reason))
+		}
+		c.writeMu.Unlock()
+
+		c.stop()
+		c.Conn.Close()
+	})
+}
+
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {})
+	c.stop()
+
+	return c.Conn.Close()
+}
+
+func (c *conn) stop() {
+	if c.idle != nil {
+		c.idle.Stop()
+	}
+
+	if c.lifetime != nil {
+		c.lifetime.Stop()
+	}
+}
+
+// closeFrame builds an unmasked close frame, reason must be shorter than 124 bytes
+func closeFrame(code int, reason string) []byte {
+	frame := []byte{0x88, byte(2 + len(reason)), byte(code >> 8), byte(code)}
+	return append(frame, reason...)
+}
+
+// feed advances past p and returns the number of data messages completed,
+// false means a frame announced a payload larger than limit
+func (f *frames) feed(p []byte, limit uint64) (int64, bool) {
+	var messages int64
+
+	for len(p) > 0 {
+		if f.remaining > 0 {
+			skip := min(f.remaining, uint64(len(p)))
+			f.remaining -= skip
+			p = p[skip:]
+			continue
+		}
+
+		f.header[f.read] = p[0]
+		f.read++
+		p = p[1:]
+
+		if f.read < 2 || f.read < f.headerSize() {
+			continue
+		}
+
+		f.read = 0
+		length := f.payloadLength()
+
+		if limit > 0 && length > limit {
+			return messages, false
+		}
+
+		// control frames have opcodes from 0x8, they are not part of messages
+		if f.header[0]&0x80 != 0 && f.header[0]&0x0f < 0x8 {
+			messages++
+		}
+
+		f.remaining = length
+	}
+
+	return messages, true
+}
+
+func (f *frames) headerSize() int {
+	size := 2
+
+	switch f.header[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+
+	if f.header[1]&0x80 != 0 {
+		size += 4
+	}
+
+	return size
+}
+
+func (f *frames) payloadLength() uint64 {
+	switch length := f.header[1] & 0x7f; length {
+	case 126:
+		return uint64(binary.BigEndian.Uint16(f.header[2:4]))
+	case 127:
+		return binary.BigEndian.Uint64(f.header[2:10])
+	default:
+		return uint64(length)
+	}
+}
+
+func (f *frames) boundary() bool {
+	return f.read == 0 && f.remaining == 0
+}
@@ -0,0 +1,223 @@
+package wsproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func echoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func proxyServer(t *testing.T, config Config) (*Proxy, string) {
+	t.Helper()
+
+	backend, _ := url.Parse(echoServer(t).URL)
+	rp := httputil.NewSingleHostReverseProxy(backend)
+
+	p, err := New(config)
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.Serve(w, r, rp)
+	}))
+	t.Cleanup(server.Close)
+
+	return p, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dial(t *testing.T, target, origin string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+
+	conn, resp, err := websocket.DefaultDialer.Dial(target, header)
+	if conn != nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+
+	return conn, resp, err
+}
+
+func TestIsWebSocket(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.False(t, IsWebSocket(r))
+
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "WebSocket")
+	assert.True(t, IsWebSocket(r))
+
+	r.Header.Set("Upgrade", "h2c")
+	assert.False(t, IsWebSocket(r))
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New(Config{IdleTimeout: -1})
+	assert.Error(t, err)
+}
+
+func TestProxy(t *testing.T) {
+	p, target := proxyServer(t, Config{})
+
+	conn, _, err := dial(t, target, "")
+	assert.NoError(t, err)
+
+	for _, message := range []string{"hello", strings.Repeat("x", 70000)} {
+		assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(message)))
+
+		_, echoed, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, message, string(echoed))
+	}
+
+	stats := p.Stats()
+	assert.Equal(t, int64(1), stats.Active)
+	assert.Equal(t, int64(1), stats.Total)
+	assert.Equal(t, int64(2), stats.MessagesIn)
+	assert.Equal(t, int64(2), stats.MessagesOut)
+	assert.Greater(t, stats.BytesIn, int64(70005))
+	assert.Greater(t, stats.BytesOut, int64(70005))
+
+	conn.Close()
+	assert.Eventually(t, func() bool { return p.Stats().Active == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestOrigin(t *testing.T) {
+	p, target := proxyServer(t, Config{AllowedOrigins: []string{"https://app.domain.com"}})
+
+	_, resp, err := dial(t, target, "https://evil.com")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	_, _, err = dial(t, target, "https://APP.domain.com")
+	assert.NoError(t, err)
+
+	_, _, err = dial(t, target, "")
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(1), p.Stats().RejectedOrigin)
+}
+
+func TestMaxConnections(t *testing.T) {
+	p, target := proxyServer(t, Config{MaxConnections: 1})
+
+	first, _, err := dial(t, target, "")
+	assert.NoError(t, err)
+
+	_, resp, err := dial(t, target, "")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int64(1), p.Stats().RejectedLimit)
+
+	first.Close()
+	assert.Eventually(t, func() bool {
+		_, _, err := dial(t, target, "")
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestFrameSize(t *testing.T) {
+	p, target := proxyServer(t, Config{MaxFrameSize: 1024})
+
+	conn, _, err := dial(t, target, "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, make([]byte, 1024)))
+	_, _, err = conn.ReadMessage()
+	assert.NoError(t, err)
+
+	conn.WriteMessage(websocket.BinaryMessage, make([]byte, 1025))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), err)
+	assert.Equal(t, int64(1), p.Stats().ClosedFrameSize)
+}
+
+func TestTimeouts(t *testing.T) {
+	t.Run("Idle", func(t *testing.T) {
+		p, target := proxyServer(t, Config{IdleTimeout: 100})
+
+		conn, _, err := dial(t, target, "")
+		assert.NoError(t, err)
+
+		// activity keeps the connection open past the timeout
+		for i := 0; i < 3; i++ {
+			time.Sleep(50 * time.Millisecond)
+			assert.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte("ping")))
+			_, _, err = conn.ReadMessage()
+			assert.NoError(t, err)
+		}
+
+		_, _, err = conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+		assert.Equal(t, int64(1), p.Stats().ClosedIdle)
+	})
+
+	t.Run("Lifetime", func(t *testing.T) {
+		p, target := proxyServer(t, Config{MaxLifetime: 100})
+
+		conn, _, err := dial(t, target, "")
+		assert.NoError(t, err)
+
+		start := time.Now()
+		_, _, err = conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+		assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+		assert.Equal(t, int64(1), p.Stats().ClosedLifetime)
+	})
+}
+
+func TestFrames(t *testing.T) {
+	var f frames
+
+	// fragmented text message split across writes, a ping in between
+	stream := []byte{0x01, 0x83, 1, 2, 3, 4, 'a', 'b', 'c', 0x89, 0x00, 0x80, 0x7e, 0x01, 0x00}
+	stream = append(stream, make([]byte, 256)...)
+
+	messages, ok := f.feed(stream[:5], 0)
+	assert.True(t, ok)
+	assert.Zero(t, messages)
+	assert.False(t, f.boundary())
+
+	messages, ok = f.feed(stream[5:], 0)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), messages)
+	assert.True(t, f.boundary())
+
+	_, ok = f.feed([]byte{0x82, 0x7e, 0x01, 0x01}, 256)
+	assert.False(t, ok)
+}